@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// explainAbsence tells apart the ways expected records can be missing: the
+// name not existing at all, existing without records of the type, or being
+// answered by a wildcard instead. err is the failure of the check.
+func (c *checker) explainAbsence(ns string, domain string, name string, exp expectation, resp *dns.Msg, err error) error {
+	code := errorCode(err)
+	if code == codeNXDomain && !exp.absent {
+		if len(exp.records) == 0 {
+			return codedErrorf(codeNXDomain, "expected an empty %s answer, the name does not exist (NXDOMAIN)", exp.typ)
+		}
+		return codedErrorf(codeNXDomain, "expected %d %s records, the name does not exist (NXDOMAIN)", len(exp.records), exp.typ)
+	}
+	if resp == nil || !classifiable(err) || code == codeTTLExceeded {
+		return err
+	}
+	if len(resp.Answer) == 0 && len(exp.records) > 0 {
+		err = codedErrorf(codeNoData, "expected %d %s records, the name exists without any (NODATA)", len(exp.records), exp.typ)
+	}
+	if exp.qclass() != dns.ClassINET {
+		return err
+	}
+	if parent, ok := c.wildcardAnswer(ns, domain, name, exp.typ, resp); ok {
+		return codedErrorf(codeWildcardMasked, "%v, the answer comes from a wildcard, as for any name under %s", err, parent)
+	}
+	return err
+}
+
+// checkNegativeTTL checks that resolvers cache an empty answer for no longer
+// than maxTTL: the TTL of the SOA record in the authority section, capped by
+// its minimum field (RFC 2308).
+func checkNegativeTTL(resp *dns.Msg, maxTTL int) error {
+	if maxTTL == 0 {
+		return nil
+	}
+	for _, rr := range resp.Ns {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+		ttl := soa.Hdr.Ttl
+		if soa.Minttl < ttl {
+			ttl = soa.Minttl
+		}
+		if ttl > uint32(maxTTL) {
+			return codedErrorf(codeNegativeTTLExceeded, "expected negative caching ttl %d, got %d (SOA ttl %d, minimum %d)", maxTTL, ttl, soa.Hdr.Ttl, soa.Minttl)
+		}
+		return nil
+	}
+	return codedErrorf(codeNegativeTTLExceeded, "no SOA record in the authority section, the negative caching ttl is up to the resolver")
+}
+
+// wildcardAnswer returns whether a name is answered the same as one that
+// can't exist next to it, in which case a wildcard answers for both rather
+// than records of the name. The domain itself is never covered by its own
+// wildcards.
+func (c *checker) wildcardAnswer(ns string, domain string, name string, typ string, resp *dns.Msg) (string, bool) {
+	if dns.CanonicalName(name) == dns.CanonicalName(domain) {
+		return "", false
+	}
+	parent := strings.SplitN(dns.Fqdn(name), ".", 2)[1]
+
+	c.mu.Lock()
+	probe, ok := c.probes[parent]
+	if !ok {
+		probe = randomLabel() + "." + parent
+		c.probes[parent] = probe
+	}
+	c.mu.Unlock()
+
+	e := c.lookup(ns, probe, typ)
+	if e.err != nil || e.resp.Rcode != dns.RcodeSuccess {
+		return "", false
+	}
+	return strings.TrimSuffix(parent, "."), sameAnswers(resp, e.resp)
+}
+
+// sameAnswers compares the records of two answers regardless of their names.
+func sameAnswers(a *dns.Msg, b *dns.Msg) bool {
+	values := func(m *dns.Msg) []string {
+		var out []string
+		for _, rr := range m.Answer {
+			out = append(out, dns.TypeToString[rr.Header().Rrtype]+" "+rrValue(rr))
+		}
+		sort.Strings(out)
+		return out
+	}
+	return strings.Join(values(a), "\n") == strings.Join(values(b), "\n")
+}
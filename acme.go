@@ -0,0 +1,232 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const acmeUsage = `Usage: control acme [flags] <hostname>...
+
+Checks that the _acme-challenge names of the hostnames can be validated by
+ACME DNS-01, e.g. before certificates are renewed:
+
+    control acme example.com www.example.com
+
+The CNAME chain of every challenge name is followed as Let's Encrypt
+resolves it: by asking the authoritative servers of each zone on the way,
+all of which must answer.
+
+Flags:
+`
+
+// Longest CNAME chain followed from a challenge name, as by resolvers
+const maxChallengeChain = 8
+
+// runACME implements the acme subcommand and returns the exit code.
+func runACME(args []string) int {
+	fs := flag.NewFlagSet("acme", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), acmeUsage)
+		fs.PrintDefaults()
+	}
+	resolvers := fs.String("ns", strings.Join(nss, ","), "comma-separated list of resolvers, the first of which looks up zones and their nameservers")
+	timeout := fs.Duration("timeout", 2*time.Second, "timeout for a single query")
+	retries := fs.Int("retries", 1, "number of times to retry a query over UDP on timeout")
+	fallback := fs.String("fallback", "tcp", "comma-separated transports to fall back to after UDP timeouts: tcp, tls, https")
+	iface := fs.String("interface", "", "network interface to send queries through")
+	useProfiles := fs.Bool("resolver-profiles", false, "query Google, Cloudflare and Quad9 public resolvers at their rates, retries and fallback transports, unless -retries or -fallback is given")
+	dumpResponses := fs.Bool("dump-responses", false, "print the full response of the failing server")
+
+	hosts, err := parseFlagsInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(hosts) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := runOptions{
+		resolvers: strings.Split(*resolvers, ","),
+		strategy:  strategyAll,
+		iface:     *iface,
+		timeout:   *timeout,
+		retries:   *retries,
+		fallback:  splitList(*fallback),
+
+		retryBudget:   defaultRetryBudget,
+		pipelineDepth: defaultPipelineDepth,
+		parallelism:   defaultParallelism,
+		rate:          defaultRate,
+
+		dumpResponses: *dumpResponses,
+	}
+	if *useProfiles {
+		opts.profiles = profilesUnlessSet(fs)
+	}
+	if err := opts.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	c := newChecker(opts)
+	if c.err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run checks: %v\n", c.err)
+		return 1
+	}
+
+	// A job per host, with a result per server its chain is checked on
+	byHost := make([][]checkResult, len(hosts))
+	var jobs []checkJob
+	for i, host := range hosts {
+		i, host, ns := i, strings.TrimSuffix(host, "."), opts.resolvers[0]
+		jobs = append(jobs, checkJob{
+			ns:     ns,
+			domain: host,
+			result: checkResult{Domain: host, NS: ns},
+			run: func(c *checker, r *checkResult) {
+				byHost[i] = c.checkChallenge(ns, host)
+			},
+			quiet: true,
+		})
+	}
+	runPass(c, jobs, opts)
+
+	res := &runResult{}
+	for _, results := range byHost {
+		res.Results = append(res.Results, results...)
+	}
+	printReport(os.Stdout, nil, res, opts.dumpResponses)
+	if len(res.failures()) > 0 {
+		return 1
+	}
+	fmt.Println("\nAll challenge names can be validated")
+	return 0
+}
+
+// checkChallenge follows the CNAME chain of the challenge name of the host
+// on the authoritative servers of every zone on the way, returning a result
+// per server asked. The chain may end at a name without records, as the
+// TXT record is only added during validation, but not one that doesn't
+// resolve. Wildcard hosts are validated at the challenge name of the base
+// name (RFC 8555, section 8.4).
+func (c *checker) checkChallenge(resolver string, host string) []checkResult {
+	var results []checkResult
+	name := "_acme-challenge." + strings.TrimPrefix(host, "*.") + "."
+	seen := map[string]bool{}
+	for {
+		if seen[strings.ToLower(name)] {
+			return append(results, checkResult{Domain: host, Name: strings.TrimSuffix(name, "."), Type: "CNAME", NS: resolver,
+				Err: codedErrorf(codeChallengeBroken, "CNAME loop at %s", strings.TrimSuffix(name, "."))})
+		}
+		if len(seen) == maxChallengeChain {
+			return append(results, checkResult{Domain: host, Name: strings.TrimSuffix(name, "."), Type: "CNAME", NS: resolver,
+				Err: codedErrorf(codeChallengeBroken, "CNAME chain longer than %d names", maxChallengeChain)})
+		}
+		seen[strings.ToLower(name)] = true
+
+		zone, err := c.zoneOf(resolver, name)
+		if err == nil {
+			var servers []authServer
+			if servers, err = c.authServers(resolver, zone); err == nil {
+				var target string
+				results, target = c.challengeHop(results, host, name, servers)
+				if target == "" {
+					return results
+				}
+				name = target
+				continue
+			}
+		}
+		return append(results, checkResult{Domain: host, Name: strings.TrimSuffix(name, "."), Type: "TXT", NS: resolver, Err: withCode(codeChallengeBroken, err)})
+	}
+}
+
+// challengeHop asks every server for the TXT records of the name, adding
+// their results, and returns the CNAME target of the name if they agree on
+// one, or "" if the chain ends here.
+func (c *checker) challengeHop(results []checkResult, host string, name string, servers []authServer) ([]checkResult, string) {
+	targets := make([]string, len(servers))
+	ok := true
+	for i, s := range servers {
+		resp, transport, err := c.challengeQuery(s.Addr, name)
+		for _, rr := range answerOf(resp) {
+			if cname, isCNAME := rr.(*dns.CNAME); isCNAME && strings.EqualFold(cname.Hdr.Name, name) {
+				targets[i] = cname.Target
+			}
+		}
+		if err == nil && i > 0 && !strings.EqualFold(targets[i], targets[0]) {
+			err = codedErrorf(codeValueMismatch, "%s answers %s, %s answers %s", s.Host, describeTarget(targets[i]), servers[0].Host, describeTarget(targets[0]))
+		}
+		results = append(results, checkResult{Domain: host, Name: strings.TrimSuffix(name, "."), Type: "TXT", NS: s.Addr, Err: err, Response: resp, Transport: transport})
+		ok = ok && err == nil
+	}
+	if !ok {
+		return results, ""
+	}
+	return results, targets[0]
+}
+
+func answerOf(resp *dns.Msg) []dns.RR {
+	if resp == nil {
+		return nil
+	}
+	return resp.Answer
+}
+
+func describeTarget(target string) string {
+	if target == "" {
+		return "no CNAME"
+	}
+	return "CNAME " + target
+}
+
+// challengeQuery asks an authoritative server for the TXT records of the
+// name without recursion. Unlike authoritativeQuery, names without records
+// or that don't exist pass.
+func (c *checker) challengeQuery(addr string, name string) (*dns.Msg, string, error) {
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(name), dns.TypeTXT)
+	m.RecursionDesired = false
+
+	resp, transport, err := c.transports.exchange(m, addr)
+	if err != nil {
+		return nil, transport, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return resp, transport, rcodeError(resp.Rcode)
+	}
+	if !resp.Authoritative {
+		for _, rr := range resp.Ns {
+			if ns, ok := rr.(*dns.NS); ok {
+				return resp, transport, codedErrorf(codeChallengeBroken, "referral to %s, whose nameservers don't resolve it", strings.TrimSuffix(ns.Hdr.Name, "."))
+			}
+		}
+		return resp, transport, codedErrorf(codeNotAuthoritative, "server is not authoritative for %s", name)
+	}
+	return resp, transport, nil
+}
+
+// zoneOf returns the zone of the name: the closest enclosing name with an
+// SOA record.
+func (c *checker) zoneOf(resolver string, name string) (string, error) {
+	for n := dns.Fqdn(name); ; {
+		resp, err := c.query(resolver, n, "SOA")
+		if err == nil || errorCode(err) == codeNXDomain {
+			for _, rr := range answerOf(resp) {
+				if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, n) {
+					return n, nil
+				}
+			}
+		}
+		i, end := dns.NextLabel(n, 0)
+		if end {
+			return "", fmt.Errorf("no zone of %s resolves", strings.TrimSuffix(name, "."))
+		}
+		n = n[i:]
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// actionInput returns the input of the GitHub Action, which the runner
+// passes as INPUT_<NAME> environment variables.
+func actionInput(name string) string {
+	return strings.TrimSpace(os.Getenv("INPUT_" + strings.ToUpper(name)))
+}
+
+// actionArgs translates the inputs of the GitHub Action into flags.
+func actionArgs(resultsPath string) []string {
+	args := []string{"-results-json", resultsPath}
+	for _, in := range []struct{ input, flag string }{
+		{"resolvers", "-ns"},
+		{"config", "-config"},
+		{"wait", "-wait"},
+		{"wait-interval", "-wait-interval"},
+	} {
+		if v := actionInput(in.input); v != "" {
+			args = append(args, in.flag, v)
+		}
+	}
+	return append(args, strings.Fields(actionInput("args"))...)
+}
+
+// appendFile appends to a file the runner reads after the step, such as
+// GITHUB_OUTPUT.
+func appendFile(path string, s string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runAction implements the github-action subcommand: it checks the records
+// in the file given as the input input, with the other inputs as flags, and
+// writes the outcome as step outputs. It returns the exit code of the check,
+// or 0 for failed checks if the fail input is false.
+func runAction(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Usage: control github-action (configured by INPUT_* environment variables)\n")
+		return 2
+	}
+
+	inputPath := actionInput("input")
+	if inputPath == "" {
+		fmt.Fprintf(os.Stderr, "input is required: a file with the output of dnscontrol print-ir\n")
+		return 2
+	}
+	in, err := os.Open(inputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open input: %v\n", err)
+		return 2
+	}
+	defer in.Close()
+
+	tmp := os.Getenv("RUNNER_TEMP")
+	if tmp == "" {
+		tmp = os.TempDir()
+	}
+	reportPath := actionInput("report")
+	if reportPath == "" {
+		reportPath = filepath.Join(tmp, "control-report.txt")
+	}
+	report, err := os.Create(reportPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create report: %v\n", err)
+		return 1
+	}
+	defer report.Close()
+	resultsPath := filepath.Join(tmp, "control-results.json")
+
+	// The checks run in a child process, as they exit as soon as they are
+	// done
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find executable: %v\n", err)
+		return 1
+	}
+	cmd := exec.Command(self, actionArgs(resultsPath)...)
+	cmd.Stdin = in
+	cmd.Stdout = io.MultiWriter(os.Stdout, report)
+	cmd.Stderr = io.MultiWriter(os.Stderr, report)
+	code := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintf(os.Stderr, "Failed to run checks: %v\n", err)
+			return 1
+		}
+		code = exitErr.ExitCode()
+	}
+
+	outputs := fmt.Sprintf("report=%s\n", reportPath)
+	if res, err := readResultsJSON(resultsPath); err == nil {
+		failed := len(res.failures())
+		outputs += fmt.Sprintf("propagated=%t\nchecks=%d\nfailed=%d\nresults=%s\n", failed == 0 && code == 0, len(res.Results), failed, resultsPath)
+	} else {
+		// Failed before running any checks
+		outputs += "propagated=false\n"
+	}
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		if err := appendFile(path, outputs); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write step outputs: %v\n", err)
+			return 1
+		}
+	} else {
+		fmt.Print(outputs)
+	}
+	if code == 1 && actionInput("fail") == "false" {
+		// The workflow decides by the outputs
+		return 0
+	}
+	return code
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Record types whose targets authoritative servers are expected to add
+// addresses for in the additional section (RFC 1035, section 3.3.9 and
+// RFC 2782)
+var additionalTypes = map[string]bool{
+	"MX":  true,
+	"SRV": true,
+}
+
+// expectedAdditional returns the addresses expected in the additional
+// section of answers for the record set: A and AAAA records of the domain for
+// each of its targets. Targets outside the domain have no expected addresses.
+func expectedAdditional(dom domain, records []record) map[string][]string {
+	addrs := map[string][]string{}
+	for _, r := range records {
+		target := dns.CanonicalName(r.Target)
+		for _, a := range dom.Records {
+			if a.Type != "A" && a.Type != "AAAA" {
+				continue
+			}
+			if dns.CanonicalName(absolutize(dom.Name, a.Name)) == target {
+				addrs[target] = append(addrs[target], a.Type+" "+a.Target)
+			}
+		}
+	}
+	for _, a := range addrs {
+		sort.Strings(a)
+	}
+	return addrs
+}
+
+func checkAdditional(resp *dns.Msg, expected map[string][]string) error {
+	actual := map[string][]string{}
+	for _, rr := range resp.Extra {
+		name := dns.CanonicalName(rr.Header().Name)
+		switch rr := rr.(type) {
+		case *dns.A:
+			actual[name] = append(actual[name], "A "+rr.A.String())
+		case *dns.AAAA:
+			actual[name] = append(actual[name], "AAAA "+rr.AAAA.String())
+		}
+	}
+
+	var missing []string
+	for target, addrs := range expected {
+		got := map[string]bool{}
+		for _, a := range actual[target] {
+			got[a] = true
+		}
+		for _, a := range addrs {
+			if !got[a] {
+				missing = append(missing, target+" "+a)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return codedErrorf(codeAdditionalMissing, "no %s in additional section", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// runAdditionalChecks queries MX and SRV record sets on the authoritative
+// servers of their domain and checks that the addresses of their targets
+// are included in the additional section, so that clients don't need
+// another round trip to look them up.
+func runAdditionalChecks(domains []domain, opts runOptions) []checkResult {
+	c := newChecker(opts)
+
+	groups := map[string][][]record{}
+	var zones []string
+	for _, dom := range domains {
+		for _, records := range groupRecords(dom.Records) {
+			if additionalTypes[records[0].Type] && len(expectedAdditional(dom, records)) > 0 {
+				groups[dom.Name] = append(groups[dom.Name], records)
+			}
+		}
+		if len(groups[dom.Name]) > 0 {
+			zones = append(zones, dom.Name)
+		}
+	}
+	servers, results := zoneAuthServers(c, opts.resolvers[0], zones, opts)
+
+	var jobs []checkJob
+	for _, dom := range domains {
+		for _, records := range groups[dom.Name] {
+			name, typ := absolutize(dom.Name, records[0].Name), records[0].Type
+			expected := expectedAdditional(dom, records)
+			for _, server := range servers[dom.Name] {
+				server := server
+				jobs = append(jobs, checkJob{
+					ns:     server.Addr,
+					domain: dom.Name,
+					result: checkResult{
+						Domain: dom.Name,
+						Name:   name,
+						Type:   typ,
+						NS:     fmt.Sprintf("authoritative %s (%s)", server.Host, server.Addr),
+					},
+					run: func(c *checker, r *checkResult) {
+						r.Response, r.Transport, r.Err = c.authoritativeQuery(server.Addr, name, typ)
+						if r.Err == nil {
+							r.Err = checkAdditional(r.Response, expected)
+						}
+					},
+				})
+			}
+		}
+	}
+	return append(results, runPass(c, jobs, opts)...)
+}
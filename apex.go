@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// apexCheck is a single check of -apex-checks. It is passed the records of
+// the queried types served at the apex.
+type apexCheck struct {
+	label string
+	// Type of the result, distinct for every check
+	typ   string
+	types []string
+	check func(answers map[string][]dns.RR) error
+}
+
+var apexChecks = []apexCheck{
+	{"apex address", "A", []string{"A", "AAAA"}, func(a map[string][]dns.RR) error {
+		if len(a["A"]) == 0 && len(a["AAAA"]) == 0 {
+			return codedErrorf(codeApexMissing, "no A or AAAA records, the bare domain does not resolve")
+		}
+		return nil
+	}},
+	{"NS records", "NS", []string{"NS"}, func(a map[string][]dns.RR) error {
+		if len(a["NS"]) == 0 {
+			return codedErrorf(codeApexMissing, "no NS records")
+		}
+		return nil
+	}},
+	{"SOA record", "SOA", []string{"SOA"}, func(a map[string][]dns.RR) error {
+		if len(a["SOA"]) != 1 {
+			return codedErrorf(codeApexMissing, "%d SOA records, expected one", len(a["SOA"]))
+		}
+		return nil
+	}},
+	{"CAA records", "CAA", []string{"CAA"}, func(a map[string][]dns.RR) error {
+		if len(a["CAA"]) == 0 {
+			return codedErrorf(codeApexMissing, "no CAA records, any certificate authority may issue for the domain")
+		}
+		return nil
+	}},
+	{"MX and SPF", "TXT", []string{"MX", "TXT"}, checkMailAlignment},
+}
+
+// checkMailAlignment checks that a domain receiving mail has a single SPF
+// record, without which mail it sends is likely rejected or marked as spam.
+// Domains only sending mail and those with a null MX (RFC 7505) need no MX.
+func checkMailAlignment(a map[string][]dns.RR) error {
+	var spf int
+	for _, rr := range a["TXT"] {
+		if v := strings.ToLower(rrValue(rr)); v == "v=spf1" || strings.HasPrefix(v, "v=spf1 ") {
+			spf++
+		}
+	}
+	if spf > 1 {
+		return codedErrorf(codeMailMisaligned, "%d SPF records, receivers treat this as an error (RFC 7208, section 4.5)", spf)
+	}
+	var mx int
+	for _, rr := range a["MX"] {
+		if rr.(*dns.MX).Mx != "." {
+			mx++
+		}
+	}
+	if mx > 0 && spf == 0 {
+		return codedErrorf(codeMailMisaligned, "MX records but no SPF record")
+	}
+	return nil
+}
+
+// runApexChecks screens the apex of every domain on the first resolver for
+// the records every zone is expected to have, regardless of the expected
+// records.
+func runApexChecks(domains []domain, opts runOptions) []checkResult {
+	c := newChecker(opts)
+	ns := opts.resolvers[0]
+
+	var results []checkResult
+	for _, dom := range domains {
+		for _, ac := range apexChecks {
+			cr := checkResult{Domain: dom.Name, Name: dom.Name, Type: ac.typ, NS: "apex at " + ns}
+			answers := map[string][]dns.RR{}
+			for _, typ := range ac.types {
+				resp, err := c.query(ns, dom.Name, typ)
+				if err != nil {
+					cr.Err = err
+					break
+				}
+				for _, rr := range resp.Answer {
+					if dns.TypeToString[rr.Header().Rrtype] == typ {
+						answers[typ] = append(answers[typ], rr)
+					}
+				}
+			}
+			if cr.Err == nil {
+				cr.Err = ac.check(answers)
+			}
+			printProgress(cr.Err)
+			results = append(results, cr)
+		}
+	}
+	return results
+}
+
+// printApexReport prints the outcome of every apex check, passed or not, per
+// domain.
+func printApexReport(w io.Writer, results []checkResult) {
+	fmt.Fprintf(w, "\nApex checks:\n")
+	for i, r := range results {
+		if i == 0 || results[i-1].Domain != r.Domain {
+			fmt.Fprintf(w, "  %s\n", r.Domain)
+		}
+		label := r.Type
+		for _, ac := range apexChecks {
+			if ac.typ == r.Type {
+				label = ac.label
+			}
+		}
+		if r.Err != nil {
+			fmt.Fprintf(w, "    FAIL %s: %s: %v\n", label, errorCode(r.Err), r.Err)
+		} else {
+			fmt.Fprintf(w, "    ok   %s\n", label)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Largest body of POST /check accepted
+const maxCheckRequestSize = 10 << 20
+
+// checkRequest is the body of POST /check. Either Domains (in DNSControl
+// print-ir format) or Zone (the name of a domain the daemon was started
+// with) must be given.
+type checkRequest struct {
+	Domains   []domain `json:"domains"`
+	Zone      string   `json:"zone"`
+	Resolvers []string `json:"resolvers"`
+}
+
+type checkResponse struct {
+	status
+	Results []resultJSON `json:"results"`
+}
+
+func newCheckResponse(res *runResult) checkResponse {
+	resp := checkResponse{status: newStatus(res), Results: []resultJSON{}}
+	for _, cr := range res.Results {
+		resp.Results = append(resp.Results, newResultJSON(cr))
+	}
+	return resp
+}
+
+func (d *daemon) domainsForRequest(req checkRequest) ([]domain, error) {
+	if req.Zone == "" {
+		if len(req.Domains) == 0 {
+			return nil, fmt.Errorf("either domains or zone must be specified")
+		}
+		return normalizeDomains(req.Domains)
+	}
+
+	if len(req.Domains) != 0 {
+		return nil, fmt.Errorf("domains and zone are mutually exclusive")
+	}
+	for _, dom := range d.settings().domains {
+		if dom.Name == req.Zone {
+			return []domain{dom}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown zone %s", req.Zone)
+}
+
+// requestOptions returns the options of the daemon for checks on demand on
+// the resolvers, which have to be ones the daemon checks on already: those of
+// the options or of the verify_resolvers meta fields of its domains. Those
+// of the domains requested are held to the same.
+func (d *daemon) requestOptions(resolvers []string, domains []domain) (runOptions, error) {
+	s := d.settings()
+	allowed := map[string]bool{}
+	for _, ns := range s.opts.resolvers {
+		allowed[ns] = true
+	}
+	for _, dom := range s.domains {
+		for _, ns := range splitList(dom.Meta[verifyResolversMeta]) {
+			allowed[ns] = true
+		}
+	}
+
+	requested := append([]string(nil), resolvers...)
+	for _, dom := range domains {
+		requested = append(requested, splitList(dom.Meta[verifyResolversMeta])...)
+	}
+	for _, ns := range requested {
+		if !allowed[ns] {
+			return runOptions{}, fmt.Errorf("resolver %s is not one the daemon checks on", ns)
+		}
+	}
+	return s.opts.withResolvers(resolvers), nil
+}
+
+func (d *daemon) handleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req checkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCheckRequestSize)).Decode(&req); err != nil {
+		code := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("failed to parse request: %v", err), code)
+		return
+	}
+	domains, err := d.domainsForRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := d.requestOptions(req.Resolvers, domains)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	res, err := runChecks(r.Context(), domains, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newCheckResponse(res))
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const atlasAPI = "https://atlas.ripe.net/api/v2"
+
+type atlasOptions struct {
+	key       string
+	countries []string
+	asns      []string
+	// Probes requested per country/AS
+	probes  int
+	timeout time.Duration
+}
+
+type atlasProbeSelector struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Requested int    `json:"requested"`
+}
+
+type atlasDefinition struct {
+	Type             string `json:"type"`
+	AF               int    `json:"af"`
+	Description      string `json:"description"`
+	QueryClass       string `json:"query_class"`
+	QueryType        string `json:"query_type"`
+	QueryArgument    string `json:"query_argument"`
+	UseProbeResolver bool   `json:"use_probe_resolver"`
+	SetRDBit         bool   `json:"set_rd_bit"`
+	Protocol         string `json:"protocol"`
+}
+
+type atlasMeasurementRequest struct {
+	Definitions []atlasDefinition    `json:"definitions"`
+	Probes      []atlasProbeSelector `json:"probes"`
+	IsOneoff    bool                 `json:"is_oneoff"`
+}
+
+type atlasDNSResult struct {
+	Abuf string `json:"abuf"`
+}
+
+type atlasResultSetEntry struct {
+	DstAddr string          `json:"dst_addr"`
+	Result  *atlasDNSResult `json:"result"`
+	Error   map[string]any  `json:"error"`
+}
+
+type atlasResult struct {
+	PrbID     int                   `json:"prb_id"`
+	ResultSet []atlasResultSetEntry `json:"resultset"`
+}
+
+func atlasRequest(ctx context.Context, key string, method string, path string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, atlasAPI+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Key "+key)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("RIPE Atlas %s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(respBody))
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (o atlasOptions) probeSelectors() []atlasProbeSelector {
+	var selectors []atlasProbeSelector
+	for _, cc := range o.countries {
+		selectors = append(selectors, atlasProbeSelector{Type: "country", Value: strings.ToUpper(cc), Requested: o.probes})
+	}
+	for _, asn := range o.asns {
+		selectors = append(selectors, atlasProbeSelector{Type: "asn", Value: strings.TrimPrefix(strings.ToUpper(asn), "AS"), Requested: o.probes})
+	}
+	if len(selectors) == 0 {
+		selectors = append(selectors, atlasProbeSelector{Type: "area", Value: "WW", Requested: o.probes})
+	}
+	return selectors
+}
+
+// Measurement status ids that will not produce any more results
+var atlasFinalStatuses = map[int]bool{4: true, 5: true, 6: true, 7: true, 8: true}
+
+func waitAtlasMeasurement(ctx context.Context, key string, id int) error {
+	for {
+		var m struct {
+			Status struct {
+				ID   int    `json:"id"`
+				Name string `json:"name"`
+			} `json:"status"`
+		}
+		if err := atlasRequest(ctx, key, http.MethodGet, fmt.Sprintf("/measurements/%d/?fields=status", id), nil, &m); err != nil {
+			return err
+		}
+		if atlasFinalStatuses[m.Status.ID] {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("measurement %d: %w", id, ctx.Err())
+		case <-time.After(15 * time.Second):
+		}
+	}
+}
+
+// atlasProbeLabels returns "atlas probe ID (CC, ASN)" labels for probe ids.
+func atlasProbeLabels(ctx context.Context, key string, ids []int) map[int]string {
+	labels := map[int]string{}
+	var idStrs []string
+	for _, id := range ids {
+		labels[id] = fmt.Sprintf("atlas probe %d", id)
+		idStrs = append(idStrs, strconv.Itoa(id))
+	}
+	if len(ids) == 0 {
+		return labels
+	}
+
+	var probes struct {
+		Results []struct {
+			ID          int    `json:"id"`
+			CountryCode string `json:"country_code"`
+			ASNv4       int    `json:"asn_v4"`
+		} `json:"results"`
+	}
+	path := "/probes/?fields=id,country_code,asn_v4&page_size=500&id__in=" + strings.Join(idStrs, ",")
+	if err := atlasRequest(ctx, key, http.MethodGet, path, nil, &probes); err != nil {
+		// Labels are cosmetic, keep going with bare probe ids
+		fmt.Fprintf(os.Stderr, "Failed to fetch RIPE Atlas probe details: %v\n", err)
+		return labels
+	}
+	for _, p := range probes.Results {
+		labels[p.ID] = fmt.Sprintf("atlas probe %d (%s, AS%d)", p.ID, p.CountryCode, p.ASNv4)
+	}
+	return labels
+}
+
+func verifyAtlasEntry(entry atlasResultSetEntry, exp expectation) (*dns.Msg, bool, error) {
+	if entry.Result == nil {
+		return nil, false, codedErrorf(codeNetwork, "probe resolver %s failed: %v", entry.DstAddr, entry.Error)
+	}
+	wire, err := base64.StdEncoding.DecodeString(entry.Result.Abuf)
+	if err != nil {
+		return nil, false, codedErrorf(codeExternalServiceFail, "failed to decode response: %w", err)
+	}
+	resp := &dns.Msg{}
+	if err := resp.Unpack(wire); err != nil {
+		return nil, false, codedErrorf(codeExternalServiceFail, "failed to parse response: %w", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return resp, false, rcodeError(resp.Rcode)
+	}
+	matchedOld, err := exp.verify(resp)
+	return resp, matchedOld, err
+}
+
+// runAtlasChecks measures every record set from RIPE Atlas probes, using the
+// probes' own resolvers, and checks the answers they got.
+func runAtlasChecks(ctx context.Context, domains []domain, opts atlasOptions) ([]checkResult, error) {
+	type group struct {
+		domain string
+		name   string
+		exp    expectation
+	}
+	var groups []group
+	req := atlasMeasurementRequest{Probes: opts.probeSelectors(), IsOneoff: true}
+	for _, dom := range domains {
+		for _, records := range groupRecords(dom.Records) {
+			if isRedirect(records[0].Type) {
+				continue
+			}
+			name := absolutize(dom.Name, records[0].Name)
+			groups = append(groups, group{domain: dom.Name, name: name, exp: dom.expectationFor(records, time.Now())})
+			req.Definitions = append(req.Definitions, atlasDefinition{
+				Type:             "dns",
+				AF:               4,
+				Description:      fmt.Sprintf("control: %s %s", records[0].Type, name),
+				QueryClass:       "IN",
+				QueryType:        records[0].Type,
+				QueryArgument:    dns.Fqdn(name),
+				UseProbeResolver: true,
+				SetRDBit:         true,
+				Protocol:         "UDP",
+			})
+		}
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	var created struct {
+		Measurements []int `json:"measurements"`
+	}
+	if err := atlasRequest(ctx, opts.key, http.MethodPost, "/measurements/", req, &created); err != nil {
+		return nil, err
+	}
+	if len(created.Measurements) != len(groups) {
+		return nil, fmt.Errorf("requested %d RIPE Atlas measurements, %d created", len(groups), len(created.Measurements))
+	}
+	fmt.Printf("\nCreated RIPE Atlas measurements %v, waiting for results\n", created.Measurements)
+
+	resultsByGroup := make([][]atlasResult, len(groups))
+	probeIDs := map[int]bool{}
+	for i, id := range created.Measurements {
+		if err := waitAtlasMeasurement(ctx, opts.key, id); err != nil {
+			return nil, err
+		}
+		if err := atlasRequest(ctx, opts.key, http.MethodGet, fmt.Sprintf("/measurements/%d/results/?format=json", id), nil, &resultsByGroup[i]); err != nil {
+			return nil, err
+		}
+		for _, r := range resultsByGroup[i] {
+			probeIDs[r.PrbID] = true
+		}
+	}
+
+	var ids []int
+	for id := range probeIDs {
+		ids = append(ids, id)
+	}
+	labels := atlasProbeLabels(ctx, opts.key, ids)
+
+	var results []checkResult
+	for i, g := range groups {
+		for _, r := range resultsByGroup[i] {
+			for _, entry := range r.ResultSet {
+				resp, matchedOld, err := verifyAtlasEntry(entry, g.exp)
+				cr := checkResult{
+					Domain:     g.domain,
+					Name:       g.name,
+					Type:       g.exp.typ,
+					NS:         labels[r.PrbID],
+					Err:        err,
+					Response:   resp,
+					MatchedOld: matchedOld,
+				}
+				printProgress(err)
+				results = append(results, cr)
+			}
+		}
+	}
+	return results, nil
+}
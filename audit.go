@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/time/rate"
+)
+
+// Queries sent to each resolver by -audit-path
+const auditQueries = 16
+
+// How long to keep listening after an answer for more of them, which only
+// an on-path injector racing the resolver sends
+const auditLinger = 200 * time.Millisecond
+
+// auditExchange is what came back for a single query of the audit.
+type auditExchange struct {
+	port    int
+	answers []*dns.Msg
+	// Source addresses of packets from anywhere but the resolver
+	strangers []string
+	err       error
+}
+
+// probeOutcome is the result of a single diagnostic check, passed if err is
+// nil.
+type probeOutcome struct {
+	name string
+	err  error
+}
+
+// listenUDP opens an unconnected UDP socket, through the interface if set,
+// so that answers from other addresses than the resolver are seen rather
+// than dropped by the kernel.
+func listenUDP(iface string) (net.PacketConn, error) {
+	var lc net.ListenConfig
+	addr := ":0"
+	if iface != "" {
+		d, err := interfaceDialer(iface, "udp")
+		if err != nil {
+			return nil, err
+		}
+		lc.Control = d.Control
+		if d.LocalAddr != nil {
+			addr = d.LocalAddr.String()
+		}
+	}
+	return lc.ListenPacket(context.Background(), "udp", addr)
+}
+
+// auditQuery sends the query from a socket of its own and collects
+// every packet arriving on it until the timeout, or shortly after the
+// first answer.
+func auditQuery(iface string, addr string, m *dns.Msg, timeout time.Duration) auditExchange {
+	var ex auditExchange
+	conn, err := listenUDP(iface)
+	if err != nil {
+		ex.err = err
+		return ex
+	}
+	defer conn.Close()
+	ex.port = conn.LocalAddr().(*net.UDPAddr).Port
+
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		ex.err = err
+		return ex
+	}
+	packed, err := m.Pack()
+	if err != nil {
+		ex.err = err
+		return ex
+	}
+	if _, err := conn.WriteTo(packed, raddr); err != nil {
+		ex.err = err
+		return ex
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			// Deadline reached
+			return ex
+		}
+		if f, ok := from.(*net.UDPAddr); !ok || !f.IP.Equal(raddr.IP) || f.Port != raddr.Port {
+			ex.strangers = append(ex.strangers, from.String())
+			continue
+		}
+		resp := &dns.Msg{}
+		if resp.Unpack(buf[:n]) != nil {
+			continue
+		}
+		ex.answers = append(ex.answers, resp)
+		if len(ex.answers) == 1 {
+			_ = conn.SetReadDeadline(time.Now().Add(auditLinger))
+		}
+	}
+}
+
+// auditResolver sends a batch of queries to the resolver at once, as fast as
+// its rate limiter allows, and returns the outcome of every check on the
+// answers.
+func auditResolver(opts runOptions, limiter *rate.Limiter, addr string, zone string) []probeOutcome {
+	exchanges := make([]auditExchange, auditQueries)
+	queries := make([]*dns.Msg, auditQueries)
+	var wg sync.WaitGroup
+	for i := range exchanges {
+		i := i
+		m := &dns.Msg{}
+		m.SetQuestion(randomizeCase(dns.Fqdn(zone)), dns.TypeSOA)
+		queries[i] = m
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = limiter.Wait(context.Background())
+			exchanges[i] = auditQuery(opts.iface, addr, m, opts.timeout)
+		}()
+	}
+	wg.Wait()
+
+	var answered, duplicated, mismatched int
+	var failed error
+	ports := map[int]bool{}
+	strangers := map[string]bool{}
+	for i, ex := range exchanges {
+		if ex.err != nil {
+			failed = ex.err
+			continue
+		}
+		ports[ex.port] = true
+		for _, s := range ex.strangers {
+			strangers[s] = true
+		}
+		if len(ex.answers) == 0 {
+			continue
+		}
+		answered++
+		if len(ex.answers) > 1 {
+			duplicated++
+		}
+		for _, resp := range ex.answers {
+			q := queries[i]
+			if resp.Id != q.Id || len(resp.Question) != 1 || resp.Question[0].Name != q.Question[0].Name || resp.Question[0].Qtype != q.Question[0].Qtype {
+				mismatched++
+				break
+			}
+		}
+	}
+	if failed != nil {
+		return []probeOutcome{{name: "sending queries", err: failed}}
+	}
+
+	outcome := func(name string, bad bool, format string, args ...any) probeOutcome {
+		o := probeOutcome{name: name}
+		if bad {
+			o.err = fmt.Errorf(format, args...)
+		}
+		return o
+	}
+	outcomes := []probeOutcome{
+		outcome(fmt.Sprintf("%d queries answered", auditQueries), answered < auditQueries, "%d unanswered", auditQueries-answered),
+	}
+	if answered == 0 && len(strangers) == 0 {
+		return outcomes
+	}
+	var from []string
+	for s := range strangers {
+		from = append(from, s)
+	}
+	sort.Strings(from)
+	return append(outcomes,
+		outcome("answers only from the resolver", len(from) > 0, "packets from %s, the path is likely intercepted", strings.Join(from, ", ")),
+		outcome("a single answer per query", duplicated > 0, "%d queries answered more than once, answers are likely injected", duplicated),
+		outcome("matching IDs and questions", mismatched > 0, "%d answers to other queries or with the question rewritten", mismatched),
+		outcome("distinct source ports", len(ports) < auditQueries, "%d ports for %d queries", len(ports), auditQueries),
+	)
+}
+
+// runPathAudit audits the path to every UDP resolver, querying the SOA of
+// the first domain, and returns whether nothing is wrong with any.
+func runPathAudit(domains []domain, opts runOptions) bool {
+	zone := "."
+	if len(domains) > 0 {
+		zone = domains[0].Name
+	}
+
+	limiters := newResolverLimiters(opts)
+	ok := true
+	for _, ns := range opts.resolvers {
+		fmt.Println(ns)
+		scheme, addr, err := resolverAddr(ns)
+		if err == nil && scheme != "" && scheme != transportUDP {
+			fmt.Println("  skipped, not over UDP")
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+			ok = false
+			continue
+		}
+		for _, o := range auditResolver(opts, limiters.get(ns), addr, zone) {
+			if o.err != nil {
+				fmt.Printf("  FAIL %s: %v\n", o.name, o.err)
+				ok = false
+			} else {
+				fmt.Printf("  ok   %s\n", o.name)
+			}
+		}
+	}
+	return ok
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+type authServer struct {
+	Host string // NS name
+	Addr string // host:port
+}
+
+// authServers looks up the authoritative servers of the zone via the
+// resolver, returning an entry per address of every NS.
+func (c *checker) authServers(resolver string, zone string) ([]authServer, error) {
+	resp, err := c.query(resolver, zone, "NS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up NS of %s: %w", zone, err)
+	}
+
+	var hosts []string
+	for _, rr := range resp.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			hosts = append(hosts, ns.Ns)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no NS records for %s", zone)
+	}
+	sort.Strings(hosts)
+
+	var servers []authServer
+	for _, host := range hosts {
+		addrs := c.hostAddrs(resolver, host)
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("failed to resolve nameserver %s", host)
+		}
+		for _, addr := range addrs {
+			servers = append(servers, authServer{Host: strings.TrimSuffix(host, "."), Addr: net.JoinHostPort(addr, "53")})
+		}
+	}
+	return servers, nil
+}
+
+// zoneAuthServers looks up the authoritative servers of the zones via the
+// resolver in a pass of its own, see runPass. It returns them by zone, and a
+// failed result for each zone whose servers could not be found.
+func zoneAuthServers(c *checker, resolver string, zones []string, opts runOptions) (map[string][]authServer, []checkResult) {
+	found := make([][]authServer, len(zones))
+	var jobs []checkJob
+	for i, zone := range zones {
+		i, zone := i, zone
+		jobs = append(jobs, checkJob{
+			ns:     resolver,
+			domain: zone,
+			result: checkResult{Domain: zone, Name: zone, Type: "NS", NS: resolver},
+			quiet:  true,
+			run: func(c *checker, r *checkResult) {
+				found[i], r.Err = c.authServers(resolver, zone)
+			},
+		})
+	}
+
+	servers := map[string][]authServer{}
+	var failed []checkResult
+	for i, r := range runPass(c, jobs, opts) {
+		if r.Err != nil {
+			failed = append(failed, r)
+			continue
+		}
+		servers[zones[i]] = found[i]
+	}
+	return servers, failed
+}
+
+// hostAddrs returns the IPv4 and IPv6 addresses of the host, skipping the
+// types that fail to resolve.
+func (c *checker) hostAddrs(resolver string, host string) []string {
+	var addrs []string
+	for _, typ := range []string{"A", "AAAA"} {
+		resp, err := c.query(resolver, host, typ)
+		if err != nil {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			switch a := rr.(type) {
+			case *dns.A:
+				addrs = append(addrs, a.A.String())
+			case *dns.AAAA:
+				addrs = append(addrs, a.AAAA.String())
+			}
+		}
+	}
+	return addrs
+}
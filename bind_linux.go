@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// interfaceDialer returns a dialer for "udp" or "tcp" network sending packets
+// through the interface regardless of the routing table.
+func interfaceDialer(iface string, network string) (*net.Dialer, error) {
+	if _, err := net.InterfaceByName(iface); err != nil {
+		return nil, err
+	}
+
+	return &net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}, nil
+}
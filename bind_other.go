@@ -0,0 +1,43 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// interfaceDialer returns a dialer for "udp" or "tcp" network using an
+// address of the interface as the source address. Without SO_BINDTODEVICE
+// the routing table still decides where packets go, which is enough for
+// policy routing and most VPNs.
+func interfaceDialer(iface string, network string) (*net.Dialer, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var ip net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		// Prefer IPv4, as most resolvers are specified by IPv4 addresses
+		if ip == nil || (ip.To4() == nil && ipNet.IP.To4() != nil) {
+			ip = ipNet.IP
+		}
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("interface %s has no usable addresses", iface)
+	}
+
+	if network == "tcp" {
+		return &net.Dialer{LocalAddr: &net.TCPAddr{IP: ip}}, nil
+	}
+	return &net.Dialer{LocalAddr: &net.UDPAddr{IP: ip}}, nil
+}
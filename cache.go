@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// verifiedEntry describes a record set that passed on every resolver it was
+// checked on.
+type verifiedEntry struct {
+	// Hash of the expected records, to detect changes to the definition
+	Hash     string    `json:"hash"`
+	Verified time.Time `json:"verified"`
+	// Lowest TTL observed on each resolver
+	ObservedTTLs map[string]uint32 `json:"observed_ttls"`
+}
+
+// verifiedOn tells whether the record set passed on the resolvers a run with
+// the options checks it on: all of them, or any one with round-robin, which
+// checks it on a single resolver that changes as record sets are skipped.
+func (e verifiedEntry) verifiedOn(opts runOptions) bool {
+	if opts.strategy == strategyRoundRobin {
+		for _, ns := range opts.resolvers {
+			if _, ok := e.ObservedTTLs[ns]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	for _, ns := range opts.resolvers {
+		if _, ok := e.ObservedTTLs[ns]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// verifiedCache is persisted between runs, keyed by domain, absolute name
+// type and class of the record set.
+type verifiedCache struct {
+	Entries map[string]verifiedEntry `json:"entries"`
+}
+
+// verifiedCacheKey returns the key of the record set, with the class as in
+// results, only if it is not IN.
+func verifiedCacheKey(domain string, name string, typ string, class string) string {
+	if class == "" {
+		return domain + " " + name + " " + typ
+	}
+	return domain + " " + name + " " + typ + " " + class
+}
+
+func recordsHash(records []record) string {
+	var encoded []string
+	for _, r := range records {
+		b, _ := json.Marshal(r)
+		encoded = append(encoded, string(b))
+	}
+	sort.Strings(encoded)
+
+	h := sha256.New()
+	for _, e := range encoded {
+		h.Write([]byte(e))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func loadVerifiedCache(path string) (*verifiedCache, error) {
+	c := &verifiedCache{Entries: map[string]verifiedEntry{}}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	if c.Entries == nil {
+		c.Entries = map[string]verifiedEntry{}
+	}
+	return c, nil
+}
+
+func (c *verifiedCache) save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// writeFileAtomic replaces the file, so that readers see either the old or
+// the new contents.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// changed returns the domains with only the record sets that changed since
+// they were last verified on the resolvers they are checked on, see
+// verifiedOn, and the number of record sets skipped.
+func (c *verifiedCache) changed(domains []domain, opts runOptions) ([]domain, int) {
+	var out []domain
+	var skipped int
+
+	for _, dom := range domains {
+		// Empty answers (NoData, Deleted) are not cached and always checked
+		changedDom := dom
+		changedDom.Records = nil
+		domainOpts := opts.forDomain(dom)
+		for _, records := range groupRecords(dom.Records) {
+			key := verifiedCacheKey(dom.Name, absolutize(dom.Name, records[0].Name), records[0].Type, classLabel(recordClass(records[0].Class)))
+			if e, ok := c.Entries[key]; ok && e.Hash == recordsHash(records) && e.verifiedOn(domainOpts) {
+				skipped++
+				continue
+			}
+			changedDom.Records = append(changedDom.Records, records...)
+		}
+		if changedDom.hasChecks() {
+			out = append(out, changedDom)
+		}
+	}
+	return out, skipped
+}
+
+// update records the record sets that passed on every resolver they were
+// checked on and forgets
+// the ones that failed or still had old values anywhere.
+func (c *verifiedCache) update(domains []domain, res *runResult) {
+	failed := map[string]bool{}
+	observed := map[string]map[string]uint32{}
+	for _, r := range res.Results {
+		key := verifiedCacheKey(r.Domain, r.Name, r.Type, r.Class)
+		if r.Err != nil || r.MatchedOld {
+			failed[key] = true
+			continue
+		}
+		if observed[key] == nil {
+			observed[key] = map[string]uint32{}
+		}
+		if r.Response != nil {
+			for _, rr := range r.Response.Answer {
+				if ttl, ok := observed[key][r.NS]; !ok || rr.Header().Ttl < ttl {
+					observed[key][r.NS] = rr.Header().Ttl
+				}
+			}
+		}
+	}
+
+	for _, dom := range domains {
+		for _, records := range groupRecords(dom.Records) {
+			key := verifiedCacheKey(dom.Name, absolutize(dom.Name, records[0].Name), records[0].Type, classLabel(recordClass(records[0].Class)))
+			if failed[key] || observed[key] == nil {
+				delete(c.Entries, key)
+				continue
+			}
+			c.Entries[key] = verifiedEntry{
+				Hash:         recordsHash(records),
+				Verified:     res.Finished,
+				ObservedTTLs: observed[key],
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type queryKey struct {
+	ns        string
+	name      string
+	queryType string
+	class     uint16
+}
+
+type queryEntry struct {
+	done chan struct{}
+	resp *dns.Msg
+	exchangeInfo
+	err error
+	// When the query was sent and how long it took to be answered,
+	// including retries
+	sent time.Time
+	took time.Duration
+}
+
+type idEntry struct {
+	done chan struct{}
+	id   string
+}
+
+// checker holds the state shared by all checks of a single run.
+type checker struct {
+	transports *transports
+	// Set if transports could not be set up, returned from every query
+	err error
+	// Identify resolver instances answering each check
+	nsid bool
+	// Flags answers must have
+	requireFlags []string
+	// Answers to sample of address sets
+	samples int
+	// Size answers are reported close to or over, see packetAnomalies
+	maxAnswerSize int
+
+	mu      sync.Mutex
+	queries map[queryKey]*queryEntry
+	ids     map[string]*idEntry // by resolver, from CHAOS queries
+	// Nonexistent names queried for wildcards, by parent name
+	probes map[string]string
+}
+
+func newChecker(opts runOptions) *checker {
+	c := &checker{
+		queries: map[queryKey]*queryEntry{},
+		ids:     map[string]*idEntry{},
+		probes:  map[string]string{},
+		nsid:    opts.nsid,
+
+		requireFlags: opts.requireFlags,
+		samples:      opts.samples,
+
+		maxAnswerSize: opts.maxAnswerSize,
+	}
+	c.transports, c.err = newTransports(opts)
+	return c
+}
+
+func (c *checker) query(ns string, name string, queryType string) (*dns.Msg, error) {
+	e := c.lookup(ns, name, queryType)
+	return e.resp, e.err
+}
+
+// lookup sends the question to the resolver, unless it has already been sent
+// during this run, in which case the first response is returned. Concurrent
+// identical queries wait for the one in flight.
+//
+// Responses are shared between callers and must not be modified.
+func (c *checker) lookup(ns string, name string, queryType string) *queryEntry {
+	return c.lookupClass(ns, name, queryType, dns.ClassINET)
+}
+
+// lookupClass is lookup of a question of the class.
+func (c *checker) lookupClass(ns string, name string, queryType string, class uint16) *queryEntry {
+	key := queryKey{ns: ns, name: dns.CanonicalName(name), queryType: queryType, class: class}
+
+	c.mu.Lock()
+	e, ok := c.queries[key]
+	if !ok {
+		e = &queryEntry{done: make(chan struct{})}
+		c.queries[key] = e
+	}
+	c.mu.Unlock()
+
+	if ok {
+		<-e.done
+		return e
+	}
+
+	if c.err != nil {
+		e.err = c.err
+	} else {
+		e.sent = time.Now()
+		e.resp, e.exchangeInfo, e.err = query(c.transports, ns, name, queryType, class)
+		e.took = time.Since(e.sent)
+	}
+	close(e.done)
+	return e
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const checkOneUsage = `Usage: control check-one [flags] <domain> <type> <name> <value>...
+
+Checks a single record set, e.g.
+
+    control check-one example.com A www 192.0.2.1 -ns 9.9.9.9:53
+    control check-one example.com MX @ "10 mail.example.com."
+
+Values are given as in zone files: "<preference> <host>" for MX,
+"<priority> <weight> <port> <target>" for SRV, "<tag> <value>" for CAA,
+the text for TXT (one string).
+
+Flags:
+`
+
+// parseFlagsInterspersed parses flags given before, after or between the
+// positional arguments, and returns the positional ones.
+func parseFlagsInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// parseRecordValue fills in the type-specific fields of an expected record
+// from a zone file-like value.
+func parseRecordValue(r *record, value string) error {
+	switch r.Type {
+	case "A", "AAAA":
+		ip := net.ParseIP(value)
+		if ip == nil || (r.Type == "A") != (ip.To4() != nil) {
+			return fmt.Errorf("invalid %s value %q", r.Type, value)
+		}
+		r.Target = ip.String()
+	case "CNAME":
+		r.Target = dns.Fqdn(value)
+	case "MX":
+		fields := strings.Fields(value)
+		if len(fields) != 2 {
+			return fmt.Errorf("MX value must be \"<preference> <host>\", got %q", value)
+		}
+		pref, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid MX preference %q", fields[0])
+		}
+		r.MXPreference, r.Target = int(pref), dns.Fqdn(fields[1])
+	case "SRV":
+		fields := strings.Fields(value)
+		if len(fields) != 4 {
+			return fmt.Errorf("SRV value must be \"<priority> <weight> <port> <target>\", got %q", value)
+		}
+		var nums [3]int
+		for i, name := range []string{"priority", "weight", "port"} {
+			n, err := strconv.ParseUint(fields[i], 10, 16)
+			if err != nil {
+				return fmt.Errorf("invalid SRV %s %q", name, fields[i])
+			}
+			nums[i] = int(n)
+		}
+		r.SRVPriority, r.SRVWeight, r.SRVPort, r.Target = nums[0], nums[1], nums[2], dns.Fqdn(fields[3])
+	case "CAA":
+		fields := strings.Fields(value)
+		// Flags are optional, as they are not checked
+		if len(fields) == 3 {
+			fields = fields[1:]
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("CAA value must be \"<tag> <value>\", got %q", value)
+		}
+		r.CAATag, r.Target = fields[0], strings.Trim(fields[1], `"`)
+	case "TXT":
+		r.TXTStrings = []string{value}
+	default:
+		return fmt.Errorf("unsupported record type %s", r.Type)
+	}
+	return nil
+}
+
+// runCheckOne implements the check-one subcommand and returns the exit code.
+func runCheckOne(args []string) int {
+	fs := flag.NewFlagSet("check-one", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), checkOneUsage)
+		fs.PrintDefaults()
+	}
+	resolvers := fs.String("ns", strings.Join(nss, ","), "comma-separated list of resolvers to check the record on")
+	ttl := fs.Int("ttl", 0, "maximal expected TTL (default: not checked)")
+	class := fs.String("class", "IN", "class of the record set: IN, CH, e.g. for TXT version.bind, or HS")
+	timeout := fs.Duration("timeout", 2*time.Second, "timeout for a single query")
+	retries := fs.Int("retries", 1, "number of times to retry a query over UDP on timeout")
+	fallback := fs.String("fallback", "tcp", "comma-separated transports to fall back to after UDP timeouts: tcp, tls, https")
+	iface := fs.String("interface", "", "network interface to send queries through")
+	useProfiles := fs.Bool("resolver-profiles", false, "query Google, Cloudflare and Quad9 public resolvers at their rates, retries and fallback transports, unless -retries or -fallback is given")
+	maxAnswerSize := fs.Int("max-answer-size", defaultMaxAnswerSize, "report answers over or close to this size in bytes, not at all if 0")
+	dumpResponses := fs.Bool("dump-responses", false, "print the full response of the failing resolver")
+
+	positional, err := parseFlagsInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) < 4 {
+		fs.Usage()
+		return 2
+	}
+
+	dom := domain{Name: strings.TrimSuffix(positional[0], ".")}
+	typ := strings.ToUpper(positional[1])
+	name := relativeName(dom.Name, positional[2])
+
+	maxTTL := *ttl
+	if maxTTL == 0 {
+		maxTTL = math.MaxInt32
+	}
+	for _, value := range positional[3:] {
+		r := record{Type: typ, Name: name, TTL: maxTTL, Class: *class}
+		if err := parseRecordValue(&r, value); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+		if problem := classProblem(r.Class); problem != "" {
+			fmt.Fprintf(os.Stderr, "%s\n", problem)
+			return 2
+		}
+		dom.Records = append(dom.Records, r)
+	}
+
+	opts := runOptions{
+		resolvers: strings.Split(*resolvers, ","),
+		strategy:  strategyAll,
+		iface:     *iface,
+		timeout:   *timeout,
+		retries:   *retries,
+		fallback:  splitList(*fallback),
+
+		retryBudget:   defaultRetryBudget,
+		pipelineDepth: defaultPipelineDepth,
+		parallelism:   defaultParallelism,
+		rate:          defaultRate,
+
+		dumpResponses: *dumpResponses,
+		maxAnswerSize: *maxAnswerSize,
+	}
+	if *useProfiles {
+		opts.profiles = profilesUnlessSet(fs)
+	}
+	if err := opts.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	res, err := runChecks(context.Background(), []domain{dom}, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run checks: %v\n", err)
+		return 1
+	}
+	printReport(os.Stdout, []domain{dom}, res, opts.dumpResponses)
+	printPacketAnomalies(os.Stdout, res)
+	if len(res.failures()) > 0 {
+		return 1
+	}
+	fmt.Println("\nAll checks passed")
+	return 0
+}
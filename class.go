@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// classProblem returns what is wrong with the class of a record, "" if
+// nothing. Classes other than IN are mostly for CHAOS queries of server
+// identities, e.g. TXT version.bind in CH.
+func classProblem(class string) string {
+	switch strings.ToUpper(class) {
+	case "", "IN", "CH", "HS":
+		return ""
+	}
+	return fmt.Sprintf("unknown class %q, expected IN, CH or HS", class)
+}
+
+// recordClass returns the DNS class of records given as in the input, IN if
+// empty.
+func recordClass(class string) uint16 {
+	if class == "" {
+		return dns.ClassINET
+	}
+	return dns.StringToClass[strings.ToUpper(class)]
+}
+
+// classLabel returns the class as shown in results, "" for IN.
+func classLabel(class uint16) string {
+	if class == dns.ClassINET || class == 0 {
+		return ""
+	}
+	return dns.ClassToString[class]
+}
+
+// typeLabel returns the type of the result as shown in reports, with the
+// class unless it is IN.
+func typeLabel(r checkResult) string {
+	if r.Class == "" {
+		return r.Type
+	}
+	return r.Class + " " + r.Type
+}
+
+// keyTypeLabel is typeLabel for the record set or check of the key.
+func keyTypeLabel(k resultKey) string {
+	return typeLabel(checkResult{Type: k.Type, Class: k.Class})
+}
+
+// hasINET returns whether any of the checks of the domain are of the IN
+// class, the only one it is delegated in.
+func (d domain) hasINET() bool {
+	for _, r := range d.Records {
+		if recordClass(r.Class) == dns.ClassINET {
+			return true
+		}
+	}
+	return len(d.NoData) > 0 || len(d.Deleted) > 0 || len(d.Migrations) > 0 || len(d.Geo) > 0
+}
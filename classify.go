@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Causes of failures on recursive resolvers, found by asking an
+// authoritative server
+const (
+	// The zone is correct, resolvers have yet to pick it up
+	causeStaleCache = "stale cache"
+	// The zone itself serves records other than the expected ones
+	causeZoneWrong = "zone is wrong"
+)
+
+// classifiable returns whether the failure is about the answer rather than
+// getting one, so that the authoritative answer tells which side is wrong.
+func classifiable(err error) bool {
+	switch errorCode(err) {
+	case codeCountMismatch, codeValueMismatch, codeTypeMismatch, codeTTLExceeded, codeNXDomain,
+		codeNoData, codeWildcardMasked:
+		return true
+	}
+	return false
+}
+
+// classifyFailures queries every record set that failed on a resolver on one
+// of the authoritative servers of its domain, and sets the cause of the
+// failures: a stale cache if the server serves the expected records, the
+// zone being wrong otherwise. Failures are left unclassified if no
+// authoritative server answers. The queries are run as a pass, see runPass.
+func classifyFailures(domains []domain, res *runResult, opts runOptions) {
+	failed := map[resultKey][]int{}
+	for i, r := range res.Results {
+		// Authoritative servers are only known for IN
+		if r.Err != nil && !r.Outvoted && classifiable(r.Err) && !isRedirect(r.Type) && r.Class == "" {
+			key := setKey(r)
+			failed[key] = append(failed[key], i)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	type failedSet struct {
+		domain  string
+		name    string
+		exp     expectation
+		indexes []int
+	}
+	var sets []failedSet
+	var zones []string
+	for _, dom := range domains {
+		n := len(sets)
+		for _, exp := range dom.expectations(res.Started, opts.proxied) {
+			name := absolutize(dom.Name, exp.name)
+			indexes := failed[resultKey{Domain: dom.Name, Name: name, Type: strings.ToUpper(exp.typ), Class: classLabel(exp.qclass())}]
+			if len(indexes) > 0 {
+				sets = append(sets, failedSet{domain: dom.Name, name: name, exp: exp, indexes: indexes})
+			}
+		}
+		if len(sets) > n {
+			zones = append(zones, dom.Name)
+		}
+	}
+
+	c := newChecker(opts)
+	servers, _ := zoneAuthServers(c, opts.resolvers[0], zones, opts)
+	var jobs []checkJob
+	var classified [][]int
+	for _, set := range sets {
+		if len(servers[set.domain]) == 0 {
+			continue
+		}
+		addr, name, exp := servers[set.domain][0].Addr, set.name, set.exp
+		jobs = append(jobs, checkJob{
+			ns:     addr,
+			domain: set.domain,
+			result: checkResult{Domain: set.domain, Name: name, Type: exp.typ, NS: addr},
+			quiet:  true,
+			run: func(c *checker, r *checkResult) {
+				r.Cause, _ = c.authoritativeCause(addr, name, exp)
+			},
+		})
+		classified = append(classified, set.indexes)
+	}
+	for n, r := range runPass(c, jobs, opts) {
+		if r.Cause == "" {
+			continue
+		}
+		for _, i := range classified[n] {
+			res.Results[i].Cause = r.Cause
+		}
+	}
+}
+
+// authoritativeCause compares the answer of the authoritative server with
+// the expectation, returning false if the server does not answer.
+func (c *checker) authoritativeCause(addr string, name string, exp expectation) (string, bool) {
+	resp, _, err := c.authoritativeQuery(addr, name, exp.typ)
+	switch {
+	case err == nil || (resp != nil && resp.Rcode == dns.RcodeSuccess && resp.Authoritative):
+		// An empty answer is fine if one is expected
+		if _, err := exp.verify(resp); err != nil {
+			return causeZoneWrong, true
+		}
+		return causeStaleCache, true
+	case errorCode(err) == codeNXDomain:
+		if exp.absent {
+			return causeStaleCache, true
+		}
+		return causeZoneWrong, true
+	}
+	return "", false
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var cloudflareEndpoint = "https://api.cloudflare.com/client/v4"
+
+// Record metadata DNSControl sets for Cloudflare proxied records
+const cloudflareProxyMeta = "cloudflare_proxy"
+
+// proxied returns whether DNSControl configured the record to be served
+// through the Cloudflare proxy.
+func (r record) proxied() bool {
+	switch r.Meta[cloudflareProxyMeta] {
+	case "on", "full":
+		return true
+	}
+	return false
+}
+
+// cloudflare reads zones via the Cloudflare API with the token from
+// CLOUDFLARE_API_TOKEN.
+type cloudflare struct {
+	token  string
+	client *http.Client
+}
+
+func newCloudflare() (*cloudflare, error) {
+	c := &cloudflare{
+		token:  os.Getenv("CLOUDFLARE_API_TOKEN"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	if c.token == "" {
+		return nil, fmt.Errorf("-cloudflare requires CLOUDFLARE_API_TOKEN")
+	}
+	return c, nil
+}
+
+func (c *cloudflare) name() string {
+	return "Cloudflare"
+}
+
+// cloudflareResponse is the envelope of every Cloudflare API response.
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo struct {
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+func (c *cloudflare) get(ctx context.Context, path string, query url.Values, out any) (*cloudflareResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cloudflareEndpoint+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var r cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("Cloudflare %s: %s", path, resp.Status)
+	}
+	if !r.Success || resp.StatusCode != http.StatusOK {
+		var msgs []string
+		for _, e := range r.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		if len(msgs) > 0 {
+			return nil, fmt.Errorf("Cloudflare %s: %s: %s", path, resp.Status, strings.Join(msgs, "; "))
+		}
+		return nil, fmt.Errorf("Cloudflare %s: %s", path, resp.Status)
+	}
+	if err := json.Unmarshal(r.Result, out); err != nil {
+		return nil, fmt.Errorf("failed to parse Cloudflare %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// zoneID returns the ID of the zone.
+func (c *cloudflare) zoneID(ctx context.Context, zone string) (string, error) {
+	var zones []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if _, err := c.get(ctx, "/zones", url.Values{"name": {strings.TrimSuffix(zone, ".")}}, &zones); err != nil {
+		return "", err
+	}
+	for _, z := range zones {
+		if dns.CanonicalName(z.Name) == dns.CanonicalName(zone) {
+			return z.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no zone %s in Cloudflare", zone)
+}
+
+type cloudflareRecord struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Content  string `json:"content"`
+	TTL      uint32 `json:"ttl"`
+	Proxied  bool   `json:"proxied"`
+	Priority uint16 `json:"priority"`
+	Data     struct {
+		Flags uint8  `json:"flags"`
+		Tag   string `json:"tag"`
+		Value string `json:"value"`
+	} `json:"data"`
+}
+
+// rdata returns the record data in zone file format.
+func (r cloudflareRecord) rdata() string {
+	switch r.Type {
+	// The content of SRV records is their weight, port and target
+	case "MX", "SRV":
+		return fmt.Sprintf("%d %s", r.Priority, r.Content)
+	case "TXT":
+		if strings.HasPrefix(r.Content, `"`) {
+			return r.Content
+		}
+		return strconv.Quote(r.Content)
+	case "CAA":
+		return fmt.Sprintf("%d %s %s", r.Data.Flags, r.Data.Tag, strconv.Quote(r.Data.Value))
+	}
+	return r.Content
+}
+
+func (c *cloudflare) records(ctx context.Context, zone string) (map[string]*providerRecordSet, error) {
+	id, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := map[string]*providerRecordSet{}
+	for page := 1; ; page++ {
+		var records []cloudflareRecord
+		path := "/zones/" + id + "/dns_records"
+		resp, err := c.get(ctx, path, url.Values{"per_page": {"100"}, "page": {strconv.Itoa(page)}}, &records)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range records {
+			key := providerKey(r.Name, r.Type)
+			set, ok := sets[key]
+			if !ok {
+				set = &providerRecordSet{}
+				sets[key] = set
+			}
+			// TTL 1 stands for automatic, which is what proxied records
+			// always have
+			if r.TTL == 1 {
+				set.autoTTL = true
+			}
+			if r.Proxied {
+				set.proxied = true
+			}
+			rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(r.Name), r.TTL, r.Type, r.rdata()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s %s record from Cloudflare: %w", r.Name, r.Type, err)
+			}
+			set.rrs = append(set.rrs, rr)
+		}
+
+		if page >= resp.ResultInfo.TotalPages {
+			return sets, nil
+		}
+	}
+}
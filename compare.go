@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// compareOptions relax how the served records of a type are compared with
+// the expected ones.
+type compareOptions struct {
+	// Accept MX records with any preference
+	IgnorePreference bool `json:"ignore_preference"`
+	// Compare TXT strings and CNAME and MX targets regardless of case
+	CaseInsensitive bool `json:"case_insensitive"`
+	// Accept addresses written in any notation, e.g. expanded IPv6 ones
+	CanonicalAddresses bool `json:"canonical_addresses"`
+	// Require TXT values split into the same strings, rather than only the
+	// same concatenated value
+	StrictChunks bool `json:"strict_chunks"`
+}
+
+// quoteChunks returns the strings of a TXT record as a single one, quoted
+// the way zone files do, so that values only match if the strings do.
+func quoteChunks(strs []string) []string {
+	quoted := make([]string, len(strs))
+	for i, s := range strs {
+		quoted[i] = strconv.Quote(s)
+	}
+	return []string{strings.Join(quoted, " ")}
+}
+
+func (o compareOptions) validate(typ string) error {
+	if o.IgnorePreference && typ != "MX" {
+		return fmt.Errorf("ignore_preference does not apply to %s records", typ)
+	}
+	if o.CaseInsensitive && typ != "TXT" && typ != "CNAME" && typ != "MX" {
+		return fmt.Errorf("case_insensitive does not apply to %s records", typ)
+	}
+	if o.CanonicalAddresses && typ != "A" && typ != "AAAA" {
+		return fmt.Errorf("canonical_addresses does not apply to %s records", typ)
+	}
+	if o.StrictChunks && typ != "TXT" {
+		return fmt.Errorf("strict_chunks does not apply to %s records", typ)
+	}
+	return nil
+}
+
+// records returns the expected records with what the options ignore
+// removed.
+func (o compareOptions) records(records []record) []record {
+	if o == (compareOptions{}) {
+		return records
+	}
+	out := make([]record, len(records))
+	for i, r := range records {
+		if o.IgnorePreference {
+			r.MXPreference = 0
+		}
+		if o.CaseInsensitive {
+			r.Target = strings.ToLower(r.Target)
+			strs := make([]string, len(r.TXTStrings))
+			for j, s := range r.TXTStrings {
+				strs[j] = strings.ToLower(s)
+			}
+			r.TXTStrings = strs
+		}
+		if o.StrictChunks {
+			r.TXTStrings = quoteChunks(r.TXTStrings)
+		}
+		if ip := net.ParseIP(r.Target); o.CanonicalAddresses && ip != nil {
+			r.Target = ip.String()
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// answer returns a copy of the response with what the options ignore
+// removed, or the response itself if nothing is. Served addresses are
+// already in canonical notation.
+func (o compareOptions) answer(resp *dns.Msg) *dns.Msg {
+	if !o.IgnorePreference && !o.CaseInsensitive && !o.StrictChunks {
+		return resp
+	}
+	out := resp.Copy()
+	for _, rr := range out.Answer {
+		switch rr := rr.(type) {
+		case *dns.MX:
+			if o.IgnorePreference {
+				rr.Preference = 0
+			}
+			if o.CaseInsensitive {
+				rr.Mx = strings.ToLower(rr.Mx)
+			}
+		case *dns.CNAME:
+			if o.CaseInsensitive {
+				rr.Target = strings.ToLower(rr.Target)
+			}
+		case *dns.TXT:
+			if o.CaseInsensitive {
+				for i, s := range rr.Txt {
+					rr.Txt[i] = strings.ToLower(s)
+				}
+			}
+			if o.StrictChunks {
+				rr.Txt = quoteChunks(rr.Txt)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// duration is a time.Duration read from JSON as a string like "1m30s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// queryOverride replaces query settings for records of a given type, and
+// relaxes how they are compared.
+type queryOverride struct {
+	Timeout *duration      `json:"timeout"`
+	Retries *int           `json:"retries"`
+	Compare compareOptions `json:"compare"`
+	// Order answers must be in, orderPreference or orderRotating
+	Order string `json:"order"`
+}
+
+type dnssecPolicy struct {
+	// Algorithms zones must not be signed with, RFC 8624 deprecated ones by default
+	ForbiddenAlgorithms []string `json:"forbidden_algorithms"`
+	// Minimal size of RSA keys, 2048 by default
+	MinRSABits int `json:"min_rsa_bits"`
+	// Signatures expiring sooner than that are flagged, 72h by default
+	MinSignatureValidity duration `json:"min_signature_validity"`
+}
+
+var defaultForbiddenAlgorithms = []string{"RSAMD5", "DSA", "DSA-NSEC3-SHA1", "RSASHA1", "RSASHA1-NSEC3-SHA1", "ECC-GOST"}
+
+func (p *dnssecPolicy) setDefaults() error {
+	if p.ForbiddenAlgorithms == nil {
+		p.ForbiddenAlgorithms = defaultForbiddenAlgorithms
+	}
+	for _, alg := range p.ForbiddenAlgorithms {
+		if _, ok := dns.StringToAlgorithm[strings.ToUpper(alg)]; !ok {
+			return fmt.Errorf("unknown DNSSEC algorithm %s", alg)
+		}
+	}
+	if p.MinRSABits == 0 {
+		p.MinRSABits = 2048
+	}
+	if p.MinSignatureValidity == 0 {
+		p.MinSignatureValidity = duration(72 * time.Hour)
+	}
+	return nil
+}
+
+// ttlBounds limits the expected TTLs of records of a type, either bound
+// unchecked if zero.
+type ttlBounds struct {
+	Min duration `json:"min"`
+	Max duration `json:"max"`
+}
+
+// policy holds checks of the zones beyond matching the expected records.
+type policy struct {
+	// DNSSEC policy is only checked if set
+	DNSSEC *dnssecPolicy `json:"dnssec"`
+	// TTL bounds per record type
+	TTL map[string]ttlBounds `json:"ttl"`
+}
+
+const (
+	severityCritical = "critical"
+	severityWarning  = "warning"
+)
+
+// notifyTarget is where notifications about a tenant are sent.
+type notifyTarget struct {
+	// URL to POST the notification to, as JSON unless Template is set
+	Webhook string `json:"webhook"`
+	// text/template file rendering the body instead, e.g. for Slack
+	Template string `json:"template"`
+	// Of the rendered body, application/json by default
+	ContentType string `json:"content_type"`
+	// Only notify about the records of this owner, see ownerMeta
+	Owner string `json:"owner"`
+
+	tmpl *template.Template
+}
+
+// tenantConfig is a group of domains monitored with its own settings in
+// daemon mode, e.g. those of a single team or environment.
+type tenantConfig struct {
+	Name string `json:"name"`
+	// Names of the domains from the input
+	Domains []string `json:"domains"`
+	// Check only the records of the domains selected by the tags, like -tag
+	Tags []string `json:"tags"`
+	// Resolvers and interval from the command line if not set
+	Resolvers []string `json:"resolvers"`
+	Interval  duration `json:"interval"`
+	// Severity of the failures of the tenant, critical by default
+	Severity string         `json:"severity"`
+	Notify   []notifyTarget `json:"notify"`
+}
+
+// config is read from the file passed in -config.
+type config struct {
+	// Replace -ns if set
+	Resolvers []string `json:"resolvers"`
+	// Query settings per record type, e.g. longer timeouts for TXT
+	Types   map[string]queryOverride `json:"types"`
+	Policy  policy                   `json:"policy"`
+	Tenants []tenantConfig           `json:"tenants"`
+	// Whether failures fail the run, by failure code
+	Failures map[string]failureAction `json:"failures"`
+	// Names of groups of resolvers, shown in reports and usable in place
+	// of their resolvers
+	Views map[string][]string `json:"views"`
+}
+
+func (t *tenantConfig) validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("tenant without a name")
+	}
+	if strings.Contains(t.Name, "/") {
+		return fmt.Errorf("tenant name %s must not contain /", t.Name)
+	}
+	if len(t.Domains) == 0 {
+		return fmt.Errorf("tenant %s has no domains", t.Name)
+	}
+	if t.Interval < 0 {
+		return fmt.Errorf("interval of tenant %s must be positive", t.Name)
+	}
+	switch t.Severity {
+	case "":
+		t.Severity = severityCritical
+	case severityCritical, severityWarning:
+	default:
+		return fmt.Errorf("unknown severity %q of tenant %s, expected critical or warning", t.Severity, t.Name)
+	}
+	for _, resolver := range t.Resolvers {
+		if _, _, err := resolverAddr(resolver); err != nil {
+			return fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+	}
+	for i := range t.Notify {
+		n := &t.Notify[i]
+		if n.Webhook == "" {
+			return fmt.Errorf("notification target of tenant %s without a webhook", t.Name)
+		}
+		if n.Template != "" {
+			tmpl, err := loadTemplate(n.Template)
+			if err != nil {
+				return fmt.Errorf("tenant %s: %w", t.Name, err)
+			}
+			n.tmpl = tmpl
+		}
+		if n.ContentType == "" {
+			n.ContentType = "application/json"
+		}
+	}
+	return nil
+}
+
+func loadConfig(path string) (*config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg config
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if err := validateViews(cfg.Views); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.Resolvers = expandViews(cfg.Resolvers, cfg.Views)
+	for i := range cfg.Tenants {
+		cfg.Tenants[i].Resolvers = expandViews(cfg.Tenants[i].Resolvers, cfg.Views)
+	}
+
+	for _, resolver := range cfg.Resolvers {
+		if _, _, err := resolverAddr(resolver); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	types := map[string]queryOverride{}
+	for typ, o := range cfg.Types {
+		if o.Retries != nil && *o.Retries < 0 {
+			return nil, fmt.Errorf("%s: retries for %s must not be negative", path, typ)
+		}
+		if err := o.Compare.validate(strings.ToUpper(typ)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := validateOrder(o.Order, strings.ToUpper(typ)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		types[strings.ToUpper(typ)] = o
+	}
+	cfg.Types = types
+
+	ttls := map[string]ttlBounds{}
+	for typ, b := range cfg.Policy.TTL {
+		if b.Max != 0 && b.Min > b.Max {
+			return nil, fmt.Errorf("%s: minimal TTL for %s is above the maximal one", path, typ)
+		}
+		ttls[strings.ToUpper(typ)] = b
+	}
+	cfg.Policy.TTL = ttls
+
+	if cfg.Policy.DNSSEC != nil {
+		if err := cfg.Policy.DNSSEC.setDefaults(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	for code, a := range cfg.Failures {
+		if err := a.validate(code); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		cfg.Failures[code] = a
+	}
+
+	names := map[string]bool{}
+	for i := range cfg.Tenants {
+		t := &cfg.Tenants[i]
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("%s: duplicate tenant %s", path, t.Name)
+		}
+		names[t.Name] = true
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// answerSignature describes the parts of a response that have to be the
+// same whichever transport it was received over. TTLs are left out, as they
+// count down between the queries.
+func answerSignature(resp *dns.Msg) string {
+	var rrs []string
+	for _, rr := range resp.Answer {
+		rr = dns.Copy(rr)
+		rr.Header().Ttl = 0
+		rrs = append(rrs, rr.String())
+	}
+	sort.Strings(rrs)
+	return dns.RcodeToString[resp.Rcode] + "\n" + strings.Join(rrs, "\n")
+}
+
+// compareAnswers reports a difference between the responses to the same
+// query over UDP and TCP. Truncated UDP responses are expected to differ.
+func compareAnswers(udp *dns.Msg, tcp *dns.Msg) error {
+	if udp.Truncated {
+		return nil
+	}
+	if u, t := answerSignature(udp), answerSignature(tcp); u != t {
+		return codedErrorf(codeTransportMismatch, "answer over UDP (%s) differs from the one over TCP (%s)",
+			strings.ReplaceAll(u, "\n", "; "), strings.ReplaceAll(t, "\n", "; "))
+	}
+	return nil
+}
+
+func probeUDPTCP(t *transports, addr string, zone string) error {
+	udp, _, err := t.udp.Exchange(soaQuery(zone), addr)
+	if err != nil {
+		return fmt.Errorf("over UDP: %w", err)
+	}
+	tcp, _, err := t.tcp.Exchange(soaQuery(zone), addr)
+	if err != nil {
+		return fmt.Errorf("over TCP: %w", err)
+	}
+	return compareAnswers(udp, tcp)
+}
+
+// compareTransports sends the query to the resolver over both UDP and TCP.
+func (c *checker) compareTransports(ns string, name string, queryType string) (*dns.Msg, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	transport, addr, err := resolverAddr(ns)
+	if err != nil {
+		return nil, err
+	}
+	if transport != "" && transport != transportUDP && transport != transportTCP {
+		return nil, fmt.Errorf("resolver %s is not queried over UDP or TCP", ns)
+	}
+
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(name), dns.StringToType[queryType])
+	timeout, _ := c.transports.settingsFor(ns, m.Question[0].Qtype)
+
+	udp, err := c.transports.exchangeOver(transportUDP, m, addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("over UDP: %w", err)
+	}
+	tcp, err := c.transports.exchangeOver(transportTCP, m, addr, timeout)
+	if err != nil {
+		return udp, fmt.Errorf("over TCP: %w", err)
+	}
+	return udp, compareAnswers(udp, tcp)
+}
+
+// runTransportComparison queries every record set on every resolver over
+// both UDP and TCP and flags the ones that get different answers, typically
+// caused by middleboxes tampering with one of the transports.
+func runTransportComparison(domains []domain, opts runOptions) []checkResult {
+	var jobs []checkJob
+	for _, dom := range domains {
+		for _, records := range groupRecords(dom.Records) {
+			name, typ := absolutize(dom.Name, records[0].Name), records[0].Type
+			for _, ns := range opts.resolvers {
+				ns := ns
+				jobs = append(jobs, checkJob{
+					ns:     ns,
+					domain: dom.Name,
+					result: checkResult{Domain: dom.Name, Name: name, Type: typ, NS: ns + " (UDP vs TCP)"},
+					run: func(c *checker, r *checkResult) {
+						r.Response, r.Err = c.compareTransports(ns, name, typ)
+					},
+				})
+			}
+		}
+	}
+	return runPass(newChecker(opts), jobs, opts)
+}
@@ -0,0 +1,180 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: control.proto
+
+package controlpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Control_CheckZone_FullMethodName = "/control.v1.Control/CheckZone"
+	Control_WatchZone_FullMethodName = "/control.v1.Control/WatchZone"
+)
+
+// ControlClient is the client API for Control service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ControlClient interface {
+	// CheckZone runs the checks once and returns the results.
+	CheckZone(ctx context.Context, in *CheckZoneRequest, opts ...grpc.CallOption) (*CheckZoneResponse, error)
+	// WatchZone runs the checks periodically, streaming the results of every
+	// run until the client cancels the call.
+	WatchZone(ctx context.Context, in *WatchZoneRequest, opts ...grpc.CallOption) (Control_WatchZoneClient, error)
+}
+
+type controlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewControlClient(cc grpc.ClientConnInterface) ControlClient {
+	return &controlClient{cc}
+}
+
+func (c *controlClient) CheckZone(ctx context.Context, in *CheckZoneRequest, opts ...grpc.CallOption) (*CheckZoneResponse, error) {
+	out := new(CheckZoneResponse)
+	err := c.cc.Invoke(ctx, Control_CheckZone_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) WatchZone(ctx context.Context, in *WatchZoneRequest, opts ...grpc.CallOption) (Control_WatchZoneClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Control_ServiceDesc.Streams[0], Control_WatchZone_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &controlWatchZoneClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Control_WatchZoneClient interface {
+	Recv() (*CheckZoneResponse, error)
+	grpc.ClientStream
+}
+
+type controlWatchZoneClient struct {
+	grpc.ClientStream
+}
+
+func (x *controlWatchZoneClient) Recv() (*CheckZoneResponse, error) {
+	m := new(CheckZoneResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ControlServer is the server API for Control service.
+// All implementations must embed UnimplementedControlServer
+// for forward compatibility
+type ControlServer interface {
+	// CheckZone runs the checks once and returns the results.
+	CheckZone(context.Context, *CheckZoneRequest) (*CheckZoneResponse, error)
+	// WatchZone runs the checks periodically, streaming the results of every
+	// run until the client cancels the call.
+	WatchZone(*WatchZoneRequest, Control_WatchZoneServer) error
+	mustEmbedUnimplementedControlServer()
+}
+
+// UnimplementedControlServer must be embedded to have forward compatible implementations.
+type UnimplementedControlServer struct {
+}
+
+func (UnimplementedControlServer) CheckZone(context.Context, *CheckZoneRequest) (*CheckZoneResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckZone not implemented")
+}
+func (UnimplementedControlServer) WatchZone(*WatchZoneRequest, Control_WatchZoneServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchZone not implemented")
+}
+func (UnimplementedControlServer) mustEmbedUnimplementedControlServer() {}
+
+// UnsafeControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ControlServer will
+// result in compilation errors.
+type UnsafeControlServer interface {
+	mustEmbedUnimplementedControlServer()
+}
+
+func RegisterControlServer(s grpc.ServiceRegistrar, srv ControlServer) {
+	s.RegisterService(&Control_ServiceDesc, srv)
+}
+
+func _Control_CheckZone_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckZoneRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).CheckZone(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_CheckZone_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).CheckZone(ctx, req.(*CheckZoneRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_WatchZone_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchZoneRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlServer).WatchZone(m, &controlWatchZoneServer{stream})
+}
+
+type Control_WatchZoneServer interface {
+	Send(*CheckZoneResponse) error
+	grpc.ServerStream
+}
+
+type controlWatchZoneServer struct {
+	grpc.ServerStream
+}
+
+func (x *controlWatchZoneServer) Send(m *CheckZoneResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Control_ServiceDesc is the grpc.ServiceDesc for Control service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Control_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "control.v1.Control",
+	HandlerType: (*ControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CheckZone",
+			Handler:    _Control_CheckZone_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchZone",
+			Handler:       _Control_WatchZone_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "control.proto",
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// convergence records when each resolver first served the expected answer
+// of each record set while waiting for propagation.
+type convergence struct {
+	started time.Time
+	// Record sets in the order of the first run
+	sets []resultKey
+	// Resolvers of each record set, in the order of the first run
+	resolvers map[resultKey][]string
+	views     resolverViews
+	// First passing check by record set and resolver
+	served map[resultKey]time.Time
+	// Whether all resolvers of the record set passed in the first run
+	immediate map[resultKey]bool
+}
+
+// newConvergence starts tracking convergence from the results of the first
+// run.
+func newConvergence(res *runResult) *convergence {
+	c := &convergence{
+		started:   res.Started,
+		views:     resolverViews{},
+		resolvers: map[resultKey][]string{},
+		served:    map[resultKey]time.Time{},
+		immediate: map[resultKey]bool{},
+	}
+	for _, r := range res.Results {
+		key := setKey(r)
+		if _, ok := c.resolvers[key]; !ok {
+			c.sets = append(c.sets, key)
+			c.immediate[key] = true
+		}
+		c.resolvers[key] = append(c.resolvers[key], r.NS)
+		if r.View != "" {
+			c.views[r.NS] = r.View
+		}
+		if r.Err != nil {
+			c.immediate[key] = false
+		}
+	}
+	c.observe(res)
+	return c
+}
+
+// observe notes the resolvers serving the expected answers in the run.
+func (c *convergence) observe(res *runResult) {
+	for _, r := range res.Results {
+		if r.Err != nil {
+			continue
+		}
+		key := setKey(r)
+		key.NS = r.NS
+		if _, ok := c.served[key]; ok {
+			continue
+		}
+		at := res.Started
+		if r.Timing != nil {
+			at = r.Timing.Started
+		}
+		c.served[key] = at
+	}
+}
+
+type convergenceJSON struct {
+	Started    time.Time                  `json:"started"`
+	RecordSets []recordSetConvergenceJSON `json:"record_sets"`
+}
+
+type recordSetConvergenceJSON struct {
+	Domain    string                    `json:"domain"`
+	Name      string                    `json:"name"`
+	Type      string                    `json:"type"`
+	Class     string                    `json:"class,omitempty"`
+	Resolvers []resolverConvergenceJSON `json:"resolvers"`
+}
+
+type resolverConvergenceJSON struct {
+	NS string `json:"ns"`
+	// Time from the start of the run, empty if never served
+	ServedAfter string `json:"served_after,omitempty"`
+	Served      bool   `json:"served"`
+}
+
+// after returns how long after the start the resolver served the record
+// set, false if it never did.
+func (c *convergence) after(set resultKey, ns string) (time.Duration, bool) {
+	key := set
+	key.NS = ns
+	at, ok := c.served[key]
+	if !ok {
+		return 0, false
+	}
+	return at.Sub(c.started), true
+}
+
+func (c *convergence) json() convergenceJSON {
+	out := convergenceJSON{Started: c.started, RecordSets: []recordSetConvergenceJSON{}}
+	for _, set := range c.sets {
+		rs := recordSetConvergenceJSON{Domain: set.Domain, Name: set.Name, Type: set.Type, Class: set.Class}
+		for _, ns := range c.resolvers[set] {
+			rc := resolverConvergenceJSON{NS: ns}
+			if d, ok := c.after(set, ns); ok {
+				rc.ServedAfter, rc.Served = d.Round(time.Millisecond).String(), true
+			}
+			rs.Resolvers = append(rs.Resolvers, rc)
+		}
+		out.RecordSets = append(out.RecordSets, rs)
+	}
+	return out
+}
+
+func writeConvergenceJSON(path string, c *convergence) error {
+	b, err := json.MarshalIndent(c.json(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// printConvergence prints how long each resolver took to serve the record
+// sets that were not served by all of them in the first run.
+func printConvergence(w io.Writer, c *convergence, waited time.Duration) {
+	var immediate int
+	for _, set := range c.sets {
+		if c.immediate[set] {
+			immediate++
+		}
+	}
+	if immediate == len(c.sets) {
+		return
+	}
+
+	fmt.Fprintf(w, "\nConvergence, time from the start until each resolver served the expected records:\n")
+	for _, set := range c.sets {
+		if c.immediate[set] {
+			continue
+		}
+		fmt.Fprintf(w, "  %s %s\n", keyTypeLabel(set), set.Name)
+		for _, ns := range c.resolvers[set] {
+			if d, ok := c.after(set, ns); ok {
+				fmt.Fprintf(w, "    %s: %v\n", c.views.label(ns), d.Round(time.Second))
+			} else {
+				fmt.Fprintf(w, "    %s: not within %v\n", c.views.label(ns), waited)
+			}
+		}
+	}
+	if immediate > 0 {
+		fmt.Fprintf(w, "  %d other record sets were served by all resolvers from the start\n", immediate)
+	}
+}
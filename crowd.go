@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+)
+
+type publicResolver struct {
+	Addr string
+	Name string
+}
+
+// Well-known public resolvers, a mix of global anycast services and
+// regional ones
+var publicResolvers = []publicResolver{
+	{"8.8.8.8:53", "Google"},
+	{"8.8.4.4:53", "Google"},
+	{"1.1.1.1:53", "Cloudflare"},
+	{"1.0.0.1:53", "Cloudflare"},
+	{"9.9.9.9:53", "Quad9"},
+	{"149.112.112.112:53", "Quad9"},
+	{"208.67.222.222:53", "OpenDNS"},
+	{"208.67.220.220:53", "OpenDNS"},
+	{"4.2.2.1:53", "Level3"},
+	{"64.6.64.6:53", "UltraDNS"},
+	{"94.140.14.14:53", "AdGuard"},
+	{"185.228.168.9:53", "CleanBrowsing"},
+	{"8.26.56.26:53", "Comodo"},
+	{"74.82.42.42:53", "Hurricane Electric"},
+	{"84.200.69.80:53", "DNS.WATCH (Germany)"},
+	{"77.88.8.8:53", "Yandex (Russia)"},
+	{"223.5.5.5:53", "AliDNS (China)"},
+	{"119.29.29.29:53", "DNSPod (China)"},
+	{"180.76.76.76:53", "Baidu (China)"},
+	{"168.126.63.1:53", "KT (South Korea)"},
+	{"200.221.11.101:53", "UOL (Brazil)"},
+}
+
+// loadResolverList reads resolvers, one per line as "host:port [name]".
+// Empty lines and lines starting with # are skipped.
+func loadResolverList(path string) ([]publicResolver, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var resolvers []publicResolver
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		addr, name, _ := strings.Cut(line, " ")
+		resolvers = append(resolvers, publicResolver{Addr: addr, Name: strings.TrimSpace(name)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("no resolvers in %s", path)
+	}
+	return resolvers, nil
+}
+
+// sampleResolvers returns n random resolvers of the list, or all of them if
+// n is 0 or exceeds the list.
+func sampleResolvers(resolvers []publicResolver, n int) []publicResolver {
+	if n <= 0 || n >= len(resolvers) {
+		return resolvers
+	}
+	sample := append([]publicResolver(nil), resolvers...)
+	rand.Shuffle(len(sample), func(i, j int) {
+		sample[i], sample[j] = sample[j], sample[i]
+	})
+	return sample[:n]
+}
+
+type propagation struct {
+	resultKey
+	Passed  int
+	Total   int
+	Missing []string // resolvers that failed
+}
+
+func (p propagation) percent() float64 {
+	return 100 * float64(p.Passed) / float64(p.Total)
+}
+
+func propagationOf(res *runResult) []propagation {
+	byKey := map[resultKey]*propagation{}
+	var keys []resultKey
+	for _, r := range res.Results {
+		key := setKey(r)
+		p := byKey[key]
+		if p == nil {
+			p = &propagation{resultKey: key}
+			byKey[key] = p
+			keys = append(keys, key)
+		}
+		p.Total++
+		if r.Err == nil && !r.MatchedOld {
+			p.Passed++
+		} else {
+			p.Missing = append(p.Missing, r.NS)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Domain != keys[j].Domain {
+			return keys[i].Domain < keys[j].Domain
+		}
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		return keys[i].Class < keys[j].Class
+	})
+
+	var out []propagation
+	for _, key := range keys {
+		p := byKey[key]
+		sort.Strings(p.Missing)
+		out = append(out, *p)
+	}
+	return out
+}
+
+// printPropagation prints propagation per record set and returns whether all
+// of them reached minPercent.
+func printPropagation(res *runResult, resolvers []publicResolver, minPercent float64) bool {
+	names := map[string]string{}
+	for _, r := range resolvers {
+		names[r.Addr] = r.Name
+	}
+
+	ok := true
+	fmt.Printf("\nPropagation across %d resolvers:\n", len(resolvers))
+	for _, p := range propagationOf(res) {
+		fmt.Printf("%5.1f%% (%d/%d) %s %s\n", p.percent(), p.Passed, p.Total, keyTypeLabel(p.resultKey), p.Name)
+		for _, ns := range p.Missing {
+			if name := names[ns]; name != "" {
+				fmt.Printf("         not at %s (%s)\n", ns, name)
+			} else {
+				fmt.Printf("         not at %s\n", ns)
+			}
+		}
+		if p.percent() < minPercent {
+			ok = false
+		}
+	}
+	return ok
+}
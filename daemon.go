@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// daemon monitors the domains of a single tenant, or all of them if there
+// are no tenants.
+type daemon struct {
+	// Empty if there are no tenants
+	tenant string
+
+	mu sync.Mutex
+	// Replaced on reload, see settings
+	daemonSettings
+	last    *runResult
+	history []runOutcomes // oldest first, at most historySize entries
+	// Persists the history if set
+	store *historyStore
+	// Signalled on reload to re-check right away
+	reloaded chan struct{}
+	// Start of the run in progress, zero while waiting for the next one
+	busySince time.Time
+}
+
+// daemonSettings are what a daemon checks and how.
+type daemonSettings struct {
+	severity string
+	notify   []notifyTarget
+
+	domains  []domain
+	opts     runOptions
+	interval time.Duration
+}
+
+func newDaemon(tenant string, s daemonSettings) *daemon {
+	return &daemon{tenant: tenant, daemonSettings: s, reloaded: make(chan struct{}, 1)}
+}
+
+func (d *daemon) lastRun() *runResult {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last
+}
+
+// settings returns the current settings, which may be replaced by a reload
+// at any time.
+func (d *daemon) settings() daemonSettings {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.daemonSettings
+}
+
+// update replaces the settings, keeping the results so far, and starts a
+// new run.
+func (d *daemon) update(s daemonSettings) {
+	d.mu.Lock()
+	d.daemonSettings = s
+	d.mu.Unlock()
+
+	select {
+	case d.reloaded <- struct{}{}:
+	default:
+	}
+}
+
+// loop checks the domains every interval or, with ttlSchedule, re-checks
+// every record set when it is due according to scheduleRecordSets. Every
+// reload starts a full run.
+func (d *daemon) loop(ctx context.Context, ttlSchedule bool) {
+	// Record sets to re-check, all of them if nil
+	var due map[resultKey]bool
+	for {
+		s := d.settings()
+		domains := s.domains
+		if due != nil {
+			domains, _ = recordSetsOf(s.domains, due)
+		}
+		d.setBusy(time.Now())
+		res, err := runChecks(ctx, domains, s.opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Run failed: %v\n", err)
+		} else {
+			if s.opts.groupBy == groupByOwner {
+				printOwnerReport(os.Stdout, res, s.opts.dumpResponses)
+			} else {
+				printReport(os.Stdout, domains, res, s.opts.dumpResponses)
+			}
+			if d.tenant != "" {
+				fmt.Printf("\nRun of %s finished: %d checks, %d failed\n", d.tenant, len(res.Results), len(res.failures()))
+			} else {
+				fmt.Printf("\nRun finished: %d checks, %d failed\n", len(res.Results), len(res.failures()))
+			}
+
+			d.mu.Lock()
+			prev := d.last
+			if due != nil && prev != nil {
+				started := res.Started
+				res = replaceResults(prev, res)
+				res.Started = started
+			}
+			d.last = res
+			d.history = append(d.history, outcomesOf(res))
+			if len(d.history) > historySize {
+				d.history = d.history[len(d.history)-historySize:]
+			}
+			history := append([]runOutcomes(nil), d.history...)
+			d.mu.Unlock()
+
+			printTrends(os.Stdout, res, history)
+			if d.store != nil {
+				if err := d.store.save(d.tenant, history); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to save history: %v\n", err)
+				}
+			}
+
+			d.sendNotifications(ctx, s, prev, res)
+		}
+
+		d.setBusy(time.Time{})
+
+		wait := s.interval
+		var sched schedule
+		if last := d.lastRun(); ttlSchedule && last != nil {
+			sched = scheduleRecordSets(last, s.interval)
+			if next := sched.next(); !next.IsZero() {
+				wait = time.Until(next)
+			}
+		}
+		due = nil
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.reloaded:
+		case <-time.After(wait):
+			if sched != nil {
+				due = sched.due(time.Now())
+			}
+		}
+	}
+}
+
+func (d *daemon) setBusy(since time.Time) {
+	d.mu.Lock()
+	d.busySince = since
+	d.mu.Unlock()
+}
+
+// stuck tells whether the run in progress has been going on for longer than
+// the interval between runs, which is as long as runs are expected to take.
+func (d *daemon) stuck(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.busySince.IsZero() && now.Sub(d.busySince) > d.interval
+}
+
+// watchdog sends keep-alives to systemd as long as no daemon is stuck in a
+// run, so that systemd restarts the service if one hangs.
+func watchdog(ctx context.Context, interval time.Duration, daemons []*daemon) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if stuck := stuckDaemon(daemons, now); stuck != nil {
+				run := "run"
+				if stuck.tenant != "" {
+					run = "run of " + stuck.tenant
+				}
+				fmt.Fprintf(os.Stderr, "Not notifying systemd watchdog: %s started at %s has not finished\n", run, stuck.busySinceTime().Format(time.RFC3339))
+				continue
+			}
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to notify systemd watchdog: %v\n", err)
+			}
+		}
+	}
+}
+
+func stuckDaemon(daemons []*daemon, now time.Time) *daemon {
+	for _, d := range daemons {
+		if d.stuck(now) {
+			return d
+		}
+	}
+	return nil
+}
+
+func (d *daemon) busySinceTime() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.busySince
+}
+
+func (d *daemon) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// Ready as soon as the first run has finished, whatever its outcome:
+// failing records are reported via /status, not by pulling the pod out.
+func (d *daemon) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if d.lastRun() == nil {
+		http.Error(w, "first run has not finished yet", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+type resultJSON struct {
+	Domain    string `json:"domain"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Class     string `json:"class,omitempty"`
+	NS        string `json:"ns"`
+	View      string `json:"view,omitempty"`
+	Transport string `json:"transport,omitempty"`
+	// Answer over UDP was truncated and retried over TCP
+	Truncated bool `json:"truncated,omitempty"`
+	// Identity of the resolver instance that answered
+	Instance string `json:"instance,omitempty"`
+	// Size of the response in bytes
+	Size int `json:"size,omitempty"`
+	// Sizes close to the limit and unexpected records of the response
+	Anomalies []string `json:"anomalies,omitempty"`
+	// Values from before a migration were served
+	MatchedOld bool `json:"matched_old,omitempty"`
+	// Failed, but enough other resolvers passed in quorum mode
+	Outvoted bool   `json:"outvoted,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Cause of the failure according to the authoritative server
+	Cause string `json:"cause,omitempty"`
+	// Stable failure class, e.g. E_TIMEOUT
+	Code  string `json:"code,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	// Where the checked records are defined
+	Source string `json:"source,omitempty"`
+	// The resolver seems to be intercepted or to rewrite answers
+	Untrusted string `json:"untrusted,omitempty"`
+	// How often the check failed recently, in daemon mode
+	Trend  *trend      `json:"trend,omitempty"`
+	Timing *timingJSON `json:"timing,omitempty"`
+}
+
+type timingJSON struct {
+	Started  time.Time `json:"started"`
+	Queued   string    `json:"queued"`
+	Query    string    `json:"query"`
+	Attempts int       `json:"attempts"`
+	Shared   bool      `json:"shared,omitempty"`
+}
+
+func newResultJSON(r checkResult) resultJSON {
+	rj := resultJSON{
+		Domain:     r.Domain,
+		Name:       r.Name,
+		Type:       r.Type,
+		Class:      r.Class,
+		NS:         r.NS,
+		View:       r.View,
+		Transport:  r.Transport,
+		Truncated:  r.Truncated,
+		Instance:   r.Instance,
+		Size:       r.Size,
+		Anomalies:  r.Anomalies,
+		MatchedOld: r.MatchedOld,
+		Outvoted:   r.Outvoted,
+		Cause:      r.Cause,
+		Owner:      r.Owner,
+		Source:     r.Source,
+		Untrusted:  r.Untrusted,
+	}
+	if t := r.Timing; t != nil {
+		rj.Timing = &timingJSON{
+			Started:  t.Started,
+			Queued:   t.Queued.String(),
+			Query:    t.Query.String(),
+			Attempts: t.Attempts,
+			Shared:   t.Shared,
+		}
+	}
+	if r.Err != nil {
+		rj.Error = r.Err.Error()
+		rj.Code = errorCode(r.Err)
+	}
+	return rj
+}
+
+// checkResult restores the result, except for the response.
+func (rj resultJSON) checkResult() checkResult {
+	r := checkResult{
+		Domain:     rj.Domain,
+		Name:       rj.Name,
+		Type:       rj.Type,
+		Class:      rj.Class,
+		NS:         rj.NS,
+		View:       rj.View,
+		Transport:  rj.Transport,
+		Truncated:  rj.Truncated,
+		Instance:   rj.Instance,
+		Size:       rj.Size,
+		Anomalies:  rj.Anomalies,
+		MatchedOld: rj.MatchedOld,
+		Outvoted:   rj.Outvoted,
+		Cause:      rj.Cause,
+		Owner:      rj.Owner,
+		Source:     rj.Source,
+		Untrusted:  rj.Untrusted,
+	}
+	if t := rj.Timing; t != nil {
+		r.Timing = &checkTiming{Started: t.Started, Attempts: t.Attempts, Shared: t.Shared}
+		r.Timing.Queued, _ = time.ParseDuration(t.Queued)
+		r.Timing.Query, _ = time.ParseDuration(t.Query)
+	}
+	if rj.Error != "" {
+		code := rj.Code
+		if code == "" {
+			code = codeUnknown
+		}
+		r.Err = withCode(code, errors.New(rj.Error))
+	}
+	return r
+}
+
+type status struct {
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Duration string       `json:"duration"`
+	Checks   int          `json:"checks"`
+	Passed   int          `json:"passed"`
+	Failed   int          `json:"failed"`
+	Failures []resultJSON `json:"failures"`
+	// Outcome of every domain
+	Domains []domainStatus `json:"domains"`
+}
+
+func newStatus(res *runResult) status {
+	st := status{
+		Started:  res.Started,
+		Finished: res.Finished,
+		Duration: res.Finished.Sub(res.Started).String(),
+		Checks:   len(res.Results),
+		Failures: []resultJSON{},
+		Domains:  domainStatuses(res),
+	}
+	for _, f := range res.failures() {
+		st.Failures = append(st.Failures, newResultJSON(f))
+	}
+	st.Failed = len(st.Failures)
+	st.Passed = st.Checks - st.Failed
+	return st
+}
+
+func (d *daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	res := d.lastRun()
+	if res == nil {
+		http.Error(w, "first run has not finished yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	st := newStatus(res)
+	history := d.recentHistory()
+	for i, f := range st.Failures {
+		t := trendOf(history, resultKey{Domain: f.Domain, Name: f.Name, Type: f.Type, Class: f.Class, NS: f.NS})
+		st.Failures[i].Trend = &t
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+type daemonOptions struct {
+	listen     string
+	grpcListen string // gRPC API is disabled if empty
+	// Serve POST /check, running checks on demand for anyone who can reach
+	// the endpoints
+	checkAPI bool
+	// Re-check record sets according to their TTLs rather than all of them
+	// every interval
+	ttlSchedule bool
+}
+
+// handler serves the endpoints of the daemon, POST /check only with
+// checkAPI.
+func (d *daemon) handler(checkAPI bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", d.handleHealthz)
+	mux.HandleFunc("/readyz", d.handleReadyz)
+	mux.HandleFunc("/status", d.handleStatus)
+	mux.HandleFunc("/history", d.handleHistory)
+	if checkAPI {
+		mux.HandleFunc("/check", d.handleCheck)
+	}
+	mux.HandleFunc("/", d.handleDashboard)
+	return mux
+}
+
+// runDaemon monitors the domains of every tenant. Without tenants the
+// endpoints of the only daemon are served at the root, otherwise those of
+// each tenant are served under /tenants/<name>/.
+func runDaemon(ctx context.Context, daemons []*daemon, opts daemonOptions) error {
+	var mux http.Handler
+	if len(daemons) == 1 && daemons[0].tenant == "" {
+		mux = daemons[0].handler(opts.checkAPI)
+	} else {
+		mux = tenantsHandler(daemons, opts.checkAPI)
+	}
+
+	l, err := net.Listen("tcp", opts.listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: mux}
+
+	errCh := make(chan error, 2)
+
+	if opts.grpcListen != "" {
+		gl, err := net.Listen("tcp", opts.grpcListen)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		gsrv := newGRPCServer(daemons)
+		defer gsrv.GracefulStop()
+		go func() {
+			errCh <- gsrv.Serve(gl)
+		}()
+	}
+
+	for _, d := range daemons {
+		go d.loop(ctx, opts.ttlSchedule)
+	}
+	if wdInterval := sdWatchdogInterval(); wdInterval != 0 {
+		go watchdog(ctx, wdInterval, daemons)
+	}
+
+	if err := sdNotify("READY=1"); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to notify systemd: %v\n", err)
+	}
+
+	go func() {
+		errCh <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	_ = sdNotify("STOPPING=1")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const historySize = 50
+
+type resultKey struct {
+	Domain string
+	Name   string
+	Type   string
+	// CH or HS, empty for IN, as in checkResult
+	Class string
+	NS    string
+}
+
+// checkKey returns the key of the check of the result on its resolver.
+func checkKey(r checkResult) resultKey {
+	return resultKey{Domain: r.Domain, Name: r.Name, Type: r.Type, Class: r.Class, NS: r.NS}
+}
+
+// setKey returns the key of the record set of the result, the same on all
+// resolvers.
+func setKey(r checkResult) resultKey {
+	return resultKey{Domain: r.Domain, Name: r.Name, Type: strings.ToUpper(r.Type), Class: r.Class}
+}
+
+// inputSetKey returns the key setKey returns for the results of the record
+// set of the domain given as in the input.
+func inputSetKey(dom domain, name string, typ string, class string) resultKey {
+	return resultKey{Domain: dom.Name, Name: absolutize(dom.Name, name), Type: strings.ToUpper(typ), Class: classLabel(recordClass(class))}
+}
+
+// runOutcomes is what is retained of past runs: whether each check failed.
+type runOutcomes struct {
+	Finished time.Time
+	Failed   map[resultKey]bool
+}
+
+func outcomesOf(res *runResult) runOutcomes {
+	o := runOutcomes{Finished: res.Finished, Failed: map[resultKey]bool{}}
+	for _, r := range res.Results {
+		o.Failed[checkKey(r)] = r.Err != nil
+	}
+	return o
+}
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+type dashboardPoint struct {
+	Checked bool
+	Failed  bool
+	When    time.Time
+}
+
+type dashboardRow struct {
+	resultKey
+	View     string
+	Error    string
+	Response string
+	History  []dashboardPoint
+}
+
+type dashboardDomain struct {
+	Name   string
+	Passed int
+	Failed int
+	Rows   []dashboardRow
+}
+
+type dashboardData struct {
+	Finished time.Time
+	Interval time.Duration
+	Domains  []dashboardDomain
+}
+
+func (d *daemon) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	d.mu.Lock()
+	res := d.last
+	history := append([]runOutcomes(nil), d.history...)
+	d.mu.Unlock()
+
+	data := dashboardData{Interval: d.settings().interval}
+	if res != nil {
+		data.Finished = res.Finished
+
+		byDomain := map[string]*dashboardDomain{}
+		for _, cr := range res.Results {
+			dd := byDomain[cr.Domain]
+			if dd == nil {
+				dd = &dashboardDomain{Name: cr.Domain}
+				byDomain[cr.Domain] = dd
+			}
+
+			row := dashboardRow{resultKey: checkKey(cr), View: cr.View}
+			if cr.Err != nil {
+				dd.Failed++
+				row.Error = cr.Err.Error()
+				if cr.Response != nil {
+					row.Response = cr.Response.String()
+				}
+			} else {
+				dd.Passed++
+			}
+			for _, h := range history {
+				failed, checked := h.Failed[row.resultKey]
+				row.History = append(row.History, dashboardPoint{Checked: checked, Failed: failed, When: h.Finished})
+			}
+			dd.Rows = append(dd.Rows, row)
+		}
+
+		for _, dd := range byDomain {
+			sort.Slice(dd.Rows, func(i, j int) bool {
+				a, b := dd.Rows[i], dd.Rows[j]
+				if a.Name != b.Name {
+					return a.Name < b.Name
+				}
+				return lessKey(a.resultKey, b.resultKey)
+			})
+			data.Domains = append(data.Domains, *dd)
+		}
+		sort.Slice(data.Domains, func(i, j int) bool {
+			return data.Domains[i].Name < data.Domains[j].Name
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = dashboardTemplate.Execute(w, data)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// checkDelegations looks up the TLD and the NS records of every domain on
+// its first resolver, returning a failed result for each domain that is not
+// delegated, in the order of the domains: their records would all fail the
+// same way. Failures to get an answer at all, including running out of
+// -domain-timeout, are left to the record checks.
+func checkDelegations(domains []domain, opts runOptions) []checkResult {
+	c := newChecker(opts)
+	if c.err != nil {
+		return nil
+	}
+
+	var jobs []checkJob
+	for _, dom := range domains {
+		if !dom.hasINET() {
+			continue
+		}
+		ns, zone := opts.forDomain(dom).resolvers[0], dom.Name
+		jobs = append(jobs, checkJob{
+			ns:     ns,
+			domain: zone,
+			result: checkResult{Domain: zone, Name: zone, Type: "NS", NS: ns},
+			run: func(c *checker, r *checkResult) {
+				r.Err = c.delegationError(ns, zone)
+			},
+			quiet: true,
+		})
+	}
+
+	var undelegated []checkResult
+	for _, r := range runPass(c, jobs, opts) {
+		if errorCode(r.Err) == codeNotDelegated {
+			undelegated = append(undelegated, r)
+		}
+	}
+	return undelegated
+}
+
+func (c *checker) delegationError(ns string, zone string) error {
+	labels := dns.SplitDomainName(zone)
+	if len(labels) == 0 {
+		return nil
+	}
+	// Queries for the TLD are shared by the domains under it
+	tld := labels[len(labels)-1]
+	if _, err := c.query(ns, tld+".", "NS"); errorCode(err) == codeNXDomain {
+		return codedErrorf(codeNotDelegated, "zone not delegated: there is no TLD .%s", tld)
+	}
+
+	resp, err := c.query(ns, dns.Fqdn(zone), "NS")
+	switch errorCode(err) {
+	case "":
+	case codeNXDomain:
+		return codedErrorf(codeNotDelegated, "zone not delegated: %s does not exist", zone)
+	case codeServFail:
+		return codedErrorf(codeNotDelegated, "zone not delegated: the delegation of %s does not resolve (SERVFAIL)", zone)
+	default:
+		return nil
+	}
+	// Authoritative servers of the parent refer to the delegation
+	for _, rr := range append(resp.Answer[:len(resp.Answer):len(resp.Answer)], resp.Ns...) {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, dns.Fqdn(zone)) {
+			return nil
+		}
+	}
+	return codedErrorf(codeNotDelegated, "zone not delegated: %s has no NS records", zone)
+}
+
+// withoutDomains returns the domains other than the ones of the results.
+func withoutDomains(domains []domain, results []checkResult) []domain {
+	skip := map[string]bool{}
+	for _, r := range results {
+		skip[r.Domain] = true
+	}
+	var out []domain
+	for _, dom := range domains {
+		if !skip[dom.Name] {
+			out = append(out, dom)
+		}
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/miekg/dns"
+)
+
+// authProbe is a diagnostic query sent to authoritative servers of a zone.
+type authProbe struct {
+	name string
+	run  func(t *transports, addr string, zone string) error
+}
+
+var authProbes = []authProbe{
+	{"0x20 case preservation", probeCase},
+	{"plain DNS", probePlain},
+	{"EDNS0", probeEDNS0},
+	{"EDNS0 with DO bit", probeEDNS0DO},
+	{"EDNS version 1 answered with BADVERS", probeEDNSVersion},
+	{"unknown EDNS option ignored", probeEDNSOption},
+	{"unknown EDNS flag ignored", probeEDNSFlag},
+	{"TCP", probeTCP},
+	{"same answer over UDP and TCP", probeUDPTCP},
+}
+
+// EDNS option code and flag with no meaning assigned, which servers have to
+// ignore and not echo back (RFC 6891, section 6.1.2 and 6.1.4)
+const (
+	unassignedEDNSOption = 100
+	unassignedEDNSFlag   = 0x4000
+)
+
+func soaQuery(zone string) *dns.Msg {
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(zone), dns.TypeSOA)
+	m.RecursionDesired = false
+	return m
+}
+
+func exchangeNoError(client *dns.Client, m *dns.Msg, addr string) (*dns.Msg, error) {
+	resp, _, err := client.Exchange(m, addr)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return resp, fmt.Errorf("got %s", dns.RcodeToString[resp.Rcode])
+	}
+	return resp, nil
+}
+
+// randomizeCase flips the case of letters in the name at random, making
+// sure at least one letter is changed if there are any.
+func randomizeCase(name string) string {
+	for {
+		var changed bool
+		out := []rune(name)
+		for i, r := range out {
+			if unicode.IsLetter(r) && rand.Intn(2) == 0 {
+				if unicode.IsUpper(r) {
+					out[i] = unicode.ToLower(r)
+				} else {
+					out[i] = unicode.ToUpper(r)
+				}
+				changed = true
+			}
+		}
+		if changed || strings.IndexFunc(name, unicode.IsLetter) == -1 {
+			return string(out)
+		}
+	}
+}
+
+func probeCase(t *transports, addr string, zone string) error {
+	m := soaQuery(randomizeCase(dns.Fqdn(zone)))
+	resp, err := exchangeNoError(t.udp, m, addr)
+	if err != nil {
+		return err
+	}
+	if len(resp.Question) != 1 {
+		return fmt.Errorf("expected 1 question in response, got %d", len(resp.Question))
+	}
+	if resp.Question[0].Name != m.Question[0].Name {
+		return fmt.Errorf("sent %s, got %s back", m.Question[0].Name, resp.Question[0].Name)
+	}
+	return nil
+}
+
+func probePlain(t *transports, addr string, zone string) error {
+	resp, err := exchangeNoError(t.udp, soaQuery(zone), addr)
+	if err != nil {
+		return err
+	}
+	if resp.IsEdns0() != nil {
+		return fmt.Errorf("OPT record in response to a query without EDNS")
+	}
+	if len(resp.Answer) == 0 {
+		return fmt.Errorf("no SOA in answer")
+	}
+	return nil
+}
+
+func probeEDNS0(t *transports, addr string, zone string) error {
+	m := soaQuery(zone)
+	m.SetEdns0(1232, false)
+	resp, err := exchangeNoError(t.udp, m, addr)
+	if err != nil {
+		return err
+	}
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return fmt.Errorf("no OPT record in response")
+	}
+	if opt.Version() != 0 {
+		return fmt.Errorf("expected EDNS version 0 in response, got %d", opt.Version())
+	}
+	return nil
+}
+
+func probeEDNS0DO(t *transports, addr string, zone string) error {
+	m := soaQuery(zone)
+	m.SetEdns0(1232, true)
+	resp, err := exchangeNoError(t.udp, m, addr)
+	if err != nil {
+		return err
+	}
+	if resp.IsEdns0() == nil {
+		return fmt.Errorf("no OPT record in response")
+	}
+	return nil
+}
+
+func probeEDNSVersion(t *transports, addr string, zone string) error {
+	m := soaQuery(zone)
+	m.SetEdns0(1232, false)
+	m.IsEdns0().SetVersion(1)
+	resp, _, err := t.udp.Exchange(m, addr)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeBadVers {
+		return fmt.Errorf("expected BADVERS, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return fmt.Errorf("no OPT record in response")
+	}
+	if opt.Version() != 0 {
+		return fmt.Errorf("expected EDNS version 0 in response, got %d", opt.Version())
+	}
+	return nil
+}
+
+func probeEDNSOption(t *transports, addr string, zone string) error {
+	m := soaQuery(zone)
+	m.SetEdns0(1232, false)
+	opt := m.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: unassignedEDNSOption})
+	resp, err := exchangeNoError(t.udp, m, addr)
+	if err != nil {
+		return err
+	}
+	opt = resp.IsEdns0()
+	if opt == nil {
+		return fmt.Errorf("no OPT record in response")
+	}
+	for _, o := range opt.Option {
+		if o.Option() == unassignedEDNSOption {
+			return fmt.Errorf("unknown option %d echoed back", unassignedEDNSOption)
+		}
+	}
+	return nil
+}
+
+func probeEDNSFlag(t *transports, addr string, zone string) error {
+	m := soaQuery(zone)
+	m.SetEdns0(1232, false)
+	m.IsEdns0().Hdr.Ttl |= unassignedEDNSFlag
+	resp, err := exchangeNoError(t.udp, m, addr)
+	if err != nil {
+		return err
+	}
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return fmt.Errorf("no OPT record in response")
+	}
+	if opt.Hdr.Ttl&unassignedEDNSFlag != 0 {
+		return fmt.Errorf("unknown flag echoed back")
+	}
+	return nil
+}
+
+func probeTCP(t *transports, addr string, zone string) error {
+	resp, err := exchangeNoError(t.tcp, soaQuery(zone), addr)
+	if err != nil {
+		return err
+	}
+	if len(resp.Answer) == 0 {
+		return fmt.Errorf("no SOA in answer")
+	}
+	return nil
+}
+
+// runDiagnostics probes the authoritative servers of every domain and
+// returns whether all of them behaved.
+func runDiagnostics(domains []domain, opts runOptions) bool {
+	c := newChecker(opts)
+
+	ok := true
+	var broken []string
+	for _, dom := range domains {
+		fmt.Println(dom.Name)
+
+		servers, err := c.authServers(opts.resolvers[0], dom.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+			ok = false
+			continue
+		}
+
+		for _, server := range servers {
+			fmt.Printf("  %s (%s)\n", server.Host, server.Addr)
+			var failed []string
+			for _, probe := range authProbes {
+				var err error
+				if c.err != nil {
+					err = c.err
+				} else {
+					err = probe.run(c.transports, server.Addr, dom.Name)
+				}
+				if err != nil {
+					fmt.Printf("    FAIL %s: %v\n", probe.name, err)
+					failed = append(failed, probe.name)
+				} else {
+					fmt.Printf("    ok   %s\n", probe.name)
+				}
+			}
+			if len(failed) > 0 {
+				broken = append(broken, fmt.Sprintf("%s (%s) for %s: %s", server.Host, server.Addr, dom.Name, strings.Join(failed, ", ")))
+			}
+		}
+	}
+
+	if len(broken) > 0 {
+		fmt.Println("\nServers likely to break with modern resolvers:")
+		for _, b := range broken {
+			fmt.Printf("  %s\n", b)
+		}
+	}
+	return ok && len(broken) == 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// loadRevision reads DNSControl output from a file, or from git if given as
+// git:<revision>:<path>.
+func loadRevision(spec string) ([]domain, error) {
+	if rev, ok := strings.CutPrefix(spec, "git:"); ok {
+		var stderr bytes.Buffer
+		cmd := exec.Command("git", "show", rev)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git show %s failed: %w: %s", rev, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return parseDNSControl(out)
+	}
+
+	f, err := os.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeDNSControl(bufio.NewReader(f), false)
+}
+
+// recordSetKey identifies a record set within a domain.
+func recordSetKey(name string, typ string) string {
+	return strings.ToLower(name) + " " + strings.ToUpper(typ)
+}
+
+// diffDomains returns the record sets of the domains that were added or
+// changed since the old revision, and the ones deleted since then as
+// Deleted, and the number of both. Domains missing from the old revision
+// are checked completely.
+func diffDomains(old []domain, domains []domain) ([]domain, int) {
+	oldByName := map[string]domain{}
+	for _, dom := range old {
+		oldByName[strings.ToLower(dom.Name)] = dom
+	}
+
+	var out []domain
+	var n int
+	for _, dom := range domains {
+		oldDom, ok := oldByName[strings.ToLower(dom.Name)]
+		if !ok {
+			out = append(out, dom)
+			n += len(groupRecords(dom.Records)) + len(dom.NoData) + len(dom.Deleted)
+			continue
+		}
+
+		oldSets := map[string]string{}
+		for _, records := range groupRecords(oldDom.Records) {
+			oldSets[recordSetKey(records[0].Name, records[0].Type)] = recordsHash(records)
+		}
+
+		changedDom := dom
+		changedDom.Records = nil
+		current := map[string]bool{}
+		for _, records := range groupRecords(dom.Records) {
+			key := recordSetKey(records[0].Name, records[0].Type)
+			current[key] = true
+			if hash, ok := oldSets[key]; !ok || hash != recordsHash(records) {
+				changedDom.Records = append(changedDom.Records, records...)
+				n++
+			}
+		}
+		for _, records := range groupRecords(oldDom.Records) {
+			name, typ := records[0].Name, records[0].Type
+			if !current[recordSetKey(name, typ)] && !replaced(dom, name, typ) {
+				changedDom.Deleted = append(changedDom.Deleted, noData{Name: name, Type: typ})
+				n++
+			}
+		}
+		n += len(changedDom.NoData)
+		if changedDom.hasChecks() {
+			out = append(out, changedDom)
+		}
+	}
+	return out, n
+}
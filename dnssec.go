@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rsaKeyBits returns the modulus size of an RSA DNSKEY (RFC 3110).
+func rsaKeyBits(key *dns.DNSKEY) (int, error) {
+	buf, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) < 3 {
+		return 0, fmt.Errorf("key too short")
+	}
+
+	expLen, off := int(buf[0]), 1
+	if expLen == 0 {
+		expLen, off = int(buf[1])<<8|int(buf[2]), 3
+	}
+	if off+expLen >= len(buf) {
+		return 0, fmt.Errorf("malformed RSA key")
+	}
+	return new(big.Int).SetBytes(buf[off+expLen:]).BitLen(), nil
+}
+
+func isRSA(alg uint8) bool {
+	switch alg {
+	case dns.RSAMD5, dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		return true
+	}
+	return false
+}
+
+// dnssecQuery queries the resolver with the DO bit set so that signatures
+// are included.
+func (c *checker) dnssecQuery(ns string, name string, qtype uint16) (*dns.Msg, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.SetEdns0(4096, true)
+
+	resp, _, err := c.transports.exchange(m, ns)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, rcodeError(resp.Rcode)
+	}
+	return resp, nil
+}
+
+// dnssecIssues checks the zone's keys and the signatures over DNSKEY and SOA
+// RRsets against the policy. An unsigned zone has no issues.
+func (c *checker) dnssecIssues(ns string, zone string, p *dnssecPolicy, now time.Time) ([]string, error) {
+	forbidden := map[uint8]bool{}
+	for _, alg := range p.ForbiddenAlgorithms {
+		forbidden[dns.StringToAlgorithm[strings.ToUpper(alg)]] = true
+	}
+
+	var issues []string
+
+	keysResp, err := c.dnssecQuery(ns, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, fmt.Errorf("DNSKEY query failed: %w", err)
+	}
+	var signed bool
+	for _, rr := range keysResp.Answer {
+		key, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			continue
+		}
+		signed = true
+		desc := fmt.Sprintf("key %d (%s)", key.KeyTag(), dns.AlgorithmToString[key.Algorithm])
+
+		if forbidden[key.Algorithm] {
+			issues = append(issues, fmt.Sprintf("%s uses a forbidden algorithm", desc))
+		}
+		if isRSA(key.Algorithm) {
+			bits, err := rsaKeyBits(key)
+			switch {
+			case err != nil:
+				issues = append(issues, fmt.Sprintf("%s: %v", desc, err))
+			case bits < p.MinRSABits:
+				issues = append(issues, fmt.Sprintf("%s is %d bits, expected at least %d", desc, bits, p.MinRSABits))
+			}
+		}
+	}
+	if !signed {
+		return nil, nil
+	}
+
+	soaResp, err := c.dnssecQuery(ns, zone, dns.TypeSOA)
+	if err != nil {
+		return nil, fmt.Errorf("SOA query failed: %w", err)
+	}
+
+	minValidity := time.Duration(p.MinSignatureValidity)
+	for _, resp := range []*dns.Msg{keysResp, soaResp} {
+		var sigs int
+		for _, rr := range resp.Answer {
+			sig, ok := rr.(*dns.RRSIG)
+			if !ok {
+				continue
+			}
+			sigs++
+
+			desc := fmt.Sprintf("%s signature by key %d", dns.TypeToString[sig.TypeCovered], sig.KeyTag)
+			inception := time.Unix(int64(sig.Inception), 0)
+			expiration := time.Unix(int64(sig.Expiration), 0)
+			switch {
+			case now.Before(inception):
+				issues = append(issues, fmt.Sprintf("%s is not valid until %s", desc, inception.UTC().Format(time.RFC3339)))
+			case !now.Before(expiration):
+				issues = append(issues, fmt.Sprintf("%s expired at %s", desc, expiration.UTC().Format(time.RFC3339)))
+			case expiration.Sub(now) < minValidity:
+				issues = append(issues, fmt.Sprintf("%s expires at %s, in less than %s", desc, expiration.UTC().Format(time.RFC3339), minValidity))
+			}
+		}
+		if sigs == 0 {
+			issues = append(issues, fmt.Sprintf("no signatures over %s", dns.TypeToString[resp.Question[0].Qtype]))
+		}
+	}
+	return issues, nil
+}
+
+// runDNSSECChecks checks every domain against the DNSSEC policy via the
+// first resolver.
+func runDNSSECChecks(domains []domain, opts runOptions, p *dnssecPolicy) []checkResult {
+	c := newChecker(opts)
+	ns := opts.resolvers[0]
+
+	var results []checkResult
+	for _, dom := range domains {
+		cr := checkResult{Domain: dom.Name, Name: dom.Name, Type: "DNSKEY", NS: ns}
+
+		issues, err := c.dnssecIssues(ns, dom.Name, p, time.Now())
+		if err != nil {
+			cr.Err = err
+		} else if len(issues) > 0 {
+			cr.Err = codedErrorf(codeDNSSECPolicy, "DNSSEC policy violations: %s", strings.Join(issues, "; "))
+		}
+
+		printProgress(cr.Err)
+		results = append(results, cr)
+	}
+	return results
+}
@@ -0,0 +1,123 @@
+//go:build e2e
+
+package main
+
+// End-to-end tests of a release against a real DNS provider and resolvers,
+// in a zone dedicated to them:
+//
+//	CONTROL_E2E_ZONE=e2e.example.com CONTROL_E2E_PUBLISH=./publish.sh go test -tags e2e -run E2E -timeout 30m
+//
+// CONTROL_E2E_PUBLISH is run with sh and must publish a TXT record with the
+// value of $CONTROL_E2E_VALUE at $CONTROL_E2E_NAME in the zone, replacing the
+// one published by the previous run, e.g. with dnscontrol push.
+// CONTROL_E2E_NS overrides the resolvers checked on.
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Name of the TXT record published by the tests, relative to the zone
+const e2eName = "_control-e2e"
+
+type e2eEnv struct {
+	zone    string
+	publish string
+	ns      string
+	bin     string
+	dir     string
+}
+
+func newE2EEnv(t *testing.T) *e2eEnv {
+	zone, publish := os.Getenv("CONTROL_E2E_ZONE"), os.Getenv("CONTROL_E2E_PUBLISH")
+	if zone == "" || publish == "" {
+		t.Skip("CONTROL_E2E_ZONE and CONTROL_E2E_PUBLISH are not set")
+	}
+	env := &e2eEnv{zone: zone, publish: publish, ns: os.Getenv("CONTROL_E2E_NS"), dir: t.TempDir()}
+
+	env.bin = filepath.Join(env.dir, "control")
+	if out, err := exec.Command("go", "build", "-o", env.bin, ".").CombinedOutput(); err != nil {
+		t.Fatalf("failed to build: %v\n%s", err, out)
+	}
+	return env
+}
+
+// run runs the built binary and returns its output and exit code.
+func (env *e2eEnv) run(t *testing.T, args ...string) (string, int) {
+	if env.ns != "" {
+		args = append(args, "-ns", env.ns)
+	}
+	cmd := exec.Command(env.bin, args...)
+	out, err := cmd.CombinedOutput()
+	t.Logf("control %s\n%s", strings.Join(args, " "), out)
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			t.Fatalf("failed to run control: %v", err)
+		}
+	}
+	return string(out), cmd.ProcessState.ExitCode()
+}
+
+// input writes an input file expecting the TXT record with the value.
+func (env *e2eEnv) input(t *testing.T, value string) string {
+	in := map[string][]domain{"domains": {{
+		Name:    env.zone,
+		Records: []record{{Type: "TXT", Name: e2eName, TTL: 300, Target: value, TXTStrings: []string{value}}},
+	}}}
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(env.dir, value+".json")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func randomValue(t *testing.T) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return "control-e2e-" + hex.EncodeToString(b)
+}
+
+// TestE2EPublishWaitVerify publishes a new value, waits for the serials and
+// then the record to propagate, and checks that another value fails.
+func TestE2EPublishWaitVerify(t *testing.T) {
+	env := newE2EEnv(t)
+	value := randomValue(t)
+
+	publish := exec.Command("sh", "-c", env.publish)
+	publish.Env = append(os.Environ(), "CONTROL_E2E_NAME="+e2eName+"."+env.zone, "CONTROL_E2E_VALUE="+value)
+	if out, err := publish.CombinedOutput(); err != nil {
+		t.Fatalf("failed to publish: %v\n%s", err, out)
+	}
+
+	t.Run("serial-watch", func(t *testing.T) {
+		if _, code := env.run(t, "serial-watch", "-wait", "15m", env.zone); code != 0 {
+			t.Fatalf("serials did not converge, exit code %d", code)
+		}
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		out, code := env.run(t, "-input", env.input(t, value), "-wait", "15m")
+		if code != 0 || !strings.Contains(out, "All checks passed") {
+			t.Fatalf("the published record did not pass, exit code %d", code)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		out, code := env.run(t, "-input", env.input(t, randomValue(t)), "-classify=false")
+		if code != 1 || !strings.Contains(out, codeValueMismatch) {
+			t.Fatalf("expected %s and exit code 1, got exit code %d", codeValueMismatch, code)
+		}
+	})
+}
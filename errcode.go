@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// Failure codes are part of the output format: once released, a code keeps
+// its meaning and is never reused.
+const (
+	codeCountMismatch       = "E_COUNT_MISMATCH"
+	codeTTLExceeded         = "E_TTL_EXCEEDED"
+	codeTTLMismatch         = "E_TTL_MISMATCH"
+	codeAuthTTLMismatch     = "E_AUTH_TTL_MISMATCH"
+	codeNotAuthoritative    = "E_NOT_AUTHORITATIVE"
+	codeValueMismatch       = "E_VALUE_MISMATCH"
+	codeTypeMismatch        = "E_TYPE_MISMATCH"
+	codeUnsupportedType     = "E_UNSUPPORTED_TYPE"
+	codeNXDomain            = "E_NXDOMAIN"
+	codeServFail            = "E_SERVFAIL"
+	codeRefused             = "E_REFUSED"
+	codeRcode               = "E_RCODE"
+	codeEmptyResponse       = "E_EMPTY_RESPONSE"
+	codeTimeout             = "E_TIMEOUT"
+	codeNetwork             = "E_NETWORK"
+	codeTransportMismatch   = "E_TRANSPORT_MISMATCH"
+	codeDNSSECPolicy        = "E_DNSSEC_POLICY"
+	codeTTLPolicy           = "E_TTL_POLICY"
+	codeRuleViolation       = "E_RULE_VIOLATION"
+	codePolicyViolation     = "E_POLICY_VIOLATION"
+	codeDelegationMismatch  = "E_DELEGATION_MISMATCH"
+	codeAdditionalMissing   = "E_ADDITIONAL_MISSING"
+	codeNSUnreachable       = "E_NS_UNREACHABLE"
+	codeExternalServiceFail = "E_EXTERNAL_SERVICE"
+	codeProviderMismatch    = "E_PROVIDER_MISMATCH"
+	codeDanglingTarget      = "E_DANGLING_TARGET"
+	codeIllegalRecord       = "E_ILLEGAL_RECORD"
+	codeApexMissing         = "E_APEX_MISSING"
+	codeMailMisaligned      = "E_MAIL_MISALIGNED"
+	codeDomainTimeout       = "E_DOMAIN_TIMEOUT"
+	codeNoData              = "E_NODATA"
+	codeWildcardMasked      = "E_WILDCARD_MASKED"
+	codeRedirectMismatch    = "E_REDIRECT_MISMATCH"
+	codeHTTPFailed          = "E_HTTP_FAILED"
+	codeFlagsMismatch       = "E_FLAGS_MISMATCH"
+	codeOrderMismatch       = "E_ORDER_MISMATCH"
+	codePoolMemberMissing   = "E_POOL_MEMBER_MISSING"
+	codeNotDelegated        = "E_NOT_DELEGATED"
+	codeChallengeBroken     = "E_CHALLENGE_BROKEN"
+	codeNegativeTTLExceeded = "E_NEGATIVE_TTL_EXCEEDED"
+	codeUnknown             = "E_UNKNOWN"
+)
+
+// codedError attaches a failure code to an error.
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+func withCode(code string, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+func codedErrorf(code string, format string, args ...any) error {
+	return withCode(code, fmt.Errorf(format, args...))
+}
+
+// rcodeError returns the error for a response with a non-success rcode.
+func rcodeError(rcode int) error {
+	code := codeRcode
+	switch rcode {
+	case dns.RcodeNameError:
+		code = codeNXDomain
+	case dns.RcodeServerFailure:
+		code = codeServFail
+	case dns.RcodeRefused:
+		code = codeRefused
+	}
+	return codedErrorf(code, "non-success response %s", dns.RcodeToString[rcode])
+}
+
+// errorCode returns the failure code of an error, or "" for nil.
+func errorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	if isTimeout(err) {
+		return codeTimeout
+	}
+	if errors.As(err, new(net.Error)) {
+		return codeNetwork
+	}
+	return codeUnknown
+}
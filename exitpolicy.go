@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// What a failure does to the exit code of a run
+const (
+	failureFail = "fail"
+	failureWarn = "warn"
+)
+
+// failureAction decides whether failures with a code fail the run, set per
+// code in the config.
+type failureAction struct {
+	Action string `json:"action"`
+	// With fail, only fail if more than this share of the checks fail with
+	// the code, warn otherwise
+	AboveShare float64 `json:"above_share"`
+}
+
+func (a *failureAction) validate(code string) error {
+	if !strings.HasPrefix(code, "E_") {
+		return fmt.Errorf("unknown failure code %s", code)
+	}
+	switch a.Action {
+	case "":
+		a.Action = failureFail
+	case failureFail:
+	case failureWarn:
+		if a.AboveShare != 0 {
+			return fmt.Errorf("above_share of %s only applies to fail", code)
+		}
+	default:
+		return fmt.Errorf("unknown action %q of %s, expected fail or warn", a.Action, code)
+	}
+	if a.AboveShare < 0 || a.AboveShare >= 1 {
+		return fmt.Errorf("above_share of %s must be at least 0 and below 1", code)
+	}
+	return nil
+}
+
+// blockingFailures returns the failures that fail the run according to the
+// actions by code, and the number of the others by code. Codes without an
+// action fail, except in the warning domains.
+func blockingFailures(res *runResult, actions map[string]failureAction, warning map[string]bool) ([]checkResult, map[string]int) {
+	failures := res.failures()
+	byCode := map[string]int{}
+	for _, r := range failures {
+		byCode[errorCode(r.Err)]++
+	}
+
+	var blocking []checkResult
+	warned := map[string]int{}
+	for _, r := range failures {
+		code := errorCode(r.Err)
+		a, ok := actions[code]
+		switch {
+		case warning[r.Domain]:
+			warned[code]++
+		case !ok:
+			blocking = append(blocking, r)
+		case a.Action == failureWarn:
+			warned[code]++
+		case float64(byCode[code]) > a.AboveShare*float64(len(res.Results)):
+			blocking = append(blocking, r)
+		default:
+			warned[code]++
+		}
+	}
+	return blocking, warned
+}
+
+// printWarnedFailures lists the failures that did not fail the run by code.
+func printWarnedFailures(w io.Writer, warned map[string]int) {
+	if len(warned) == 0 {
+		return
+	}
+	var codes []string
+	for code, n := range warned {
+		codes = append(codes, fmt.Sprintf("%s (%d)", code, n))
+	}
+	sort.Strings(codes)
+	fmt.Fprintf(w, "\nFailures only warned about by the config or verify_severity: %s\n", strings.Join(codes, ", "))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// expectation lists the answers acceptable for a record set.
+type expectation struct {
+	// Relative name and type of the record set
+	name string
+	typ  string
+	// Records from the input, none for an empty answer
+	records []record
+	// Other acceptable answers, e.g. for weighted or failover routing
+	alternatives [][]record
+	// Answer from before a migration, nil if there is none in progress
+	old []record
+	// Record set was deleted, NXDOMAIN is acceptable as well as an empty
+	// answer
+	absent bool
+	// Served through the proxy of the DNS provider, any address of the
+	// proxy is acceptable
+	proxied bool
+	// How answers are compared with the records
+	compare compareOptions
+	// Order answers must be in, any if empty
+	order string
+	// -ttl-mode of the domain
+	ttlMode string
+	// Records answers may have besides the expected ones, as they are
+	// managed elsewhere
+	unmanaged []unmanagedPattern
+	// Priority class, records of higher ones are checked first
+	priority string
+	// Maximal negative caching TTL of empty answers, not checked if 0
+	negativeTTL int
+	// DNS class of the records, IN if 0
+	class uint16
+}
+
+func (e expectation) qclass() uint16 {
+	if e.class == 0 {
+		return dns.ClassINET
+	}
+	return e.class
+}
+
+// alternative lists answers other than the expected records that are
+// acceptable for a record set, for routing policies where the resolver
+// legitimately returns different answers over time.
+type alternative struct {
+	Name string
+	Type string
+	// Each set is a complete answer, name and type are taken from the
+	// alternative
+	Sets [][]record
+}
+
+// noData names a record set that exists, but has no records of the type,
+// e.g. an AAAA of a host with only an A record. The answer has to be an
+// empty NOERROR rather than NXDOMAIN. Deleted record sets are listed the
+// same way, with NXDOMAIN acceptable too.
+type noData struct {
+	Name string
+	Type string
+	// Longest time resolvers may cache the absence for, not checked if 0.
+	// Long negative caching delays adding the records later.
+	NegativeTTL int
+}
+
+// completeRecords fills in the name and type of the records in an answer
+// set from the record set they replace, as well as the TTL if not given.
+func completeRecords(set []record, records []record) []record {
+	out := make([]record, len(set))
+	for i, r := range set {
+		r.Name, r.Type = records[0].Name, records[0].Type
+		if r.TTL == 0 {
+			r.TTL = records[0].TTL
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// expectationFor returns the answers acceptable for a record set of the
+// domain at the given time.
+func (d domain) expectationFor(records []record, now time.Time) expectation {
+	exp := expectation{
+		name:    records[0].Name,
+		typ:     records[0].Type,
+		records: records,
+		old:     d.oldRecords(records, now),
+		proxied: records[0].proxied(),
+		class:   recordClass(records[0].Class),
+	}
+	for _, a := range d.Alternatives {
+		if a.Name != records[0].Name || !strings.EqualFold(a.Type, records[0].Type) {
+			continue
+		}
+		for _, set := range a.Sets {
+			exp.alternatives = append(exp.alternatives, completeRecords(set, records))
+		}
+	}
+	return exp
+}
+
+// expectations returns the expectations for every record set of the domain
+// to check at the given time: the records, then the empty answers, then the
+// deleted record sets. Record sets proxied by the DNS provider are given by
+// providerKey.
+func (d domain) expectations(now time.Time, proxied map[string]bool) []expectation {
+	var exps []expectation
+	for _, records := range groupRecords(d.Records) {
+		exp := d.expectationFor(records, now)
+		if proxied[providerKey(absolutize(d.Name, records[0].Name), records[0].Type)] {
+			exp.proxied = true
+		}
+		exps = append(exps, exp)
+	}
+	for _, nd := range d.NoData {
+		exps = append(exps, expectation{name: nd.Name, typ: strings.ToUpper(nd.Type), negativeTTL: nd.NegativeTTL})
+	}
+	for _, nd := range d.Deleted {
+		exps = append(exps, expectation{name: nd.Name, typ: strings.ToUpper(nd.Type), absent: true, negativeTTL: nd.NegativeTTL})
+	}
+	for i := range exps {
+		exps[i].unmanaged = d.unmanagedFor(exps[i].name, exps[i].typ)
+		exps[i].priority = d.priorityOf(exps[i].records)
+	}
+	return exps
+}
+
+// verify checks that the answer matches the expected records or one of the
+// alternatives, or, during a migration, the old ones. It reports whether the
+// old ones matched. The error describes the mismatch with the expected
+// records.
+func (e expectation) verify(resp *dns.Msg) (bool, error) {
+	if e.proxied {
+		return false, verifyProxied(resp, e.typ)
+	}
+	resp = e.compare.answer(withoutUnmanaged(resp, e.typ, e.unmanaged, e.records))
+	err := verifyResponse(resp, e.compare.records(e.records))
+	if err == nil {
+		return false, nil
+	}
+	for _, alt := range e.alternatives {
+		if verifyResponse(resp, e.compare.records(alt)) == nil {
+			return false, nil
+		}
+	}
+	if len(e.old) > 0 && verifyResponse(resp, e.compare.records(e.old)) == nil {
+		return true, nil
+	}
+	if len(e.alternatives) > 0 {
+		return false, fmt.Errorf("%w, nor any of %d alternative answers", err, len(e.alternatives))
+	}
+	return false, err
+}
+
+// verifyProxied checks the answer for a record set served through the proxy
+// of the DNS provider. Resolvers get the addresses of the proxy rather than
+// the configured ones, so any address will do.
+func verifyProxied(resp *dns.Msg, typ string) error {
+	if typ != "A" && typ != "AAAA" {
+		return nil
+	}
+	for _, rr := range resp.Answer {
+		if dns.TypeToString[rr.Header().Rrtype] == typ {
+			return nil
+		}
+	}
+	return codedErrorf(codeCountMismatch, "expected %s records of the proxy, got none", typ)
+}
+
+// hasChecks returns whether the domain has any record sets to check.
+func (d domain) hasChecks() bool {
+	return len(d.Records) > 0 || len(d.NoData) > 0 || len(d.Deleted) > 0
+}
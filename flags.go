@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Header flags of answers -require-flags can require, e.g. RA from a
+// recursive resolver or AD from a validating one
+var responseFlags = map[string]func(h dns.MsgHdr) bool{
+	"AA": func(h dns.MsgHdr) bool { return h.Authoritative },
+	"RA": func(h dns.MsgHdr) bool { return h.RecursionAvailable },
+	"AD": func(h dns.MsgHdr) bool { return h.AuthenticatedData },
+}
+
+func validateRequiredFlags(flags []string) error {
+	for _, f := range flags {
+		if responseFlags[f] == nil {
+			return fmt.Errorf("unknown response flag %s, expected AA, RA or AD", f)
+		}
+	}
+	return nil
+}
+
+// requiresFlag returns whether the flag, in upper case, is required.
+func requiresFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFlags checks that the response has all the flags set.
+func checkFlags(resp *dns.Msg, flags []string) error {
+	var missing []string
+	for _, f := range flags {
+		if !responseFlags[f](resp.MsgHdr) {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) > 0 {
+		return codedErrorf(codeFlagsMismatch, "expected the %s flags set in the answer", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// geoMatrix lists the answers expected for a geo-routed record set from
+// each region, identified by an EDNS Client Subnet (RFC 7871).
+type geoMatrix struct {
+	Name    string
+	Type    string
+	Regions []geoRegion
+}
+
+type geoRegion struct {
+	Name string
+	// Client subnet to query with, e.g. 203.0.113.0/24
+	Subnet string
+	// Answer expected in the region, name and type are taken from the matrix
+	Records []record
+}
+
+func (r geoRegion) label() string {
+	return fmt.Sprintf("%s (%s)", r.Name, r.Subnet)
+}
+
+// subnetOption returns the ECS option for the region's subnet.
+func (r geoRegion) subnetOption() (*dns.EDNS0_SUBNET, error) {
+	_, ipnet, err := net.ParseCIDR(r.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("region %s: %w", r.Name, err)
+	}
+	ones, _ := ipnet.Mask.Size()
+	opt := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, SourceNetmask: uint8(ones), Address: ipnet.IP}
+	if ip4 := ipnet.IP.To4(); ip4 != nil {
+		opt.Family, opt.Address = 1, ip4
+	} else {
+		opt.Family = 2
+	}
+	return opt, nil
+}
+
+// geoQuery queries the resolver as if from the client subnet.
+func (c *checker) geoQuery(ns string, name string, queryType string, subnet *dns.EDNS0_SUBNET) (*dns.Msg, string, error) {
+	if c.err != nil {
+		return nil, "", c.err
+	}
+
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(name), dns.StringToType[queryType])
+	m.SetEdns0(1232, false)
+	opt := m.IsEdns0()
+	opt.Option = append(opt.Option, subnet)
+
+	resp, transport, err := c.transports.exchange(m, ns)
+	if err != nil {
+		return nil, transport, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return resp, transport, rcodeError(resp.Rcode)
+	}
+	return resp, transport, nil
+}
+
+// answerValues formats the answer records without their headers.
+func answerValues(resp *dns.Msg) string {
+	if resp == nil {
+		return "no response"
+	}
+	var values []string
+	for _, rr := range resp.Answer {
+		values = append(values, strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String())))
+	}
+	sort.Strings(values)
+	if len(values) == 0 {
+		return "empty answer"
+	}
+	return strings.Join(values, ", ")
+}
+
+// responseScope returns the ECS scope prefix length of the response, or -1
+// if the resolver did not return one.
+func responseScope(resp *dns.Msg) int {
+	if resp == nil {
+		return -1
+	}
+	if opt := resp.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if sn, ok := o.(*dns.EDNS0_SUBNET); ok {
+				return int(sn.SourceScope)
+			}
+		}
+	}
+	return -1
+}
+
+// runGeoChecks queries every geo-routed record set from each region of
+// its matrix on every resolver, and prints which regions see which answers.
+func runGeoChecks(domains []domain, opts runOptions) []checkResult {
+	c := newChecker(opts)
+
+	var results []checkResult
+	var matrix strings.Builder
+	for _, dom := range domains {
+		for _, gm := range dom.Geo {
+			name := absolutize(dom.Name, gm.Name)
+			typ := strings.ToUpper(gm.Type)
+			fmt.Fprintf(&matrix, "\n%s %s:\n", typ, name)
+
+			for _, region := range gm.Regions {
+				// Resolvers return decremented TTLs, only values matter here
+				records := completeRecords(region.Records, []record{{Name: gm.Name, Type: typ, TTL: math.MaxInt32}})
+				subnet, subnetErr := region.subnetOption()
+
+				for _, ns := range opts.resolvers {
+					cr := checkResult{Domain: dom.Name, Name: name, Type: typ, NS: ns + " from " + region.label()}
+					switch {
+					case subnetErr != nil:
+						cr.Err = subnetErr
+					case len(records) == 0:
+						cr.Err = fmt.Errorf("region %s has no expected records", region.Name)
+					default:
+						cr.Response, cr.Transport, cr.Err = c.geoQuery(ns, name, typ, subnet)
+						if cr.Err == nil {
+							cr.Err = verifyResponse(cr.Response, records)
+						}
+					}
+					printProgress(cr.Err)
+					results = append(results, cr)
+
+					fmt.Fprintf(&matrix, "  %s at %s: %s", region.label(), ns, answerValues(cr.Response))
+					if scope := responseScope(cr.Response); scope == 0 {
+						fmt.Fprint(&matrix, " (ECS ignored)")
+					}
+					if cr.Err != nil {
+						fmt.Fprint(&matrix, " — unexpected")
+					}
+					fmt.Fprintln(&matrix)
+				}
+			}
+		}
+	}
+
+	if matrix.Len() > 0 {
+		fmt.Printf("\n\nGeo answers per region:\n%s", matrix.String())
+	}
+	return results
+}
+
+// hasGeo reports whether any of the domains has a geo matrix.
+func hasGeo(domains []domain) bool {
+	for _, dom := range domains {
+		if len(dom.Geo) > 0 {
+			return true
+		}
+	}
+	return false
+}
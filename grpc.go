@@ -0,0 +1,144 @@
+package main
+
+//go:generate protoc -I proto --go_out=. --go_opt=module=github.com/dottedmag/control --go-grpc_out=. --go-grpc_opt=module=github.com/dottedmag/control control.proto
+
+import (
+	"context"
+	"time"
+
+	"github.com/dottedmag/control/controlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type grpcServer struct {
+	controlpb.UnimplementedControlServer
+
+	daemons []*daemon
+}
+
+func domainFromProto(pd *controlpb.Domain) domain {
+	dom := domain{Name: pd.Name}
+	for _, pr := range pd.Records {
+		dom.Records = append(dom.Records, record{
+			Type:         pr.Type,
+			Name:         pr.Name,
+			TTL:          int(pr.Ttl),
+			Target:       pr.Target,
+			CAATag:       pr.CaaTag,
+			MXPreference: int(pr.MxPreference),
+			SRVPriority:  int(pr.SrvPriority),
+			SRVWeight:    int(pr.SrvWeight),
+			SRVPort:      int(pr.SrvPort),
+			TXTStrings:   pr.TxtStrings,
+		})
+	}
+	return dom
+}
+
+func runResultToProto(res *runResult) *controlpb.CheckZoneResponse {
+	resp := &controlpb.CheckZoneResponse{
+		Started:  timestamppb.New(res.Started),
+		Finished: timestamppb.New(res.Finished),
+		Checks:   uint32(len(res.Results)),
+		Failed:   uint32(len(res.failures())),
+	}
+	for _, cr := range res.Results {
+		pr := &controlpb.CheckResult{
+			Domain:   cr.Domain,
+			Name:     cr.Name,
+			Type:     cr.Type,
+			Resolver: cr.NS,
+		}
+		if cr.Err != nil {
+			pr.Error = cr.Err.Error()
+			pr.ErrorCode = errorCode(cr.Err)
+		} else {
+			resp.Passed++
+		}
+		if cr.Outvoted {
+			pr.Outvoted = true
+			resp.Outvoted++
+		}
+		resp.Results = append(resp.Results, pr)
+	}
+	return resp
+}
+
+func (s *grpcServer) prepare(req *controlpb.CheckZoneRequest) ([]domain, *daemon, runOptions, error) {
+	cr := checkRequest{Zone: req.GetZone(), Resolvers: req.Resolvers}
+	if pd := req.GetDomain(); pd != nil {
+		cr.Domains = []domain{domainFromProto(pd)}
+	}
+
+	d := daemonFor(s.daemons, cr.Zone)
+	domains, err := d.domainsForRequest(cr)
+	if err != nil {
+		return nil, nil, runOptions{}, grpcstatus.Error(codes.InvalidArgument, err.Error())
+	}
+	opts, err := d.requestOptions(cr.Resolvers, domains)
+	if err != nil {
+		return nil, nil, runOptions{}, grpcstatus.Error(codes.PermissionDenied, err.Error())
+	}
+	return domains, d, opts, nil
+}
+
+func (s *grpcServer) CheckZone(ctx context.Context, req *controlpb.CheckZoneRequest) (*controlpb.CheckZoneResponse, error) {
+	domains, _, opts, err := s.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := runChecks(ctx, domains, opts)
+	if err != nil {
+		return nil, runError(err)
+	}
+	return runResultToProto(res), nil
+}
+
+// runError converts an error from runChecks into a gRPC status.
+func runError(err error) error {
+	if st := grpcstatus.FromContextError(err); st.Code() != codes.Unknown {
+		return st.Err()
+	}
+	return grpcstatus.Error(codes.Internal, err.Error())
+}
+
+func (s *grpcServer) WatchZone(req *controlpb.WatchZoneRequest, stream controlpb.Control_WatchZoneServer) error {
+	if req.Check == nil {
+		return grpcstatus.Error(codes.InvalidArgument, "check must be specified")
+	}
+	domains, d, opts, err := s.prepare(req.Check)
+	if err != nil {
+		return err
+	}
+	interval := d.settings().interval
+	if req.Interval != nil {
+		if interval = req.Interval.AsDuration(); interval <= 0 {
+			return grpcstatus.Error(codes.InvalidArgument, "interval must be positive")
+		}
+	}
+
+	for {
+		res, err := runChecks(stream.Context(), domains, opts)
+		if err != nil {
+			return runError(err)
+		}
+		if err := stream.Send(runResultToProto(res)); err != nil {
+			return err
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func newGRPCServer(daemons []*daemon) *grpc.Server {
+	srv := grpc.NewServer()
+	controlpb.RegisterControlServer(srv, &grpcServer{daemons: daemons})
+	return srv
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Delay before also querying the next address of a resolver given by name if
+// the previous ones have not answered (RFC 8305, section 5)
+const attemptDelay = 250 * time.Millisecond
+
+// resolverHosts resolves resolvers given by name to their addresses and
+// remembers which one answered last.
+type resolverHosts struct {
+	mu sync.Mutex
+	// Addresses by host:port of the resolver, as ip:port
+	addrs map[string][]string
+	// Address that answered last by host:port of the resolver
+	preferred map[string]string
+}
+
+func newResolverHosts() *resolverHosts {
+	return &resolverHosts{addrs: map[string][]string{}, preferred: map[string]string{}}
+}
+
+// resolve returns the addresses to query the resolver at, IPv6 and IPv4
+// interleaved starting with IPv6 (RFC 8305, section 4), the one answering
+// last first. Addresses with an IP are returned as they are.
+func (h *resolverHosts) resolve(server string, timeout time.Duration) ([]string, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return []string{server}, nil
+	}
+
+	h.mu.Lock()
+	addrs, ok := h.addrs[server]
+	h.mu.Unlock()
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve resolver %s: %w", host, err)
+		}
+		var v6, v4 []string
+		for _, ip := range ips {
+			if ip.IP.To4() == nil {
+				v6 = append(v6, net.JoinHostPort(ip.String(), port))
+			} else {
+				v4 = append(v4, net.JoinHostPort(ip.String(), port))
+			}
+		}
+		for i := 0; i < len(v6) || i < len(v4); i++ {
+			if i < len(v6) {
+				addrs = append(addrs, v6[i])
+			}
+			if i < len(v4) {
+				addrs = append(addrs, v4[i])
+			}
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("resolver %s has no addresses", host)
+		}
+
+		h.mu.Lock()
+		h.addrs[server] = addrs
+		h.mu.Unlock()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	preferred, ok := h.preferred[server]
+	if !ok || preferred == addrs[0] {
+		return addrs, nil
+	}
+	ordered := []string{preferred}
+	for _, a := range addrs {
+		if a != preferred {
+			ordered = append(ordered, a)
+		}
+	}
+	return ordered, nil
+}
+
+func (h *resolverHosts) answered(server string, addr string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.preferred[server] = addr
+}
+
+type racedAnswer struct {
+	addr string
+	resp *dns.Msg
+	err  error
+}
+
+// exchangeRacing sends the query to the addresses of the resolver one after
+// another, without waiting for the previous ones to answer for longer than
+// attemptDelay, or at all once they fail, and returns the first answer.
+func (t *transports) exchangeRacing(transport string, m *dns.Msg, server string, timeout time.Duration) (*dns.Msg, error) {
+	start := time.Now()
+	addrs, err := t.hosts.resolve(server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 1 {
+		return t.exchangeAddr(transport, m, server, addrs[0], timeout)
+	}
+
+	answers := make(chan racedAnswer, len(addrs))
+	next, inFlight := 0, 0
+	launch := func() {
+		addr := addrs[next]
+		next++
+		inFlight++
+		remaining := timeout - time.Since(start)
+		go func() {
+			resp, err := t.exchangeAddr(transport, m, server, addr, remaining)
+			answers <- racedAnswer{addr: addr, resp: resp, err: err}
+		}()
+	}
+
+	launch()
+	delay := time.NewTimer(attemptDelay)
+	defer delay.Stop()
+	for {
+		select {
+		case a := <-answers:
+			inFlight--
+			if a.err == nil {
+				t.hosts.answered(server, a.addr)
+				return a.resp, nil
+			}
+			err = a.err
+			if next < len(addrs) && time.Since(start) < timeout {
+				launch()
+			} else if inFlight == 0 {
+				return nil, err
+			}
+		case <-delay.C:
+			if next < len(addrs) {
+				launch()
+				delay.Reset(attemptDelay)
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historyStore persists the history of the daemons between restarts, so
+// that trends survive deploys.
+type historyStore struct {
+	path string
+
+	mu sync.Mutex
+	// By tenant, "" without tenants
+	Tenants map[string][]historyRun `json:"tenants"`
+}
+
+type historyRun struct {
+	Finished time.Time      `json:"finished"`
+	Checks   []historyCheck `json:"checks"`
+}
+
+type historyCheck struct {
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Class  string `json:"class,omitempty"`
+	NS     string `json:"ns"`
+	Failed bool   `json:"failed,omitempty"`
+}
+
+func loadHistory(path string) (*historyStore, error) {
+	s := &historyStore{path: path, Tenants: map[string][]historyRun{}}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	if s.Tenants == nil {
+		s.Tenants = map[string][]historyRun{}
+	}
+	return s, nil
+}
+
+// restore returns the history of the tenant, oldest first.
+func (s *historyStore) restore(tenant string) []runOutcomes {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var history []runOutcomes
+	for _, run := range s.Tenants[tenant] {
+		o := runOutcomes{Finished: run.Finished, Failed: map[resultKey]bool{}}
+		for _, c := range run.Checks {
+			o.Failed[c.key()] = c.Failed
+		}
+		history = append(history, o)
+	}
+	if len(history) > historySize {
+		history = history[len(history)-historySize:]
+	}
+	return history
+}
+
+// save replaces the history of the tenant and writes the file.
+func (s *historyStore) save(tenant string, history []runOutcomes) error {
+	var runs []historyRun
+	for _, o := range history {
+		run := historyRun{Finished: o.Finished}
+		for k, failed := range o.Failed {
+			run.Checks = append(run.Checks, historyCheck{Domain: k.Domain, Name: k.Name, Type: k.Type, Class: k.Class, NS: k.NS, Failed: failed})
+		}
+		sort.Slice(run.Checks, func(i, j int) bool {
+			return lessKey(run.Checks[i].key(), run.Checks[j].key())
+		})
+		runs = append(runs, run)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Tenants[tenant] = runs
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, b)
+}
+
+func (c historyCheck) key() resultKey {
+	return resultKey{Domain: c.Domain, Name: c.Name, Type: c.Type, Class: c.Class, NS: c.NS}
+}
+
+func lessKey(a, b resultKey) bool {
+	if a.Domain != b.Domain {
+		return a.Domain < b.Domain
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	if a.Type != b.Type {
+		return a.Type < b.Type
+	}
+	if a.Class != b.Class {
+		return a.Class < b.Class
+	}
+	return a.NS < b.NS
+}
+
+// trend is how often a check failed in the retained runs that did it.
+type trend struct {
+	Checks int `json:"checks"`
+	Failed int `json:"failed"`
+	// Finish of the last run the check failed in
+	LastFailed *time.Time `json:"last_failed,omitempty"`
+}
+
+func trendOf(history []runOutcomes, k resultKey) trend {
+	var t trend
+	for _, h := range history {
+		failed, checked := h.Failed[k]
+		if !checked {
+			continue
+		}
+		t.Checks++
+		if failed {
+			t.Failed++
+			finished := h.Finished
+			t.LastFailed = &finished
+		}
+	}
+	return t
+}
+
+func (d *daemon) recentHistory() []runOutcomes {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]runOutcomes(nil), d.history...)
+}
+
+type historyJSON struct {
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Class  string `json:"class,omitempty"`
+	NS     string `json:"ns"`
+	trend
+}
+
+// handleHistory lists the trend of every check of the last run, the
+// flakiest first.
+func (d *daemon) handleHistory(w http.ResponseWriter, r *http.Request) {
+	res := d.lastRun()
+	if res == nil {
+		http.Error(w, "first run has not finished yet", http.StatusServiceUnavailable)
+		return
+	}
+	history := d.recentHistory()
+
+	out := []historyJSON{}
+	for _, cr := range res.Results {
+		out = append(out, historyJSON{Domain: cr.Domain, Name: cr.Name, Type: cr.Type, Class: cr.Class, NS: cr.NS, trend: trendOf(history, checkKey(cr))})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Failed != out[j].Failed {
+			return out[i].Failed > out[j].Failed
+		}
+		return lessKey(resultKey{out[i].Domain, out[i].Name, out[i].Type, out[i].Class, out[i].NS}, resultKey{out[j].Domain, out[j].Name, out[j].Type, out[j].Class, out[j].NS})
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// printTrends notes how often each failed check failed recently, to tell
+// flapping records from ones that just broke.
+func printTrends(w io.Writer, res *runResult, history []runOutcomes) {
+	if len(history) < 2 {
+		return
+	}
+	for _, r := range res.failures() {
+		t := trendOf(history, checkKey(r))
+		fmt.Fprintf(w, "%s %s on %s has failed %d of the last %d checks\n", r.Name, typeLabel(r), r.NS, t.Failed, t.Checks)
+	}
+}
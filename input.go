@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// lineReader remembers where lines start in what has been read through it,
+// to report positions in the input as lines. Only the lines after the offset
+// last passed to forget are kept, so that a document with millions of lines
+// does not take memory for each.
+type lineReader struct {
+	r    io.Reader
+	read int64
+	// Lines ending before the newlines kept
+	forgotten int
+	newlines  []int64 // offsets of '\n'
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			lr.newlines = append(lr.newlines, lr.read+int64(i))
+		}
+	}
+	lr.read += int64(n)
+	return n, err
+}
+
+// line returns the line of the offset, starting from 1. The offset must not
+// be before the one last passed to forget.
+func (lr *lineReader) line(offset int64) int {
+	return lr.forgotten + sort.Search(len(lr.newlines), func(i int) bool { return lr.newlines[i] >= offset }) + 1
+}
+
+// forget drops the lines before the offset, which are no longer asked for.
+func (lr *lineReader) forget(offset int64) {
+	n := sort.Search(len(lr.newlines), func(i int) bool { return lr.newlines[i] >= offset })
+	lr.forgotten += n
+	lr.newlines = append(lr.newlines[:0], lr.newlines[n:]...)
+}
+
+// inputError is a problem at a line of the input.
+type inputError struct {
+	line int
+	msg  string
+}
+
+// inputErrors lists all problems found in the input.
+type inputErrors []inputError
+
+func (e inputErrors) Error() string {
+	var b strings.Builder
+	for i, ie := range e {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "line %d: %s", ie.line, ie.msg)
+	}
+	return b.String()
+}
+
+// Fields of DNSControl print-ir output and of the extensions read by this
+// tool, lowercase. Only checked for unknown ones with -strict-input.
+var (
+	knownDomainFields = fieldSet("name", "registrar", "dnsproviders", "records", "nameservers", "meta", "keepunknown",
+		"unmanaged", "unmanaged_disable_safety_check", "auto_dnssec", "registrarname", "dnsprovidernames", "uniquename", "tag",
+		"migrations", "alternatives", "geo", "nodata", "deleted", "defaultttl")
+	knownRecordFields = fieldSet("type", "name", "subdomain", "target", "ttl", "meta", "filepos", "name_raw", "name_unicode",
+		"mxpreference", "srvpriority", "srvweight", "srvport", "caaflag", "caatag", "dstype", "dsdigesttype", "dsdigest",
+		"dskeytag", "dsalgorithm", "dnskeyflags", "dnskeyprotocol", "dnskeyalgorithm", "dnskeypublickey",
+		"loctype", "locversion", "locsize", "lochorizpre", "locvertpre", "loclatitude", "loclongitude", "localtitude",
+		"naptrorder", "naptrpreference", "naptrflags", "naptrservice", "naptrregexp", "sshfpalgorithm", "sshfpfingerprint",
+		"soambox", "soaserial", "soarefresh", "soaretry", "soaexpire", "soaminttl", "tlsausage", "tlsaselector",
+		"tlsamatchingtype", "txtstrings", "r53_alias", "azure_alias", "svcpriority", "svcparams", "class")
+)
+
+func fieldSet(fields ...string) map[string]bool {
+	set := map[string]bool{}
+	for _, f := range fields {
+		set[f] = true
+	}
+	return set
+}
+
+func unknownFields(obj map[string]json.RawMessage, known map[string]bool) []string {
+	var unknown []string
+	for k := range obj {
+		if !known[strings.ToLower(k)] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// TTL of records without one in DNSControl unless DefaultTTL() is used
+const dnscontrolDefaultTTL = 300
+
+// applyDefaultTTL sets the TTL of the records without one to the default of
+// the domain, like DNSControl does.
+func (d *domain) applyDefaultTTL() {
+	ttl := d.DefaultTTL
+	if ttl <= 0 {
+		ttl = dnscontrolDefaultTTL
+	}
+	for i := range d.Records {
+		if d.Records[i].TTL == 0 {
+			d.Records[i].TTL = ttl
+		}
+	}
+}
+
+// recordProblem returns what is wrong with the record that would make
+// checking it fail in confusing ways, or "" if nothing is.
+func recordProblem(r record) string {
+	switch {
+	case r.Type == "":
+		return "missing type"
+	case r.Name == "":
+		return "missing name"
+	case r.TTL < 0:
+		return fmt.Sprintf("negative TTL %d", r.TTL)
+	case classProblem(r.Class) != "":
+		return classProblem(r.Class)
+	}
+
+	switch r.Type {
+	case "A":
+		if ip := net.ParseIP(r.Target); ip == nil || ip.To4() == nil {
+			return fmt.Sprintf("invalid IPv4 address %q", r.Target)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(r.Target); ip == nil || ip.To4() != nil {
+			return fmt.Sprintf("invalid IPv6 address %q", r.Target)
+		}
+	case "CNAME", "MX", "NS":
+		if _, ok := dns.IsDomainName(r.Target); !ok || r.Target == "" {
+			return fmt.Sprintf("invalid target %q", r.Target)
+		}
+	case "SRV":
+		// "." is the target of SRV records saying the service is not there
+		if _, ok := dns.IsDomainName(r.Target); !ok || r.Target == "" {
+			return fmt.Sprintf("invalid target %q", r.Target)
+		}
+		for _, f := range []struct {
+			name  string
+			value int
+		}{{"srvpriority", r.SRVPriority}, {"srvweight", r.SRVWeight}, {"srvport", r.SRVPort}} {
+			if f.value < 0 || f.value > 65535 {
+				return fmt.Sprintf("%s %d out of range", f.name, f.value)
+			}
+		}
+	case "CAA":
+		if r.CAATag == "" {
+			return "missing caatag"
+		}
+	case "URL", "URL301", "FRAME":
+		return redirectProblem(r.Target)
+	}
+	return ""
+}
+
+// domainProblem is what is wrong with a domain, or with its record of the
+// index if it is not -1.
+type domainProblem struct {
+	record int
+	msg    string
+}
+
+// validateDomain returns the problems of the domain that would make checking
+// it fail in confusing ways.
+func validateDomain(d domain) []domainProblem {
+	var problems []domainProblem
+	if d.Name == "" {
+		problems = append(problems, domainProblem{record: -1, msg: "domain without name"})
+	} else if _, ok := dns.IsDomainName(d.Name); !ok {
+		problems = append(problems, domainProblem{record: -1, msg: fmt.Sprintf("invalid domain name %q", d.Name)})
+	}
+	if d.DefaultTTL < 0 {
+		problems = append(problems, domainProblem{record: -1, msg: fmt.Sprintf("domain %s: negative default TTL %d", d.Name, d.DefaultTTL)})
+	}
+	for i, r := range d.Records {
+		if problem := recordProblem(r); problem != "" {
+			problems = append(problems, domainProblem{record: i, msg: recordLabel(d, i) + ": " + problem})
+		}
+	}
+	return problems
+}
+
+// normalizeDomain validates the domain and, if it has no problems, sets the
+// TTL of its records without one and compiles its unmanaged patterns, the
+// same whichever way it was received.
+func normalizeDomain(d *domain) []domainProblem {
+	problems := validateDomain(*d)
+	if len(problems) == 0 {
+		d.applyDefaultTTL()
+		d.compileUnmanaged()
+	}
+	return problems
+}
+
+// normalizeDomains is normalizeDomain of domains received without lines to
+// report problems at, e.g. over the API or in a DNSCheck resource, leaving
+// the records passed in as they are.
+func normalizeDomains(domains []domain) ([]domain, error) {
+	var out []domain
+	var problems []string
+	for _, d := range domains {
+		d.Records = append([]record(nil), d.Records...)
+		for _, p := range normalizeDomain(&d) {
+			problems = append(problems, p.msg)
+		}
+		out = append(out, d)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid domains: %s", strings.Join(problems, "; "))
+	}
+	return out, nil
+}
+
+// recordLabel names the record of the index in problems of the domain.
+func recordLabel(d domain, i int) string {
+	r := d.Records[i]
+	return fmt.Sprintf("domain %s, record %d (%s)", d.Name, i+1, strings.TrimSpace(r.Type+" "+r.Name))
+}
+
+// decodeDomain reads the next domain from the decoder a field, and a record,
+// at a time, and returns it normalized, see normalizeDomain, or its problems
+// with the lines they are at, the unknown fields included if strict. Lines
+// before the domain are forgotten.
+func decodeDomain(dec *json.Decoder, lr *lineReader, strict bool) (domain, inputErrors, error) {
+	var d domain
+	if err := expectDelim(dec, '{'); err != nil {
+		return d, nil, err
+	}
+	start := dec.InputOffset() - 1
+	line := lr.line(start)
+	lr.forget(start)
+
+	var unknown []domainProblem
+	var recordLines []int
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return d, nil, err
+		}
+		key, _ := tok.(string)
+		// Keys are matched case-insensitively, like json.Unmarshal does
+		if strings.EqualFold(key, "records") {
+			if recordLines, err = decodeRecords(dec, lr, strict, &d, &unknown); err != nil {
+				return d, nil, err
+			}
+			continue
+		}
+		if strict && !knownDomainFields[strings.ToLower(key)] {
+			unknown = append(unknown, domainProblem{record: -1, msg: fmt.Sprintf("unknown field %q", key)})
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return d, nil, err
+		}
+		// Decoded on its own, into the field of the key only
+		k, _ := json.Marshal(key)
+		field := append(append(append([]byte("{"), k...), ':'), raw...)
+		if err := json.Unmarshal(append(field, '}'), &d); err != nil {
+			return d, nil, inputPosition(err, dec.InputOffset()-int64(len(field)), lr)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return d, nil, err
+	}
+
+	var errs inputErrors
+	add := func(p domainProblem) {
+		l := line
+		if p.record >= 0 {
+			l = recordLines[p.record]
+		}
+		errs = append(errs, inputError{line: l, msg: p.msg})
+	}
+	for _, p := range normalizeDomain(&d) {
+		add(p)
+	}
+	for _, p := range unknown {
+		if p.record >= 0 {
+			p.msg = recordLabel(d, p.record) + ": " + p.msg
+		} else {
+			p.msg = fmt.Sprintf("domain %s: %s", d.Name, p.msg)
+		}
+		add(p)
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].line < errs[j].line })
+	return d, errs, nil
+}
+
+// recordJSON is a record of DNSControl print-ir output.
+type recordJSON struct {
+	record
+	// Position in dnsconfig.js
+	FilePos string `json:"filepos"`
+}
+
+// decodeRecords reads the records of the domain one at a time, setting
+// their sources, and returns the line of each. Unknown fields are added to
+// unknown if strict.
+func decodeRecords(dec *json.Decoder, lr *lineReader, strict bool, d *domain, unknown *[]domainProblem) ([]int, error) {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return nil, err
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array of records, got %v", tok)
+	}
+
+	var lines []int
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		offset := dec.InputOffset() - int64(len(raw))
+
+		var r recordJSON
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, inputPosition(err, offset, lr)
+		}
+		line := lr.line(offset)
+		r.record.source = r.FilePos
+		if r.FilePos == "" {
+			r.record.source = fmt.Sprintf("input line %d", line)
+		}
+		if strict {
+			var fields map[string]json.RawMessage
+			if json.Unmarshal(raw, &fields) == nil {
+				for _, f := range unknownFields(fields, knownRecordFields) {
+					*unknown = append(*unknown, domainProblem{record: len(d.Records), msg: fmt.Sprintf("unknown field %q", f)})
+				}
+			}
+		}
+		d.Records = append(d.Records, r.record)
+		lines = append(lines, line)
+		lr.forget(offset)
+	}
+	return lines, expectDelim(dec, ']')
+}
+
+// inputPosition prefixes errors of decoding JSON with the line they occurred
+// at, given the offset of the decoded value.
+func inputPosition(err error, offset int64, lr *lineReader) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return inputErrors{{line: lr.line(offset + syntaxErr.Offset), msg: err.Error()}}
+	case errors.As(err, &typeErr):
+		return inputErrors{{line: lr.line(offset + typeErr.Offset), msg: err.Error()}}
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Canary names of -detect-interception
+const (
+	// Random names under it don't exist, resolvers rewriting NXDOMAIN answer
+	// them anyway
+	canaryZone = "com."
+	// Answered by Akamai with the address the query came from, the one the
+	// resolver sends its queries from
+	whoamiName = "whoami.akamai.net."
+)
+
+// randomLabel returns a label unlikely to exist anywhere.
+func randomLabel() string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 20)
+	for i := range b {
+		b[i] = letters[rand.Intn(len(letters))]
+	}
+	return "control-" + string(b)
+}
+
+// operatorOf returns who runs the resolver, as far as is known: the view it
+// is configured in, the operator of a well-known public resolver, or the
+// resolver itself otherwise.
+func operatorOf(ns string, views resolverViews) string {
+	if view := views[ns]; view != "" {
+		return "view " + view
+	}
+	if p, ok := profileFor(ns); ok {
+		return p.name
+	}
+	return ns
+}
+
+// detectInterception queries canary names through every resolver and
+// returns why the answers of some are not to be trusted: a nonexistent name
+// resolves, or the queries of resolvers of different operators leave from
+// the same address, as they do when a transparent proxy answers for all of
+// them. Resolvers of the same operator commonly share egress addresses.
+func detectInterception(opts runOptions) map[string]string {
+	c := newChecker(opts)
+
+	untrusted := map[string]string{}
+	egress := map[string][]string{}
+	for _, ns := range opts.resolvers {
+		name := randomLabel() + "." + canaryZone
+		if resp, err := c.query(ns, name, "A"); err == nil && len(resp.Answer) > 0 {
+			untrusted[ns] = fmt.Sprintf("nonexistent %s resolves to %s", name, rrValue(resp.Answer[0]))
+		}
+
+		resp, err := c.query(ns, whoamiName, "A")
+		if err != nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, rr := range resp.Answer {
+			if a, ok := rr.(*dns.A); ok && !seen[a.A.String()] {
+				seen[a.A.String()] = true
+				egress[a.A.String()] = append(egress[a.A.String()], ns)
+			}
+		}
+	}
+
+	var addrs []string
+	for addr := range egress {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		resolvers := egress[addr]
+		if len(resolvers) < 2 {
+			continue
+		}
+		for _, ns := range resolvers {
+			var others []string
+			for _, other := range resolvers {
+				if operatorOf(other, opts.views) != operatorOf(ns, opts.views) {
+					others = append(others, other)
+				}
+			}
+			if _, ok := untrusted[ns]; !ok && len(others) > 0 {
+				untrusted[ns] = fmt.Sprintf("queries leave from %s, as do those of %s", addr, strings.Join(others, ", "))
+			}
+		}
+	}
+	return untrusted
+}
+
+// markUntrusted annotates the results of the resolvers with the reason not
+// to trust them.
+func markUntrusted(res *runResult, untrusted map[string]string) {
+	for i, r := range res.Results {
+		if reason, ok := untrusted[r.NS]; ok {
+			res.Results[i].Untrusted = reason
+		}
+	}
+}
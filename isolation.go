@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// domainDeadlines gives every domain its own time to finish a stage of the
+// run in, starting when its first check does, so that a domain whose
+// servers keep timing out can't use up the time of the whole run.
+type domainDeadlines struct {
+	// No deadlines if 0
+	timeout time.Duration
+
+	mu      sync.Mutex
+	started map[string]time.Time
+}
+
+func newDomainDeadlines(timeout time.Duration) *domainDeadlines {
+	return &domainDeadlines{timeout: timeout, started: map[string]time.Time{}}
+}
+
+// allow returns whether checks of the domain may still start.
+func (d *domainDeadlines) allow(domain string) bool {
+	if d.timeout == 0 {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	started, ok := d.started[domain]
+	if !ok {
+		d.started[domain] = time.Now()
+		return true
+	}
+	return time.Since(started) < d.timeout
+}
+
+func (d *domainDeadlines) exceeded() error {
+	return codedErrorf(codeDomainTimeout, "not checked, checks of the domain took longer than %v", d.timeout)
+}
+
+// jobsByDomain returns the indexes of the jobs of every domain, in the order
+// of the domains.
+func jobsByDomain(jobs []checkJob, indexes []int) [][]int {
+	var byDomain [][]int
+	index := map[string]int{}
+	for _, i := range indexes {
+		job := jobs[i]
+		d, ok := index[job.domain]
+		if !ok {
+			d = len(byDomain)
+			index[job.domain] = d
+			byDomain = append(byDomain, nil)
+		}
+		byDomain[d] = append(byDomain[d], i)
+	}
+	return byDomain
+}
+
+// domainShare returns how many checks of a single domain may be in flight.
+// With -domain-timeout every domain gets an equal share of the parallelism,
+// so that the checks of a slow domain can't keep those of the others
+// waiting.
+func (o runOptions) domainShare(domains int) int {
+	if o.domainTimeout == 0 || domains == 0 {
+		return o.parallelism
+	}
+	share := o.parallelism / domains
+	if share < 1 {
+		share = 1
+	}
+	return share
+}
+
+// printDomainTimeouts lists the domains with checks not run because of
+// -domain-timeout.
+func printDomainTimeouts(w io.Writer, res *runResult) {
+	skipped := map[string]int{}
+	for _, r := range res.Results {
+		if errorCode(r.Err) == codeDomainTimeout {
+			skipped[r.Domain]++
+		}
+	}
+	if len(skipped) == 0 {
+		return
+	}
+	var domains []string
+	for dom, n := range skipped {
+		domains = append(domains, fmt.Sprintf("%s (%d checks)", dom, n))
+	}
+	sort.Strings(domains)
+	fmt.Fprintf(w, "\nChecks not run after -domain-timeout: %s\n", strings.Join(domains, ", "))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// lintDomain returns a failure for every construct of the expected records
+// DNS does not allow: a CNAME at the apex or next to other records (RFC 1034,
+// section 3.6.2, RFC 2181, section 10.1) and more than one SOA. Providers
+// sometimes accept them, and the breakage only shows when resolving.
+func lintDomain(dom domain) []checkResult {
+	apex := dns.CanonicalName(dom.Name)
+	// Record counts by canonical name and type
+	types := map[string]map[string]int{}
+	// Absolute names as in the input, in its order
+	names := map[string]string{}
+	var order []string
+	var soas int
+	for _, r := range dom.Records {
+		name := dns.CanonicalName(absolutize(dom.Name, r.Name))
+		if types[name] == nil {
+			types[name] = map[string]int{}
+			names[name] = absolutize(dom.Name, r.Name)
+			order = append(order, name)
+		}
+		types[name][r.Type]++
+		if r.Type == "SOA" {
+			soas++
+		}
+	}
+
+	var results []checkResult
+	add := func(name string, typ string, format string, args ...any) {
+		results = append(results, checkResult{
+			Domain: dom.Name,
+			Name:   name,
+			Type:   typ,
+			NS:     "lint",
+			Err:    codedErrorf(codeIllegalRecord, format, args...),
+		})
+	}
+	for _, name := range order {
+		cnames := types[name]["CNAME"]
+		if cnames == 0 {
+			continue
+		}
+		if name == apex {
+			add(names[name], "CNAME", "CNAME at the apex, use ALIAS or A records")
+		}
+		if cnames > 1 {
+			add(names[name], "CNAME", "%d CNAMEs, only one is allowed", cnames)
+		}
+		var others []string
+		for typ := range types[name] {
+			if typ != "CNAME" {
+				others = append(others, typ)
+			}
+		}
+		if len(others) > 0 {
+			sort.Strings(others)
+			add(names[name], "CNAME", "CNAME next to %s records", strings.Join(others, ", "))
+		}
+	}
+	if soas > 1 {
+		add(dom.Name, "SOA", "%d SOA records, only one is allowed", soas)
+	}
+	return results
+}
+
+// runLintChecks lints the expected records of the domains without querying
+// anything, returning the problems found.
+func runLintChecks(domains []domain) []checkResult {
+	var results []checkResult
+	for _, dom := range domains {
+		for _, cr := range lintDomain(dom) {
+			printProgress(cr.Err)
+			results = append(results, cr)
+		}
+	}
+	return results
+}
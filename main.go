@@ -1,44 +1,53 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"strings"
-	"sync"
-	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/miekg/dns"
 	"golang.org/x/exp/maps"
+	"golang.org/x/sync/errgroup"
 )
 
 var nss = []string{"8.8.8.8:53", "1.1.1.1:53"}
 
-var failed atomic.Bool
-
-func query(client *dns.Client, ns string, name string, queryType string) (*dns.Msg, error) {
+func query(t *transports, ns string, name string, queryType string, class uint16) (*dns.Msg, exchangeInfo, error) {
 	m := &dns.Msg{
 		MsgHdr: dns.MsgHdr{
-			Id:               dns.Id(),
-			RecursionDesired: true,
+			Id:                dns.Id(),
+			RecursionDesired:  true,
+			AuthenticatedData: t.authenticatedData,
 		},
 		Question: []dns.Question{
-			{Name: dns.Fqdn(name), Qtype: dns.StringToType[queryType], Qclass: dns.ClassINET},
+			{Name: dns.Fqdn(name), Qtype: dns.StringToType[queryType], Qclass: class},
 		},
 	}
-	resp, _, err := client.Exchange(m, ns)
+	if t.nsid {
+		addNSID(m)
+	}
+	resp, info, err := t.exchangeReport(m, ns)
 	if err != nil {
-		return nil, err
+		return nil, info, err
 	}
 	if resp == nil {
-		return nil, fmt.Errorf("empty response")
+		return nil, info, codedErrorf(codeEmptyResponse, "empty response")
 	}
 	if resp.Rcode != dns.RcodeSuccess {
-		return nil, fmt.Errorf("non-success response %s", dns.RcodeToString[resp.Rcode])
+		return resp, info, rcodeError(resp.Rcode)
 	}
-	return resp, nil
+	return resp, info, nil
 }
 
 func checkARecord(actualRecords []dns.RR, expectedRecords []record) error {
@@ -51,13 +60,13 @@ func checkARecord(actualRecords []dns.RR, expectedRecords []record) error {
 	for i := 0; i < len(expectedValues); i++ {
 		a, ok := actualRecords[i].(*dns.A)
 		if !ok {
-			return fmt.Errorf("expected A record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
+			return codedErrorf(codeTypeMismatch, "expected A record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
 		}
 		actualValues[a.A.String()] = true
 	}
 
 	if !maps.Equal(expectedValues, actualValues) {
-		return fmt.Errorf("expected values %v, got %v", expectedValues, actualValues)
+		return codedErrorf(codeValueMismatch, "expected values %v, got %v", expectedValues, actualValues)
 	}
 	return nil
 }
@@ -73,13 +82,13 @@ func checkAAAARecord(actualRecords []dns.RR, expectedRecords []record) error {
 	for i := 0; i < len(expectedValues); i++ {
 		aaaa, ok := actualRecords[i].(*dns.AAAA)
 		if !ok {
-			return fmt.Errorf("expected AAAA record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
+			return codedErrorf(codeTypeMismatch, "expected AAAA record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
 		}
 		actualValues[aaaa.AAAA.String()] = true
 	}
 
 	if !maps.Equal(expectedValues, actualValues) {
-		return fmt.Errorf("expected values %v, got %v", expectedValues, actualValues)
+		return codedErrorf(codeValueMismatch, "expected values %v, got %v", expectedValues, actualValues)
 	}
 	return nil
 }
@@ -95,13 +104,13 @@ func checkCNAMERecord(actualRecords []dns.RR, expectedRecords []record) error {
 	for i := 0; i < len(expectedValues); i++ {
 		cname, ok := actualRecords[i].(*dns.CNAME)
 		if !ok {
-			return fmt.Errorf("expected CNAME record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
+			return codedErrorf(codeTypeMismatch, "expected CNAME record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
 		}
 		actualValues[cname.Target] = true
 	}
 
 	if !maps.Equal(expectedValues, actualValues) {
-		return fmt.Errorf("expected values %v, got %v", expectedValues, actualValues)
+		return codedErrorf(codeValueMismatch, "expected values %v, got %v", expectedValues, actualValues)
 	}
 	return nil
 }
@@ -124,7 +133,7 @@ func checkCAARecord(actualRecords []dns.RR, expectedRecords []record) error {
 	for i := 0; i < len(expectedValues); i++ {
 		caaRec, ok := actualRecords[i].(*dns.CAA)
 		if !ok {
-			return fmt.Errorf("expected CAA record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
+			return codedErrorf(codeTypeMismatch, "expected CAA record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
 		}
 		actualValues[caa{
 			tag:   caaRec.Tag,
@@ -133,7 +142,7 @@ func checkCAARecord(actualRecords []dns.RR, expectedRecords []record) error {
 	}
 
 	if !maps.Equal(expectedValues, actualValues) {
-		return fmt.Errorf("expected values %v, got %v", expectedValues, actualValues)
+		return codedErrorf(codeValueMismatch, "expected values %v, got %v", expectedValues, actualValues)
 	}
 	return nil
 }
@@ -156,7 +165,7 @@ func checkMXRecord(actualRecords []dns.RR, expectedRecords []record) error {
 	for i := 0; i < len(expectedValues); i++ {
 		mxRec, ok := actualRecords[i].(*dns.MX)
 		if !ok {
-			return fmt.Errorf("expected MX record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
+			return codedErrorf(codeTypeMismatch, "expected MX record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
 		}
 		actualValues[mx{
 			preference: int(mxRec.Preference),
@@ -165,29 +174,69 @@ func checkMXRecord(actualRecords []dns.RR, expectedRecords []record) error {
 	}
 
 	if !maps.Equal(expectedValues, actualValues) {
-		return fmt.Errorf("expected values %v, got %v", expectedValues, actualValues)
+		return codedErrorf(codeValueMismatch, "expected values %v, got %v", expectedValues, actualValues)
 	}
 	return nil
 }
 
+func checkSRVRecord(actualRecords []dns.RR, expectedRecords []record) error {
+	type srv struct {
+		priority int
+		weight   int
+		port     int
+		target   string
+	}
+	expectedValues := map[srv]bool{}
+
+	for _, expectedValue := range expectedRecords {
+		expectedValues[srv{
+			priority: expectedValue.SRVPriority,
+			weight:   expectedValue.SRVWeight,
+			port:     expectedValue.SRVPort,
+			target:   expectedValue.Target,
+		}] = true
+	}
+
+	actualValues := map[srv]bool{}
+	for i := 0; i < len(expectedValues); i++ {
+		srvRec, ok := actualRecords[i].(*dns.SRV)
+		if !ok {
+			return codedErrorf(codeTypeMismatch, "expected SRV record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
+		}
+		actualValues[srv{
+			priority: int(srvRec.Priority),
+			weight:   int(srvRec.Weight),
+			port:     int(srvRec.Port),
+			target:   srvRec.Target,
+		}] = true
+	}
+
+	if !maps.Equal(expectedValues, actualValues) {
+		return codedErrorf(codeValueMismatch, "expected values %v, got %v", expectedValues, actualValues)
+	}
+	return nil
+}
+
+// checkTXTRecord compares the strings of each TXT record concatenated,
+// providers split long values, e.g. DKIM keys, at different boundaries.
 func checkTXTRecord(actualRecords []dns.RR, expectedRecords []record) error {
 	expectedValues := map[string]bool{}
 
 	for _, expectedValue := range expectedRecords {
-		expectedValues[strings.Join(expectedValue.TXTStrings, "\x00")] = true
+		expectedValues[strings.Join(expectedValue.TXTStrings, "")] = true
 	}
 
 	actualValues := map[string]bool{}
 	for i := 0; i < len(expectedValues); i++ {
 		txtRec, ok := actualRecords[i].(*dns.TXT)
 		if !ok {
-			return fmt.Errorf("expected TXT record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
+			return codedErrorf(codeTypeMismatch, "expected TXT record, got %s", dns.TypeToString[actualRecords[i].Header().Rrtype])
 		}
-		actualValues[strings.Join(txtRec.Txt, "\x00")] = true
+		actualValues[strings.Join(txtRec.Txt, "")] = true
 	}
 
 	if !maps.Equal(expectedValues, actualValues) {
-		return fmt.Errorf("expected values %v, got %v", expectedValues, actualValues)
+		return codedErrorf(codeValueMismatch, "expected values %v, got %v", expectedValues, actualValues)
 	}
 	return nil
 }
@@ -199,7 +248,17 @@ type record struct {
 	Target       string
 	CAATag       string
 	MXPreference int
+	SRVPriority  int
+	SRVWeight    int
+	SRVPort      int
 	TXTStrings   []string
+	// DNS class, IN if empty, CH or HS
+	Class string
+	Meta  map[string]string
+
+	// Where the record is defined: the position in dnsconfig.js from the
+	// filepos field of DNSControl, or the line of the input if it has none
+	source string
 }
 
 func absolutize(domain string, rel string) string {
@@ -210,26 +269,60 @@ func absolutize(domain string, rel string) string {
 	return rel + "." + domain
 }
 
-func doCheckRecord(ns string, domain string, name string, records []record) error {
-	recordType := records[0].Type
-
-	client := &dns.Client{}
-	resp, err := query(client, ns, name, recordType)
+func (c *checker) doCheckRecord(ns string, domain string, name string, exp expectation) (*queryEntry, bool, error) {
+	if isRedirect(exp.typ) && len(exp.records) > 0 {
+		e, err := c.checkRedirect(ns, name, exp)
+		return e, false, err
+	}
+	e := c.lookupClass(ns, name, exp.typ, exp.qclass())
+	if e.err != nil {
+		if exp.absent && errorCode(e.err) == codeNXDomain {
+			return e, false, checkNegativeTTL(e.resp, exp.negativeTTL)
+		}
+		return e, false, c.explainAbsence(ns, domain, name, exp, nil, e.err)
+	}
+	var matchedOld bool
+	var err error
+	if c.sampled(exp) {
+		err = c.checkSamples(ns, name, exp, e.resp)
+	} else {
+		matchedOld, err = exp.verify(e.resp)
+	}
 	if err != nil {
-		return err
+		err = c.explainAbsence(ns, domain, name, exp, e.resp, err)
+	}
+	if err == nil && len(exp.records) == 0 {
+		err = checkNegativeTTL(e.resp, exp.negativeTTL)
 	}
+	if err == nil && exp.ttlMode == ttlModeExact && !exp.proxied {
+		err = checkExactTTL(e.resp, exp.records)
+	}
+	if err == nil {
+		err = checkFlags(e.resp, c.requireFlags)
+	}
+	if err == nil && !matchedOld && !exp.proxied {
+		err = c.checkOrder(ns, name, exp, e.resp)
+	}
+	return e, matchedOld, err
+}
 
+// verifyResponse checks that the answer matches the expected records. No
+// records means an empty NOERROR answer is expected.
+func verifyResponse(resp *dns.Msg, records []record) error {
 	if len(records) != len(resp.Answer) {
-		return fmt.Errorf("expected %d records, got %d", len(records), len(resp.Answer))
+		return codedErrorf(codeCountMismatch, "expected %d records, got %d", len(records), len(resp.Answer))
+	}
+	if len(records) == 0 {
+		return nil
 	}
 
 	for _, answer := range resp.Answer {
 		if answer.Header().Ttl > uint32(records[0].TTL) {
-			return fmt.Errorf("expected ttl %d, got %d", records[0].TTL, answer.Header().Ttl)
+			return codedErrorf(codeTTLExceeded, "expected ttl %d, got %d", records[0].TTL, answer.Header().Ttl)
 		}
 	}
 
-	switch recordType {
+	switch records[0].Type {
 	case "A":
 		return checkARecord(resp.Answer, records)
 	case "AAAA":
@@ -240,73 +333,1372 @@ func doCheckRecord(ns string, domain string, name string, records []record) erro
 		return checkCAARecord(resp.Answer, records)
 	case "MX":
 		return checkMXRecord(resp.Answer, records)
+	case "SRV":
+		return checkSRVRecord(resp.Answer, records)
 	case "TXT":
 		return checkTXTRecord(resp.Answer, records)
 	default:
-		return fmt.Errorf("unknown record type")
+		return codedErrorf(codeUnsupportedType, "unknown record type")
 	}
 }
 
-func checkRecord(wg *sync.WaitGroup, ns string, domain string, records []record) {
-	defer wg.Done()
+// dumpResponse formats the response the way dig does, indented to stand out
+// from the check results.
+func dumpResponse(resp *dns.Msg, transport string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(resp.String(), "\n"), "\n") {
+		if line != "" {
+			b.WriteString("    " + line)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "    ;; TRANSPORT: %s, SIZE: %d\n", transport, resp.Len())
+	return b.String()
+}
 
-	absoluteName := absolutize(domain, records[0].Name)
+func (c *checker) checkRecord(ns string, domain string, exp expectation) checkResult {
+	absoluteName := absolutize(domain, exp.name)
 
-	if err := doCheckRecord(ns, domain, absoluteName, records); err != nil {
-		fmt.Fprintf(os.Stderr, "\n%s %s (at %s): %v\n", records[0].Type, absoluteName, ns, err)
-		failed.Store(true)
-	} else {
-		fmt.Print(".")
+	started := time.Now()
+	e, matchedOld, err := c.doCheckRecord(ns, domain, absoluteName, exp)
+	var instance string
+	if c.nsid {
+		instance = c.instance(ns, e.resp)
+	}
+	return checkResult{
+		Domain:     domain,
+		Name:       absoluteName,
+		Type:       exp.typ,
+		Class:      classLabel(exp.qclass()),
+		NS:         ns,
+		Err:        err,
+		Response:   e.resp,
+		Transport:  e.transport,
+		Truncated:  e.truncated,
+		Instance:   instance,
+		MatchedOld: matchedOld,
+		Size:       responseSize(e.resp),
+		Anomalies:  packetAnomalies(e.resp, c.maxAnswerSize),
+		Timing: &checkTiming{
+			Started:  started,
+			Query:    e.took,
+			Attempts: e.attempts,
+			Shared:   e.sent.Before(started),
+		},
 	}
 }
 
-func main() {
-	records, err := io.ReadAll(os.Stdin)
+type checkResult struct {
+	Domain string
+	Name   string
+	Type   string
+	// CH or HS, empty for IN
+	Class    string
+	NS       string
+	Err      error
+	Response *dns.Msg // nil if no response was received
+	// Transport the response was received over, or the last one tried
+	Transport string
+	// The answer over UDP was truncated and retried over TCP
+	Truncated bool
+	// Resolver instance that answered, with -nsid
+	Instance string
+	// Size of the response in bytes, 0 if none was received
+	Size int
+	// What is unusual about the response, see packetAnomalies
+	Anomalies []string
+	// The check failed, but enough other resolvers passed in quorum mode
+	Outvoted bool
+	// The resolver still serves the values from before a migration
+	MatchedOld bool
+	// Why the check failed according to the authoritative server, e.g.
+	// causeStaleCache
+	Cause string
+	// Team responsible for the record, from the owner meta field
+	Owner string
+	// Where the checked records are defined, e.g. dnsconfig.js:12:5
+	Source string
+	// Name of the view of the resolver in the config
+	View string
+	// Why answers of the resolver are not to be trusted, with
+	// -detect-interception
+	Untrusted string
+	// Where the time of a record check went, nil for other checks
+	Timing *checkTiming
+}
+
+// checkTiming tells when a record check ran, and how long it waited and
+// took.
+type checkTiming struct {
+	Started time.Time
+	// From the start of the run, waiting for other checks and rate limits
+	Queued time.Duration
+	// Until answered, including retries and fallbacks
+	Query time.Duration
+	// Queries sent, more than one if retried or fallen back
+	Attempts int
+	// Answered by the query of another check of the same record set
+	Shared bool
+}
+
+type runResult struct {
+	Started  time.Time
+	Finished time.Time
+	Results  []checkResult
+}
+
+func (r *runResult) failures() []checkResult {
+	var failures []checkResult
+	for _, res := range r.Results {
+		if res.Err != nil && !res.Outvoted {
+			failures = append(failures, res)
+		}
+	}
+	return failures
+}
+
+func (r *runResult) matchedOld() []checkResult {
+	var old []checkResult
+	for _, res := range r.Results {
+		if res.MatchedOld {
+			old = append(old, res)
+		}
+	}
+	return old
+}
+
+func (r *runResult) truncated() []checkResult {
+	var truncated []checkResult
+	for _, res := range r.Results {
+		if res.Truncated {
+			truncated = append(truncated, res)
+		}
+	}
+	return truncated
+}
+
+func (r *runResult) outvoted() []checkResult {
+	var outvoted []checkResult
+	for _, res := range r.Results {
+		if res.Outvoted {
+			outvoted = append(outvoted, res)
+		}
+	}
+	return outvoted
+}
+
+type domain struct {
+	Name        string
+	Records     []record
+	Nameservers []struct {
+		Name string
+	}
+	// Record sets in the middle of a cutover
+	Migrations []migration
+	// Record sets with several acceptable answers
+	Alternatives []alternative
+	// Geo-routed record sets with answers expected per region
+	Geo []geoMatrix
+	// Names that have to exist without records of the type (NODATA)
+	NoData []noData
+	// Record sets that must not exist, NXDOMAIN or NODATA
+	Deleted []noData
+	Meta    map[string]string
+	// TTL of records without one, dnscontrolDefaultTTL if not set
+	DefaultTTL int
+	// Records managed elsewhere, from IGNORE() and NO_PURGE
+	Unmanaged   []unmanagedPattern
+	KeepUnknown bool
+}
+
+// groupRecords splits records into groups sharing name and type, each group
+// being checked by a single query.
+func groupRecords(records []record) [][]record {
+	type nameType struct {
+		name  string
+		typ   string
+		class uint16
+	}
+
+	var groups [][]record
+	groupIndex := map[nameType]int{}
+	for _, record := range records {
+		nt := nameType{name: record.Name, typ: record.Type, class: recordClass(record.Class)}
+		i, ok := groupIndex[nt]
+		if !ok {
+			i = len(groups)
+			groupIndex[nt] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], record)
+	}
+	return groups
+}
+
+// checkJob is a single record set to check on a single resolver, or a
+// check of another pass, run against ns by run instead.
+type checkJob struct {
+	ns     string
+	domain string
+	exp    expectation
+
+	// Fills in the outcome of the check of the pass into what is known of
+	// it beforehand, result
+	run    func(c *checker, r *checkResult)
+	result checkResult
+	// No progress mark, for lookups the pass needs rather than checks
+	quiet bool
+}
+
+// planJobs returns the checks of every record set of the domains on the
+// resolvers the strategy picks for it at the given time.
+func planJobs(domains []domain, opts runOptions, now time.Time) []checkJob {
+	var jobs []checkJob
+	var sets int
+	for _, domain := range domains {
+		jobs = append(jobs, planDomainJobs(domain, opts, now, &sets)...)
+	}
+	return jobs
+}
+
+// planDomainJobs is planJobs of a single domain, counting its record sets
+// in sets, the number of record sets of the run planned before it.
+func planDomainJobs(domain domain, opts runOptions, now time.Time, sets *int) []checkJob {
+	var jobs []checkJob
+	domainOpts := opts.forDomain(domain)
+	for _, exp := range domain.expectations(now, opts.proxied) {
+		exp.compare = opts.typeOverrides[exp.typ].Compare
+		exp.order = opts.typeOverrides[exp.typ].Order
+		exp.ttlMode = domainOpts.ttlMode
+		for _, ns := range domainOpts.resolversFor(*sets) {
+			jobs = append(jobs, checkJob{ns: ns, domain: domain.Name, exp: exp})
+		}
+		*sets++
+	}
+	return jobs
+}
+
+// runChecks checks all record sets, at most opts.parallelism at a time and at
+// most opts.rate queries per second to each resolver. Domains are checked at
+// the same time, with -domain-timeout each within its own deadline and share
+// of the parallelism. An error is returned
+// only if the run could not be completed: the context was cancelled or the
+// queries could not be sent at all.
+func runChecks(ctx context.Context, domains []domain, opts runOptions) (*runResult, error) {
+	res := &runResult{Started: time.Now()}
+	c := newChecker(opts)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	jobs := planJobs(domains, opts, res.Started)
+
+	limiters := newResolverLimiters(opts)
+	deadlines := newDomainDeadlines(opts.domainTimeout)
+	slots := make(chan struct{}, opts.parallelism)
+	res.Results = make([]checkResult, len(jobs))
+	classes := jobsByPriority(jobs)
+	for n, class := range classes {
+		if err := runJobs(ctx, c, jobs, class, res, opts, limiters, deadlines, slots); err != nil {
+			return nil, err
+		}
+		// Jobs are not started after cancellation, so the results are incomplete
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(classes) > 1 && n < len(classes)-1 {
+			printPriorityDone(os.Stdout, res, class, jobs[class[0]].exp.priority)
+		}
+	}
+
+	finishRun(domains, res, opts)
+	return res, nil
+}
+
+// streamChecks is runChecks of the domains read by decode, which passes
+// each to its function as soon as it is read: the record sets of a domain are
+// checked while the rest of the input is read. A record set is only complete
+// at the end of its domain, as its records need not be next to one another.
+// Priorities order the checks of each domain, as those of domains yet to be
+// read are not known. Reading waits while the checks of opts.parallelism
+// domains are in flight. The domains read are returned with the results.
+func streamChecks(ctx context.Context, decode func(func(domain) error) error, opts runOptions) ([]domain, *runResult, error) {
+	res := &runResult{Started: time.Now()}
+	c := newChecker(opts)
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	limiters := newResolverLimiters(opts)
+	deadlines := newDomainDeadlines(opts.domainTimeout)
+	slots := make(chan struct{}, opts.parallelism)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.parallelism)
+
+	var domains []domain
+	var parts []*runResult
+	var sets int
+	err := decode(func(dom domain) error {
+		if err := gctx.Err(); err != nil {
+			return err
+		}
+		jobs := planDomainJobs(dom, opts, res.Started, &sets)
+		var indexes []int
+		for _, class := range jobsByPriority(jobs) {
+			indexes = append(indexes, class...)
+		}
+		part := &runResult{Started: res.Started, Results: make([]checkResult, len(jobs))}
+		domains = append(domains, dom)
+		parts = append(parts, part)
+		g.Go(func() error {
+			return runJobs(gctx, c, jobs, indexes, part, opts, limiters, deadlines, slots)
+		})
+		return nil
+	})
+	if err != nil {
+		// The results of an invalid input are of no use
+		cancel()
+	}
+	if werr := g.Wait(); err == nil {
+		err = werr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, part := range parts {
+		res.Results = append(res.Results, part.Results...)
+	}
+	finishRun(domains, res, opts)
+	return domains, res, nil
+}
+
+// finishRun sets what the results of record checks of the domains tell
+// together: which failures are outvoted, their owners, sources and views.
+func finishRun(domains []domain, res *runResult, opts runOptions) {
+	if opts.strategy == strategyQuorum {
+		quorums := map[string]int{}
+		for _, dom := range domains {
+			quorums[dom.Name] = opts.forDomain(dom).quorumSize()
+		}
+		applyQuorum(res, quorums)
+	}
+	assignOwners(domains, res)
+	assignSources(domains, res)
+	assignViews(res, opts.views)
+
+	res.Finished = time.Now()
+}
+
+// runJobs checks the jobs with the indexes, the domains at the same time,
+// storing the results in res.
+func runJobs(ctx context.Context, c *checker, jobs []checkJob, indexes []int, res *runResult, opts runOptions, limiters *resolverLimiters, deadlines *domainDeadlines, slots chan struct{}) error {
+	byDomain := jobsByDomain(jobs, indexes)
+	share := opts.domainShare(len(byDomain))
+	g, gctx := errgroup.WithContext(ctx)
+	// Bounds the checks waiting for slots as well
+	g.SetLimit(opts.parallelism)
+	for _, indexes := range byDomain {
+		indexes := indexes
+		g.Go(func() error {
+			dg, dctx := errgroup.WithContext(gctx)
+			dg.SetLimit(share)
+			for _, i := range indexes {
+				if dctx.Err() != nil {
+					break
+				}
+				i, job := i, jobs[i]
+				dg.Go(func() error {
+					select {
+					case slots <- struct{}{}:
+					case <-dctx.Done():
+						return dctx.Err()
+					}
+					defer func() { <-slots }()
+
+					if !deadlines.allow(job.domain) {
+						r := checkResult{Domain: job.domain, Name: absolutize(job.domain, job.exp.name), Type: job.exp.typ, NS: job.ns}
+						if job.run != nil {
+							r = job.result
+						}
+						r.Err = deadlines.exceeded()
+						res.Results[i] = r
+						job.done(opts, r)
+						return nil
+					}
+					if err := limiters.get(job.ns).Wait(dctx); err != nil {
+						return err
+					}
+					if job.run != nil {
+						r := job.result
+						job.run(c, &r)
+						res.Results[i] = r
+						job.done(opts, r)
+						return nil
+					}
+					r := c.checkRecord(job.ns, job.domain, job.exp)
+					r.Timing.Queued = r.Timing.Started.Sub(res.Started)
+					res.Results[i] = r
+					opts.resultDone(r)
+					return nil
+				})
+			}
+			return dg.Wait()
+		})
+	}
+	return g.Wait()
+}
+
+// done reports a finished check, only as a progress mark if it is not of a
+// record set: reporters are told about those in the summary.
+func (job checkJob) done(opts runOptions, r checkResult) {
+	switch {
+	case job.quiet:
+	case job.run != nil:
+		printProgress(r.Err)
+	default:
+		opts.resultDone(r)
+	}
+}
+
+// runPass runs the checks of a pass other than that of the record sets, e.g.
+// of targets or authoritative servers, the way runChecks does: at most
+// opts.parallelism at a time, at the rate of the server each one queries and
+// within -domain-timeout for each domain. The results are in the order of the
+// jobs.
+func runPass(c *checker, jobs []checkJob, opts runOptions) []checkResult {
+	res := &runResult{Started: time.Now(), Results: make([]checkResult, len(jobs))}
+	indexes := make([]int, len(jobs))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	// Jobs can only fail by cancellation
+	_ = runJobs(context.Background(), c, jobs, indexes, res, opts, newResolverLimiters(opts), newDomainDeadlines(opts.domainTimeout), make(chan struct{}, opts.parallelism))
+	return res.Results
+}
+
+func parseDNSControl(b []byte) ([]domain, error) {
+	return decodeDNSControl(bytes.NewReader(b), false)
+}
+
+// decodeDNSControl reads DNSControl print-ir output, see
+// decodeDNSControlFunc.
+func decodeDNSControl(r io.Reader, strict bool) ([]domain, error) {
+	var domains []domain
+	err := decodeDNSControlFunc(r, strict, func(d domain) error {
+		domains = append(domains, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// decodeDNSControlFunc reads DNSControl print-ir output a record at a time
+// and passes every domain to fn as soon as it is read, so that neither the
+// document nor a domain is ever held in memory as text, and checks can start
+// before the rest is read. All invalid records are reported, with the lines
+// they are at, after the whole document is read. No domains are passed to fn
+// after the first invalid one. Unknown fields are only reported if strict.
+func decodeDNSControlFunc(r io.Reader, strict bool, fn func(domain) error) error {
+	lr := &lineReader{r: r}
+	dec := json.NewDecoder(lr)
+	if err := decodeDomains(dec, lr, strict, fn); err != nil {
+		return inputPosition(err, 0, lr)
+	}
+	return nil
+}
+
+func decodeDomains(dec *json.Decoder, lr *lineReader, strict bool, fn func(domain) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	var errs inputErrors
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		// Keys are matched case-insensitively, like json.Unmarshal does
+		if key, _ := tok.(string); !strings.EqualFold(key, "domains") {
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil {
+			continue
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("expected an array of domains, got %v", tok)
+		}
+		for dec.More() {
+			d, domainErrs, err := decodeDomain(dec, lr, strict)
+			if err != nil {
+				return err
+			}
+			errs = append(errs, domainErrs...)
+			if len(errs) > 0 {
+				continue
+			}
+			if err := fn(d); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after the end of the document")
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return nil
+}
+
+// skipValue reads the next value without decoding it.
+func skipValue(dec *json.Decoder) error {
+	var depth int
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// exitOnInputError exits if the input could not be read, listing its
+// problems if it is invalid.
+func exitOnInputError(err error, invalid error) {
+	if invalid != nil {
+		fmt.Fprintf(os.Stderr, "Invalid input: %v\n", invalid)
+		os.Exit(1)
+	}
+	var inputErrs inputErrors
+	if errors.As(err, &inputErrs) {
+		fmt.Fprintf(os.Stderr, "Invalid input:\n")
+		for _, ie := range inputErrs {
+			fmt.Fprintf(os.Stderr, "  line %d: %s\n", ie.line, ie.msg)
+		}
+		os.Exit(1)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to read stdin: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
 		os.Exit(1)
 	}
+}
 
-	var data struct {
-		Domains []struct {
-			Name    string
-			Records []record
+// splitList splits a comma-separated flag value, returning nil for an empty one.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check-one":
+			os.Exit(runCheckOne(os.Args[2:]))
+		case "merge":
+			os.Exit(runMerge(os.Args[2:]))
+		case "github-action":
+			os.Exit(runAction(os.Args[2:]))
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		case "serial-watch":
+			os.Exit(runSerialWatch(os.Args[2:]))
+		case "acme":
+			os.Exit(runACME(os.Args[2:]))
+		case "retry":
+			os.Exit(runRetry(os.Args[2:]))
+		}
+	}
+	runCheck(flag.CommandLine, os.Args[1:], nil)
+}
+
+// runCheck checks all records, as the command does without a subcommand,
+// with its flags defined on fs. checkArgs, if set, vets the flags once they
+// are parsed.
+func runCheck(fs *flag.FlagSet, args []string, checkArgs func() error) {
+	classify := fs.Bool("classify", false, "query failed record sets on an authoritative server to tell stale caches from wrong zones")
+	wait := fs.Duration("wait", 0, "re-check failed record sets until they pass or this much time has passed, e.g. right after a push")
+	soak := fs.Duration("soak", 0, "check all records every -soak-interval for this long and report any failures and answer changes seen in between, e.g. during a provider migration")
+	soakInterval := fs.Duration("soak-interval", 10*time.Second, "interval between checks with -soak")
+	waitQuorum := fs.Int("wait-quorum", 0, "with -wait, number of resolvers a record set has to pass on to count as propagated, reporting the rest as stragglers (default: all)")
+	waitInterval := fs.Duration("wait-interval", 15*time.Second, "interval between re-checks with -wait")
+	convergenceJSON := fs.String("convergence-json", "", "with -wait, file to write the time each resolver took to serve the expected records of each record set to as JSON")
+	inputPath := fs.String("input", "", "file to read DNSControl print-ir output from (default: stdin)")
+	expandVars := fs.Bool("expand-vars", false, "substitute ${NAME} in the input with values from -values or the environment, $${NAME} for a literal ${NAME}")
+	valuesPath := fs.String("values", "", "YAML or JSON file mapping names to values for ${NAME} in the input, preferred to the environment (implies -expand-vars)")
+	inputFormat := fs.String("input-format", inputDNSControl, "format of the input: dnscontrol (print-ir output) or yaml (domains, names, types and values)")
+	watchConfig := fs.Bool("watch-config", false, "in daemon mode, reload when the -input or -config file changes, in addition to SIGHUP")
+	daemonMode := fs.Bool("daemon", false, "re-check records periodically and serve health endpoints")
+	listen := fs.String("listen", ":8080", "address to serve health endpoints on in daemon mode")
+	interval := fs.Duration("interval", 5*time.Minute, "interval between checks in daemon mode")
+	historyPath := fs.String("history", "", "in daemon mode, file to keep the outcomes of the last checks in across restarts, for the failure trends in /status and /history")
+	ttlSchedule := fs.Bool("ttl-schedule", false, "in daemon mode, re-check failed record sets as soon as the cached answers expire and passing ones no sooner than that, instead of all of them every -interval")
+	checkAPI := fs.Bool("check-api", false, "serve POST /check in daemon mode, running checks on demand on the resolvers the daemon checks on, for anyone who can reach -listen")
+	grpcListen := fs.String("grpc-listen", "", "address to serve the gRPC API on in daemon mode (default: disabled)")
+	operatorMode := fs.Bool("operator", false, "run as a Kubernetes operator checking DNSCheck resources")
+	namespace := fs.String("namespace", "", "namespace to watch DNSCheck resources in operator mode (default: all)")
+	resync := fs.Duration("resync", 30*time.Second, "interval between full lists of DNSCheck resources in operator mode, which start the checks that are due")
+	workers := fs.Int("workers", 4, "maximal number of DNSCheck resources checked at the same time in operator mode")
+	resolvers := fs.String("ns", strings.Join(nss, ","), "comma-separated list of resolvers to check records on")
+	strategy := fs.String("resolver-strategy", strategyAll, "how to spread checks across resolvers: all, round-robin or quorum")
+	quorum := fs.Int("quorum", 0, "number of resolvers that have to pass with -resolver-strategy=quorum (default: majority)")
+	configPath := fs.String("config", "", "JSON configuration file")
+	regoPolicy := fs.String("rego", "", "Rego policy file evaluated against the expected records and the results, requires opa")
+	regoQuery := fs.String("rego-query", defaultRegoQuery, "Rego query evaluating to the violations of the policy")
+	opaPath := fs.String("opa", "opa", "path to the opa binary")
+	sqlitePath := fs.String("sqlite", "", "SQLite database to add the run and its results to, e.g. to aggregate the runs of many repositories, requires sqlite3")
+	sqliteLabel := fs.String("sqlite-label", os.Getenv("GITHUB_REPOSITORY"), "label of the run in the -sqlite database, e.g. the repository (default: $GITHUB_REPOSITORY)")
+	sqlite3Path := fs.String("sqlite3", "sqlite3", "path to the sqlite3 binary")
+	tags := fs.String("tag", "", "comma-separated tags to check only the records with any of, from the tags meta field; tags prefixed with ! exclude records")
+	strictInput := fs.Bool("strict-input", false, "reject fields in the input that are not known to be DNSControl ones")
+	rulesPath := fs.String("rules", "", "JSON file with rules every domain has to satisfy, e.g. an SPF TXT for domains with MX")
+	timeout := fs.Duration("timeout", 2*time.Second, "timeout for a single query")
+	retries := fs.Int("retries", 1, "number of times to retry a query over UDP on timeout")
+	retryBudget := fs.Float64("retry-budget", defaultRetryBudget, "share of queries that may be retried or fall back to other transports")
+	fallback := fs.String("fallback", "tcp", "comma-separated transports to fall back to after UDP timeouts: tcp, tls, https")
+	pipelineDepth := fs.Int("pipeline-depth", defaultPipelineDepth, "maximal number of queries in flight on a single TCP or DNS-over-TLS connection, 0 or 1 to open a connection per query")
+	iface := fs.String("interface", "", "network interface to send queries through")
+	ttlMode := fs.String("ttl-mode", ttlModeMax, "how to check TTLs: max (up to the expected one), exact, or authoritative (up to the expected one, exactly on the authoritative servers)")
+	domainTimeout := fs.Duration("domain-timeout", 0, "time the checks of a single domain may take before the rest of them are skipped, e.g. when its servers keep timing out (default: unlimited)")
+	parallelism := fs.Int("parallelism", defaultParallelism, "maximal number of checks running at the same time")
+	queryRate := fs.Float64("rate", defaultRate, "maximal number of queries per second to a single resolver")
+	useProfiles := fs.Bool("resolver-profiles", false, "query Google, Cloudflare and Quad9 public resolvers at their rates, retries and fallback transports, unless -rate, -retries or -fallback is given")
+	dumpResponses := fs.Bool("dump-responses", false, "print the full response of the failing resolver for failed checks")
+	groupBy := fs.String("group-by", groupByDomain, "how to section the report: domain, or owner from the owner meta field of records and domains")
+	dryRun := fs.Bool("dry-run", false, "print the record sets that would be queried on which resolvers, over which transports, and the estimated number of queries and duration, without sending any")
+	checkPreflight := fs.Bool("preflight", false, "check that the resolvers answer before the run and check on the ones that do")
+	interception := fs.Bool("detect-interception", false, "query canary names through every resolver before the run and mark the results of the ones rewriting NXDOMAIN or sharing an egress address with another as untrusted")
+	requireAllResolvers := fs.Bool("require-all-resolvers", false, "fail the run if any resolver fails the pre-flight check, instead of checking on the rest (implies -preflight)")
+	nsid := fs.Bool("nsid", false, "identify the resolver instance answering each check via NSID or CHAOS id.server")
+	samples := fs.Int("samples", 1, "query A and AAAA record sets of several records this many times on every resolver, passing if each answer has only expected addresses and every one is in some answer, for providers answering with a part of a pool")
+	requireFlags := fs.String("require-flags", "", "comma-separated header flags answers of record checks must have: AA, e.g. when checking on authoritative servers, RA for recursive resolvers, AD for validating ones")
+	maxAnswerSize := fs.Int("max-answer-size", defaultMaxAnswerSize, "report answers of record checks over or close to this size in bytes, not at all if 0")
+	qlogPath := fs.String("qlog", "", "file to write all queries and responses to")
+	qlogFormat := fs.String("qlog-format", qlogText, "format of the -qlog file: text or pcap")
+	diagnose := fs.Bool("diagnose", false, "probe authoritative servers of the domains for case preservation, EDNS compliance and TCP support instead of checking records")
+	auditPath := fs.Bool("audit-path", false, "send a batch of queries to every UDP resolver and check that each is answered once, by the resolver, with a matching ID and question, from distinct source ports, instead of checking records")
+	checkNSReachable := fs.Bool("check-ns-reachable", false, "also resolve the nameservers of every domain and check that all their addresses answer queries")
+	checkAdditionalSection := fs.Bool("check-additional", false, "also check that authoritative answers for MX and SRV records include the addresses of their targets")
+	apexChecks := fs.Bool("apex-checks", false, "also screen the apex of every domain for A or AAAA, NS, SOA and CAA records and an SPF record matching MX, in a section of its own")
+	checkTargets := fs.Bool("check-targets", false, "also check that the targets of CNAME, MX, SRV and NS records resolve")
+	checkDelegation := fs.Bool("check-delegation", false, "look up the NS records of every domain before the run and fail domains that are not delegated with a single error, instead of checking all their records")
+	lint := fs.Bool("lint", false, "fail records DNS does not allow, such as a CNAME at the apex or next to other records, before querying")
+	compareTransports := fs.Bool("compare-transports", false, "also query every record set over both UDP and TCP and flag resolvers answering differently")
+	crowd := fs.Bool("crowd", false, "check on a set of public resolvers and report propagation per record")
+	crowdList := fs.String("crowd-list", "", "file with resolvers for -crowd, one \"host:port [name]\" per line (default: built-in list)")
+	crowdSample := fs.Int("crowd-sample", 0, "number of resolvers to sample for -crowd (default: all)")
+	minPropagation := fs.Float64("min-propagation", 100, "percentage of resolvers a record has to propagate to with -crowd")
+	route53Check := fs.Bool("route53", false, "also compare the records in Route53 with the expected ones, to tell failed pushes from slow propagation (credentials from AWS_* environment variables)")
+	cloudflareCheck := fs.Bool("cloudflare", false, "also compare the records in Cloudflare with the expected ones, accepting any address for proxied records (API token in CLOUDFLARE_API_TOKEN)")
+	registrar := fs.Bool("registrar", false, "also check via RDAP that the registrar delegates domains to the expected nameservers")
+	atlas := fs.Bool("atlas", false, "also check records from RIPE Atlas probes (API key in RIPE_ATLAS_KEY)")
+	atlasCountries := fs.String("atlas-countries", "", "comma-separated country codes to select RIPE Atlas probes in (default: worldwide)")
+	atlasASNs := fs.String("atlas-asns", "", "comma-separated AS numbers to select RIPE Atlas probes in")
+	atlasProbes := fs.Int("atlas-probes", 3, "number of RIPE Atlas probes per country/AS")
+	atlasTimeout := fs.Duration("atlas-timeout", 10*time.Minute, "time to wait for RIPE Atlas measurements")
+	cachePath := fs.String("cache", "", "file to cache verified records in between runs")
+	shardSpec := fs.String("shard", "", "check only the i-th of N deterministic subsets of the records, as i/N")
+	resultsJSON := fs.String("results-json", "", "file to write the results to as JSON, e.g. for merge")
+	junitPath := fs.String("junit", "", "file to write the results to as JUnit XML, for CI test reports")
+	summaryJSON := fs.String("summary-json", "", "file to write a summary of the run to as JSON: totals, duration, resolvers and the outcome of every domain")
+	printVersion := fs.Bool("version", false, "print the version and exit")
+	ttlReport := fs.Bool("ttl-report", false, "also print the minimal, median and maximal TTLs observed per record type and resolver")
+	reportTemplate := fs.String("report-template", "", "text/template file to print the report with instead of the default one")
+	diffFrom := fs.String("diff-from", "", "earlier DNSControl output, or git:<revision>:<path>, to check only the record sets changed since then")
+	previewPath := fs.String("preview", "", "output of dnscontrol preview or push, to check only the record sets changed by its corrections")
+	onlyFailedPath := fs.String("only-failed", "", "-results-json output of a previous run, to check only the record sets that failed in it")
+	changedOnly := fs.Bool("changed-only", false, "skip records unchanged since they were last verified (requires -cache)")
+	_ = fs.Parse(args)
+	if checkArgs != nil {
+		if err := checkArgs(); err != nil {
+			fmt.Fprintf(fs.Output(), "%v\n", err)
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+
+	if *printVersion {
+		fmt.Println(toolVersion())
+		return
+	}
+
+	opts := runOptions{
+		resolvers: strings.Split(*resolvers, ","),
+		strategy:  *strategy,
+		quorum:    *quorum,
+		iface:     *iface,
+		timeout:   *timeout,
+		retries:   *retries,
+		fallback:  splitList(*fallback),
+
+		retryBudget:   *retryBudget,
+		pipelineDepth: *pipelineDepth,
+		parallelism:   *parallelism,
+		domainTimeout: *domainTimeout,
+		rate:          *queryRate,
+		ttlMode:       *ttlMode,
+		waitQuorum:    *waitQuorum,
+
+		dumpResponses: *dumpResponses,
+		groupBy:       *groupBy,
+		nsid:          *nsid,
+		requireFlags:  splitList(strings.ToUpper(*requireFlags)),
+		samples:       *samples,
+		maxAnswerSize: *maxAnswerSize,
+	}
+	if *useProfiles {
+		opts.profiles = profilesUnlessSet(fs)
+	}
+
+	if *qlogPath != "" {
+		var err error
+		if opts.qlog, err = openQueryLog(*qlogPath, *qlogFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open query log: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	// Reloaded with the config by the daemon
+	flagOpts := opts
+	cfg := &config{}
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfig(*configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(2)
+		}
+		opts = opts.withConfig(cfg)
+	}
+
+	var reportTmpl *template.Template
+	if *reportTemplate != "" {
+		var err error
+		if reportTmpl, err = loadTemplate(*reportTemplate); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load %s: %v\n", *reportTemplate, err)
+			os.Exit(2)
+		}
+	}
+
+	var rules []rule
+	if *rulesPath != "" {
+		var err error
+		if rules, err = loadRules(*rulesPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load rules: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	var crowdResolvers []publicResolver
+	if *crowd {
+		crowdResolvers = publicResolvers
+		if *crowdList != "" {
+			var err error
+			if crowdResolvers, err = loadResolverList(*crowdList); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load resolver list: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		crowdResolvers = sampleResolvers(crowdResolvers, *crowdSample)
+
+		opts.resolvers = nil
+		for _, r := range crowdResolvers {
+			opts.resolvers = append(opts.resolvers, r.Addr)
+		}
+		opts.strategy = strategyAll
+	}
+
+	if err := opts.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	if err := validateInputFormat(*inputFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	sh, err := parseShard(*shardSpec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	if *dryRun && (*operatorMode || *daemonMode || *diagnose || *auditPath) {
+		fmt.Fprintf(os.Stderr, "-dry-run only applies to a single run\n")
+		os.Exit(2)
+	}
+
+	if *operatorMode {
+		if *workers <= 0 {
+			fmt.Fprintf(os.Stderr, "-workers must be positive\n")
+			os.Exit(2)
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+		defer cancel()
+
+		if err := runOperator(ctx, opts, *namespace, *resync, *workers); err != nil {
+			fmt.Fprintf(os.Stderr, "Operator failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var vars *inputVars
+	if *expandVars || *valuesPath != "" {
+		if vars, err = loadInputVars(*valuesPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read values: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	tagFilter := parseTagFilter(splitList(*tags))
+	// Set to the problem of the first domain with invalid meta fields
+	var invalid error
+	// readInput passes the domains to check to fn as they are read
+	readInput := func(fn func(domain) error) error {
+		filtered := func(d domain) error {
+			selected := tagFilter.apply([]domain{d})
+			if invalid = validatePriorities(selected); invalid == nil {
+				invalid = validateVerifyMeta(selected)
+			}
+			if invalid != nil {
+				return invalid
+			}
+			for _, d := range selected {
+				if err := fn(d); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if *inputPath != "" {
+			return loadInputFunc(*inputPath, *inputFormat, *strictInput, vars, filtered)
+		}
+		return decodeInputFunc(bufio.NewReader(os.Stdin), *inputFormat, *strictInput, vars, filtered)
+	}
+
+	// Record sets are checked as they are read, unless something needs all
+	// of them before the run
+	stream := !*daemonMode && !*diagnose && !*auditPath && !*dryRun && !*changedOnly && *diffFrom == "" &&
+		*previewPath == "" && *onlyFailedPath == "" && !*checkDelegation && !*route53Check && !*cloudflareCheck
+	var domains []domain
+	if !stream {
+		err := readInput(func(d domain) error {
+			domains = append(domains, d)
+			return nil
+		})
+		exitOnInputError(err, invalid)
+	}
+
+	if *diagnose {
+		if !runDiagnostics(domains, opts) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *auditPath {
+		if !runPathAudit(domains, opts) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *daemonMode {
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+		defer cancel()
+
+		daemons, err := newDaemons(domains, opts, *interval, cfg.Tenants)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		if *historyPath != "" {
+			store, err := loadHistory(*historyPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load history: %v\n", err)
+				os.Exit(1)
+			}
+			for _, d := range daemons {
+				d.store = store
+				d.history = store.restore(d.tenant)
+			}
+		}
+		src := &daemonSource{
+			inputPath:  *inputPath,
+			configPath: *configPath,
+			format:     *inputFormat,
+			strict:     *strictInput,
+			tags:       tagFilter,
+			expandVars: vars != nil,
+			valuesPath: *valuesPath,
+			domains:    domains,
+			opts:       flagOpts,
+			interval:   *interval,
+		}
+		go watchReload(ctx, daemons, src, *watchConfig)
+		if err := runDaemon(ctx, daemons, daemonOptions{
+			listen:      *listen,
+			grpcListen:  *grpcListen,
+			checkAPI:    *checkAPI,
+			ttlSchedule: *ttlSchedule,
+		}); err != nil {
+			fmt.Fprintf(os.Stderr, "Daemon failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *soak > 0 && *wait > 0 {
+		fmt.Fprintf(os.Stderr, "-soak and -wait are mutually exclusive\n")
+		os.Exit(2)
+	}
+	if *soakInterval <= 0 {
+		fmt.Fprintf(os.Stderr, "-soak-interval must be positive\n")
+		os.Exit(2)
+	}
+
+	if *changedOnly && *cachePath == "" {
+		fmt.Fprintf(os.Stderr, "-changed-only requires -cache\n")
+		os.Exit(2)
+	}
+
+	var cache *verifiedCache
+	if *cachePath != "" {
+		cache, err = loadVerifiedCache(*cachePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load cache: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if (*checkPreflight || *requireAllResolvers) && !*crowd && !*dryRun {
+		if failed := preflight(opts); len(failed) > 0 {
+			for _, ns := range opts.resolvers {
+				if err, ok := failed[ns]; ok {
+					fmt.Fprintf(os.Stderr, "Resolver %s failed the pre-flight check: %v\n", opts.views.label(ns), err)
+				}
+			}
+			if *requireAllResolvers {
+				os.Exit(1)
+			}
+			if err := excludeUnhealthy(&opts, failed); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Checking on the remaining %d resolvers\n", len(opts.resolvers))
+		}
+	}
+
+	var untrusted map[string]string
+	if *interception && !*dryRun {
+		untrusted = detectInterception(opts)
+		for _, ns := range opts.resolvers {
+			if reason, ok := untrusted[ns]; ok {
+				fmt.Fprintf(os.Stderr, "Resolver %s is likely intercepted: %s\n", opts.views.label(ns), reason)
+			}
+		}
+	}
+
+	toCheck := domains
+	if *changedOnly {
+		var skipped int
+		toCheck, skipped = cache.changed(domains, opts)
+		fmt.Printf("Skipping %d record sets unchanged since last verified\n", skipped)
+	}
+	if *diffFrom != "" {
+		old, err := loadRevision(*diffFrom)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", *diffFrom, err)
+			os.Exit(1)
+		}
+		var n int
+		toCheck, n = diffDomains(old, toCheck)
+		fmt.Printf("Checking %d record sets changed since %s\n", n, *diffFrom)
+	}
+	if *previewPath != "" {
+		changes, err := loadPreview(*previewPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read preview: %v\n", err)
+			os.Exit(1)
+		}
+		var n int
+		toCheck, n = previewed(toCheck, changes)
+		fmt.Printf("Checking %d record sets changed in the preview\n", n)
+	}
+	if *onlyFailedPath != "" {
+		prev, err := readResultsJSON(*onlyFailedPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read results: %v\n", err)
+			os.Exit(1)
+		}
+		var n int
+		toCheck, n = failedRecordSets(toCheck, prev)
+		fmt.Printf("Checking %d record sets that failed in %s\n", n, *onlyFailedPath)
+	}
+	// Checks done once per domain or geo matrix are sharded by domain
+	domainChecks := sh.domains(toCheck)
+	toCheck = sh.recordSets(toCheck)
+
+	var undelegated []checkResult
+	if *checkDelegation && !*dryRun {
+		undelegated = checkDelegations(toCheck, opts)
+		for _, r := range undelegated {
+			fmt.Printf("Skipping %s: %v\n", r.Domain, r.Err)
 		}
+		toCheck = withoutDomains(toCheck, undelegated)
+		domainChecks = withoutDomains(domainChecks, undelegated)
+	}
+
+	if *dryRun {
+		printPlan(os.Stdout, planJobs(toCheck, opts, time.Now()), opts)
+		return
 	}
 
-	if err := json.Unmarshal(records, &data); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to parse DNSControl output: %v\n", err)
+	var provider zoneProvider
+	switch {
+	case *route53Check && *cloudflareCheck:
+		fmt.Fprintf(os.Stderr, "-route53 and -cloudflare are mutually exclusive\n")
+		os.Exit(2)
+	case *route53Check:
+		r, err := newRoute53()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		provider = newProviderCache(r)
+	case *cloudflareCheck:
+		cf, err := newCloudflare()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		provider = newProviderCache(cf)
+	}
+	if provider != nil {
+		opts.proxied = proxiedRecordSets(context.Background(), toCheck, provider)
+	}
+
+	var lintResults []checkResult
+	if *lint && !stream {
+		lintResults = runLintChecks(toCheck)
+	}
+
+	rep := reporters{&consoleReporter{w: os.Stdout, tmpl: reportTmpl, groupBy: opts.groupBy, dumpResponses: opts.dumpResponses}}
+	if *resultsJSON != "" {
+		rep = append(reporters{jsonReporter{path: *resultsJSON}}, rep...)
+	}
+	if *junitPath != "" {
+		rep = append(reporters{junitReporter{path: *junitPath}}, rep...)
+	}
+	opts.reporter = rep
+
+	var res *runResult
+	if stream {
+		rep.Start(nil)
+		var readErr error
+		toCheck, res, err = streamChecks(context.Background(), func(fn func(domain) error) error {
+			readErr = readInput(func(d domain) error {
+				domainChecks = append(domainChecks, sh.domains([]domain{d})...)
+				for _, owned := range sh.recordSets([]domain{d}) {
+					if err := fn(owned); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			return readErr
+		}, opts)
+		if readErr != nil {
+			exitOnInputError(readErr, invalid)
+		}
+		if *lint {
+			lintResults = runLintChecks(toCheck)
+		}
+	} else {
+		rep.Start(toCheck)
+		res, err = runChecks(context.Background(), toCheck, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run checks: %v\n", err)
 		os.Exit(1)
 	}
+	res.Results = append(res.Results, undelegated...)
+	var soakEvents *soakLog
+	if *soak > 0 {
+		soakEvents = newSoakLog()
+		if res, err = runSoak(context.Background(), toCheck, opts, res, *soak, *soakInterval, soakEvents); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to run checks: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var conv *convergence
+	if *wait > 0 {
+		conv = newConvergence(res)
+		if res, err = waitForPropagation(context.Background(), toCheck, opts, res, *wait, *waitInterval, conv); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to run checks: %v\n", err)
+			os.Exit(1)
+		}
+		printStragglers(os.Stdout, res)
+	}
+	res.Results = append(lintResults, res.Results...)
+	if *classify {
+		classifyFailures(toCheck, res, opts)
+	}
+	detectThrottling(res)
+
+	if cfg.Policy.DNSSEC != nil {
+		res.Results = append(res.Results, runDNSSECChecks(domainChecks, opts, cfg.Policy.DNSSEC)...)
+		res.Finished = time.Now()
+	}
+
+	if len(cfg.Policy.TTL) > 0 {
+		res.Results = append(res.Results, runTTLPolicyChecks(toCheck, cfg.Policy.TTL)...)
+		res.Finished = time.Now()
+	}
+
+	if rules != nil {
+		res.Results = append(res.Results, runRuleChecks(domainChecks, rules, opts)...)
+		res.Finished = time.Now()
+	}
+
+	var authoritativeTTLs []domain
+	for _, dom := range toCheck {
+		if opts.forDomain(dom).ttlMode == ttlModeAuthoritative {
+			authoritativeTTLs = append(authoritativeTTLs, dom)
+		}
+	}
+	if len(authoritativeTTLs) > 0 {
+		res.Results = append(res.Results, runAuthoritativeTTLChecks(authoritativeTTLs, opts)...)
+		res.Finished = time.Now()
+	}
+
+	if *compareTransports {
+		res.Results = append(res.Results, runTransportComparison(toCheck, opts)...)
+		res.Finished = time.Now()
+	}
+
+	if *checkAdditionalSection {
+		res.Results = append(res.Results, runAdditionalChecks(domainChecks, opts)...)
+		res.Finished = time.Now()
+	}
+
+	if *checkTargets {
+		res.Results = append(res.Results, runTargetChecks(toCheck, opts)...)
+		res.Finished = time.Now()
+	}
+
+	var apexResults []checkResult
+	if *apexChecks {
+		apexResults = runApexChecks(domainChecks, opts)
+		res.Results = append(res.Results, apexResults...)
+		res.Finished = time.Now()
+	}
+
+	if hasGeo(domainChecks) {
+		res.Results = append(res.Results, runGeoChecks(domainChecks, opts)...)
+		res.Finished = time.Now()
+	}
+
+	if *registrar {
+		res.Results = append(res.Results, runRegistrarChecks(domainChecks)...)
+		res.Finished = time.Now()
+	}
+
+	if *checkNSReachable {
+		res.Results = append(res.Results, runNSReachabilityChecks(domainChecks, opts)...)
+		res.Finished = time.Now()
+	}
 
-	wg := &sync.WaitGroup{}
+	if provider != nil {
+		res.Results = append(res.Results, runProviderChecks(context.Background(), toCheck, provider)...)
+		res.Finished = time.Now()
+	}
 
-	for _, domain := range data.Domains {
-		type nameType struct {
-			name string
-			typ  string
+	if *atlas {
+		key := os.Getenv("RIPE_ATLAS_KEY")
+		if key == "" {
+			fmt.Fprintf(os.Stderr, "-atlas requires RIPE_ATLAS_KEY\n")
+			os.Exit(2)
+		}
+		atlasResults, err := runAtlasChecks(context.Background(), toCheck, atlasOptions{
+			key:       key,
+			countries: splitList(*atlasCountries),
+			asns:      splitList(*atlasASNs),
+			probes:    *atlasProbes,
+			timeout:   *atlasTimeout,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "RIPE Atlas checks failed: %v\n", err)
+			os.Exit(1)
 		}
+		res.Results = append(res.Results, atlasResults...)
+		res.Finished = time.Now()
+	}
 
-		recordsByNameType := map[nameType][]record{}
-		for _, record := range domain.Records {
-			nt := nameType{name: record.Name, typ: record.Type}
-			recordsByNameType[nt] = append(recordsByNameType[nt], record)
+	// Last, so that policies see the results of all other checks
+	if *regoPolicy != "" {
+		regoResults, err := runRegoChecks(context.Background(), domainChecks, res, regoOptions{
+			opa:    *opaPath,
+			policy: *regoPolicy,
+			query:  *regoQuery,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Rego policy failed: %v\n", err)
+			os.Exit(1)
 		}
+		res.Results = append(res.Results, regoResults...)
+		res.Finished = time.Now()
+	}
+	assignOwners(toCheck, res)
+	assignSources(toCheck, res)
+	assignViews(res, opts.views)
+	markUntrusted(res, untrusted)
+
+	if cache != nil {
+		cache.update(toCheck, res)
+		if err := cache.save(*cachePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save cache: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-		for _, records := range recordsByNameType {
-			for _, ns := range nss {
-				wg.Add(1)
-				time.Sleep(10 * time.Millisecond) // To avoid hitting rate-limits
-				go checkRecord(wg, ns, domain.Name, records)
+	if *summaryJSON != "" {
+		if err := writeSummaryJSON(*summaryJSON, res, opts.resolvers); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write summary: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *sqlitePath != "" {
+		if err := writeSQLite(context.Background(), sqliteOptions{sqlite3: *sqlite3Path, path: *sqlitePath, label: *sqliteLabel}, res); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write results to %s: %v\n", *sqlitePath, err)
+			os.Exit(1)
+		}
+	}
+
+	if conv != nil && *convergenceJSON != "" {
+		if err := writeConvergenceJSON(*convergenceJSON, conv); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write convergence report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Files first, so that they are written even if the template fails
+	if err := rep.Summary(res); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to report results: %v\n", err)
+		os.Exit(1)
+	}
+	if provider != nil {
+		printAttribution(os.Stdout, res, provider)
+	}
+	if *apexChecks {
+		printApexReport(os.Stdout, apexResults)
+	}
+	if conv != nil {
+		printConvergence(os.Stdout, conv, *wait)
+	}
+	if soakEvents != nil {
+		printSoakReport(os.Stdout, soakEvents, *soak)
+	}
+	if *ttlReport {
+		printTTLDistribution(os.Stdout, res, opts.resolvers)
+	}
+	printThrottling(os.Stdout, res)
+	printDomainTimeouts(os.Stdout, res)
+
+	if *crowd {
+		if !printPropagation(res, crowdResolvers, *minPropagation) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var fellBack int
+	for _, r := range res.Results {
+		if r.Err == nil && !r.Truncated && r.Transport != "" && r.Transport != transportUDP {
+			// Resolvers with an explicit transport never fall back
+			if explicit, _, _ := resolverAddr(r.NS); explicit == "" {
+				fellBack++
 			}
 		}
 	}
+	if fellBack > 0 {
+		fmt.Printf("\n%d checks passed only after falling back from UDP\n", fellBack)
+	}
 
-	wg.Wait()
+	if old := len(res.matchedOld()); old > 0 {
+		fmt.Printf("\n%d checks passed with values from before a migration\n", old)
+	}
 
-	if failed.Load() {
+	// Retried over TCP, so only failing if that failed too, but every
+	// resolver without TCP access fails on these
+	if truncated := res.truncated(); len(truncated) > 0 {
+		fmt.Printf("\n%d answers over UDP were truncated:\n", len(truncated))
+		for _, r := range truncated {
+			fmt.Printf("  %s %s (at %s)\n", r.Type, r.Name, r.NS)
+		}
+	}
+	printPacketAnomalies(os.Stdout, res)
+
+	blocking, warned := blockingFailures(res, cfg.Failures, warningDomains(toCheck))
+	printWarnedFailures(os.Stdout, warned)
+	if len(blocking) > 0 {
+		os.Exit(1)
+	}
+	if soakEvents != nil && len(soakEvents.events) > 0 {
+		// Passing in the end does not make up for the divergence
 		os.Exit(1)
 	}
+	if len(warned) > 0 {
+		fmt.Println("\nNo failures that fail the run")
+		return
+	}
 
+	if outvoted := len(res.outvoted()); outvoted > 0 {
+		fmt.Printf("\nAll checks passed (%d failures outvoted by quorum)\n", outvoted)
+		return
+	}
 	fmt.Println("\nAll checks passed")
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const mergeUsage = `Usage: control merge [flags] <results.json>...
+
+Combines the results written by -results-json of several runs, e.g. of
+-shard 1/3, 2/3 and 3/3, into a single report.
+
+Flags:
+`
+
+// runMerge implements the merge subcommand and returns the exit code.
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), mergeUsage)
+		fs.PrintDefaults()
+	}
+	resultsJSON := fs.String("results-json", "", "file to write the merged results to as JSON")
+	summaryJSON := fs.String("summary-json", "", "file to write a summary of the merged results to as JSON: totals, duration, resolvers and the outcome of every domain")
+
+	paths, err := parseFlagsInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(paths) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	merged := &runResult{}
+	for _, path := range paths {
+		res, err := readResultsJSON(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read results: %v\n", err)
+			return 1
+		}
+		if merged.Started.IsZero() || res.Started.Before(merged.Started) {
+			merged.Started = res.Started
+		}
+		if res.Finished.After(merged.Finished) {
+			merged.Finished = res.Finished
+		}
+		merged.Results = append(merged.Results, res.Results...)
+	}
+
+	printReport(os.Stdout, nil, merged, false)
+
+	if *resultsJSON != "" {
+		if err := writeResultsJSON(*resultsJSON, merged); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write results: %v\n", err)
+			return 1
+		}
+	}
+	if *summaryJSON != "" {
+		if err := writeSummaryJSON(*summaryJSON, merged, resolversOf(merged)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write summary: %v\n", err)
+			return 1
+		}
+	}
+
+	if len(merged.failures()) > 0 {
+		return 1
+	}
+	fmt.Println("\nAll checks passed")
+	return 0
+}
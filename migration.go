@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// migration lists the values a record set had before a cutover. Until the
+// window ends, resolvers still serving them from cache are not failed.
+type migration struct {
+	Name string
+	Type string
+	// End of the cutover window, never ending if zero
+	Until time.Time
+	// Old value set, name and type are taken from the migration
+	Old []record
+}
+
+// oldRecords returns the previous value set of the record group if it is
+// being migrated at the given time, or nil.
+func (d domain) oldRecords(records []record, now time.Time) []record {
+	for _, m := range d.Migrations {
+		if m.Name != records[0].Name || !strings.EqualFold(m.Type, records[0].Type) {
+			continue
+		}
+		if !m.Until.IsZero() && !now.Before(m.Until) {
+			return nil
+		}
+
+		return completeRecords(m.Old, records)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"github.com/miekg/dns"
+)
+
+// Names of TXT records in the CHAOS class identifying the server, for
+// resolvers that don't support NSID
+var chaosIDNames = []string{"id.server.", "hostname.bind."}
+
+// addNSID requests the name server identifier (RFC 5001) in the query.
+func addNSID(m *dns.Msg) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		m.SetEdns0(1232, false)
+		opt = m.IsEdns0()
+	}
+	opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+}
+
+// printableID returns the identifier as text, or hex-encoded if it is not
+// printable.
+func printableID(b []byte) string {
+	s := string(b)
+	if strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) != -1 {
+		return hex.EncodeToString(b)
+	}
+	return s
+}
+
+// responseNSID returns the name server identifier included in the response,
+// or "" if there is none.
+func responseNSID(resp *dns.Msg) string {
+	if resp == nil {
+		return ""
+	}
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, o := range opt.Option {
+		if nsid, ok := o.(*dns.EDNS0_NSID); ok && nsid.Nsid != "" {
+			b, err := hex.DecodeString(nsid.Nsid)
+			if err != nil {
+				return nsid.Nsid
+			}
+			return printableID(b)
+		}
+	}
+	return ""
+}
+
+// chaosID asks the resolver for its identity via CHAOS TXT queries,
+// returning "" if it does not tell.
+func (c *checker) chaosID(ns string) string {
+	c.mu.Lock()
+	e, ok := c.ids[ns]
+	if !ok {
+		e = &idEntry{done: make(chan struct{})}
+		c.ids[ns] = e
+	}
+	c.mu.Unlock()
+
+	if ok {
+		<-e.done
+		return e.id
+	}
+	defer close(e.done)
+
+	if c.err != nil {
+		return ""
+	}
+	for _, name := range chaosIDNames {
+		m := &dns.Msg{}
+		m.Id = dns.Id()
+		m.Question = []dns.Question{{Name: name, Qtype: dns.TypeTXT, Qclass: dns.ClassCHAOS}}
+		resp, _, err := c.transports.exchange(m, ns)
+		if err != nil || resp.Rcode != dns.RcodeSuccess {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			if txt, ok := rr.(*dns.TXT); ok && len(txt.Txt) > 0 {
+				e.id = printableID([]byte(strings.Join(txt.Txt, "")))
+				return e.id
+			}
+		}
+	}
+	return ""
+}
+
+// instance identifies the anycast instance of the resolver that sent the
+// response: by its NSID, or by asking the resolver via CHAOS queries.
+func (c *checker) instance(ns string, resp *dns.Msg) string {
+	if id := responseNSID(resp); id != "" {
+		return id
+	}
+	return c.chaosID(ns)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// runNSReachabilityChecks resolves every expected nameserver of the domains
+// and checks that each of its addresses answers queries for the domain, so
+// delegations to dead hosts are caught even if the NS records match.
+func runNSReachabilityChecks(domains []domain, opts runOptions) []checkResult {
+	c := newChecker(opts)
+	resolver := opts.resolvers[0]
+
+	type nameserver struct {
+		domain string
+		host   string
+	}
+	var nameservers []nameserver
+	var lookups []checkJob
+	for _, dom := range domains {
+		for _, host := range expectedNameservers(dom) {
+			nameservers = append(nameservers, nameserver{domain: dom.Name, host: host})
+			lookups = append(lookups, checkJob{
+				ns:     resolver,
+				domain: dom.Name,
+				result: checkResult{Domain: dom.Name, Name: dom.Name, Type: "NS", NS: fmt.Sprintf("nameserver %s", host)},
+				quiet:  true,
+			})
+		}
+	}
+	addrs := make([][]string, len(lookups))
+	for i := range lookups {
+		i, host := i, nameservers[i].host
+		lookups[i].run = func(c *checker, r *checkResult) {
+			addrs[i] = c.hostAddrs(resolver, host)
+			switch {
+			case c.err != nil:
+				r.Err = c.err
+			case len(addrs[i]) == 0:
+				r.Err = codedErrorf(codeNSUnreachable, "failed to resolve nameserver %s", host)
+			}
+		}
+	}
+
+	var results []checkResult
+	var jobs []checkJob
+	for i, r := range runPass(c, lookups, opts) {
+		if r.Err != nil {
+			results = append(results, r)
+			continue
+		}
+		dom, host := nameservers[i].domain, nameservers[i].host
+		for _, addr := range addrs[i] {
+			addr := net.JoinHostPort(addr, "53")
+			jobs = append(jobs, checkJob{
+				ns:     addr,
+				domain: dom,
+				result: checkResult{Domain: dom, Name: dom, Type: "NS", NS: fmt.Sprintf("nameserver %s (%s)", host, addr)},
+				run: func(c *checker, r *checkResult) {
+					// Any answer will do, whether the server is authoritative
+					// is up to -diagnose and -ttl-mode authoritative
+					r.Response, r.Transport, r.Err = c.transports.exchange(soaQuery(dom), addr)
+					if r.Err != nil {
+						r.Err = codedErrorf(codeNSUnreachable, "nameserver does not answer: %w", r.Err)
+					}
+				},
+			})
+		}
+	}
+	return append(results, runPass(c, jobs, opts)...)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	dnsCheckGroup   = "control.dottedmag.net"
+	dnsCheckVersion = "v1alpha1"
+	dnsCheckPlural  = "dnschecks"
+
+	defaultCheckInterval = 5 * time.Minute
+	defaultConfigMapKey  = "dnscontrol.json"
+)
+
+type dnsCheckSpec struct {
+	// Domains are expected records inline, in DNSControl print-ir format
+	Domains []domain `json:"domains,omitempty"`
+	// ConfigMapRef points to a ConfigMap holding DNSControl print-ir output
+	ConfigMapRef *struct {
+		Name string `json:"name"`
+		Key  string `json:"key,omitempty"`
+	} `json:"configMapRef,omitempty"`
+	Resolvers []string `json:"resolvers,omitempty"`
+	Interval  string   `json:"interval,omitempty"`
+}
+
+type dnsCheckStatus struct {
+	status
+	ObservedGeneration int64  `json:"observedGeneration"`
+	Verdict            string `json:"verdict"`
+	Error              string `json:"error,omitempty"`
+}
+
+type dnsCheck struct {
+	Metadata struct {
+		Name       string `json:"name"`
+		Namespace  string `json:"namespace"`
+		Generation int64  `json:"generation"`
+	} `json:"metadata"`
+	Spec   dnsCheckSpec    `json:"spec"`
+	Status *dnsCheckStatus `json:"status,omitempty"`
+}
+
+func (dc *dnsCheck) interval() (time.Duration, error) {
+	if dc.Spec.Interval == "" {
+		return defaultCheckInterval, nil
+	}
+	return time.ParseDuration(dc.Spec.Interval)
+}
+
+// due reports whether the resource has to be checked: it is new, its spec has
+// changed since the last check, or its interval has elapsed.
+func (dc *dnsCheck) due(now time.Time) bool {
+	if dc.Status == nil || dc.Status.ObservedGeneration != dc.Metadata.Generation {
+		return true
+	}
+	interval, err := dc.interval()
+	if err != nil {
+		interval = defaultCheckInterval
+	}
+	return !now.Before(dc.Status.Finished.Add(interval))
+}
+
+type operator struct {
+	kube      *kubeClient
+	opts      runOptions
+	namespace string
+
+	// Lifetime of the operator, from which the checks are run, as they
+	// outlive the list or watch that started them
+	ctx context.Context
+	// Taken by each check, limiting how many run at the same time
+	slots   chan struct{}
+	mu      sync.Mutex
+	running map[string]*operatorWorker
+}
+
+func (o *operator) dnsChecksPath(namespace string) string {
+	if namespace == "" {
+		return fmt.Sprintf("/apis/%s/%s/%s", dnsCheckGroup, dnsCheckVersion, dnsCheckPlural)
+	}
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s", dnsCheckGroup, dnsCheckVersion, namespace, dnsCheckPlural)
+}
+
+func (o *operator) expectedDomains(ctx context.Context, dc *dnsCheck) ([]domain, error) {
+	domains, err := normalizeDomains(dc.Spec.Domains)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref := dc.Spec.ConfigMapRef; ref != nil {
+		key := ref.Key
+		if key == "" {
+			key = defaultConfigMapKey
+		}
+
+		var cm struct {
+			Data map[string]string `json:"data"`
+		}
+		if err := o.kube.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", dc.Metadata.Namespace, ref.Name), "", nil, &cm); err != nil {
+			return nil, err
+		}
+		data, ok := cm.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("ConfigMap %s has no key %s", ref.Name, key)
+		}
+		cmDomains, err := parseDNSControl([]byte(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DNSControl output in ConfigMap %s: %w", ref.Name, err)
+		}
+		domains = append(domains, cmDomains...)
+	}
+
+	return domains, nil
+}
+
+func (o *operator) check(ctx context.Context, dc *dnsCheck) *dnsCheckStatus {
+	st := &dnsCheckStatus{ObservedGeneration: dc.Metadata.Generation}
+
+	fail := func(err error) *dnsCheckStatus {
+		now := time.Now()
+		st.status = status{Started: now, Finished: now, Failures: []resultJSON{}}
+		st.Verdict = "Error"
+		st.Error = err.Error()
+		return st
+	}
+
+	if _, err := dc.interval(); err != nil {
+		return fail(fmt.Errorf("invalid interval: %w", err))
+	}
+	domains, err := o.expectedDomains(ctx, dc)
+	if err != nil {
+		return fail(err)
+	}
+	res, err := runChecks(ctx, domains, o.opts.withResolvers(dc.Spec.Resolvers))
+	if err != nil {
+		return fail(err)
+	}
+	st.status = newStatus(res)
+	if st.Failed > 0 {
+		st.Verdict = "Failed"
+	} else {
+		st.Verdict = "Passed"
+	}
+	return st
+}
+
+func (dc *dnsCheck) key() string {
+	return dc.Metadata.Namespace + "/" + dc.Metadata.Name
+}
+
+// update checks the resource, within its interval so that a stuck check
+// doesn't hold up the next one, and writes the result to its status.
+func (o *operator) update(ctx context.Context, dc *dnsCheck) {
+	interval, err := dc.interval()
+	if err != nil {
+		interval = defaultCheckInterval
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, interval)
+	st := o.check(checkCtx, dc)
+	cancel()
+	// Deleted, changed or shutting down: the result is of no use
+	if ctx.Err() != nil {
+		return
+	}
+	fmt.Printf("\n%s: %s\n", dc.key(), st.Verdict)
+
+	patch := map[string]any{"status": st}
+	path := o.dnsChecksPath(dc.Metadata.Namespace) + "/" + dc.Metadata.Name + "/status"
+	if err := o.kube.do(ctx, http.MethodPatch, path, "application/merge-patch+json", patch, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to update status of %s: %v\n", dc.key(), err)
+	}
+}
+
+// operatorWorker is the check of a resource in progress.
+type operatorWorker struct {
+	generation int64
+	cancel     context.CancelFunc
+}
+
+// enqueue starts checking the resource if it is due and not being checked
+// already. A check of an earlier generation of its spec is cancelled.
+func (o *operator) enqueue(dc dnsCheck) {
+	if !dc.due(time.Now()) {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := dc.key()
+	if w := o.running[key]; w != nil {
+		if w.generation == dc.Metadata.Generation {
+			return
+		}
+		w.cancel()
+	}
+	wctx, cancel := context.WithCancel(o.ctx)
+	w := &operatorWorker{generation: dc.Metadata.Generation, cancel: cancel}
+	o.running[key] = w
+
+	go func() {
+		defer func() {
+			cancel()
+			o.mu.Lock()
+			if o.running[key] == w {
+				delete(o.running, key)
+			}
+			o.mu.Unlock()
+		}()
+		select {
+		case o.slots <- struct{}{}:
+			defer func() { <-o.slots }()
+		case <-wctx.Done():
+			return
+		}
+		o.update(wctx, &dc)
+	}()
+}
+
+// forget cancels the check of a deleted resource.
+func (o *operator) forget(dc dnsCheck) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if w := o.running[dc.key()]; w != nil {
+		w.cancel()
+		delete(o.running, dc.key())
+	}
+}
+
+// list starts checking the resources that are due and returns the resource
+// version to watch from.
+func (o *operator) list(ctx context.Context) (string, error) {
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []dnsCheck `json:"items"`
+	}
+	if err := o.kube.do(ctx, http.MethodGet, o.dnsChecksPath(o.namespace), "", nil, &list); err != nil {
+		return "", err
+	}
+	for _, dc := range list.Items {
+		o.enqueue(dc)
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch starts checking resources as they are added or their specs change,
+// until the context is done or the watch ends.
+func (o *operator) watch(ctx context.Context, resourceVersion string) error {
+	return o.kube.watch(ctx, o.dnsChecksPath(o.namespace), resourceVersion, func(ev watchEvent) error {
+		var dc dnsCheck
+		switch ev.Type {
+		case "ADDED", "MODIFIED":
+			if err := json.Unmarshal(ev.Object, &dc); err != nil {
+				return err
+			}
+			o.enqueue(dc)
+		case "DELETED":
+			if err := json.Unmarshal(ev.Object, &dc); err != nil {
+				return err
+			}
+			o.forget(dc)
+		}
+		return nil
+	})
+}
+
+// runOperator lists the resources and watches them for changes, checking up
+// to workers of them at the same time. The watch is restarted with a fresh
+// list every resync, which starts the checks of resources whose interval has
+// elapsed.
+func runOperator(ctx context.Context, opts runOptions, namespace string, resync time.Duration, workers int) error {
+	kube, err := newInClusterKubeClient()
+	if err != nil {
+		return err
+	}
+	o := &operator{
+		kube:      kube,
+		opts:      opts,
+		namespace: namespace,
+		ctx:       ctx,
+		slots:     make(chan struct{}, workers),
+		running:   map[string]*operatorWorker{},
+	}
+
+	for ctx.Err() == nil {
+		resourceVersion, err := o.list(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list DNSCheck resources: %v\n", err)
+		} else {
+			watchCtx, cancel := context.WithTimeout(ctx, resync)
+			err = o.watch(watchCtx, resourceVersion)
+			cancel()
+			if err == nil || watchCtx.Err() != nil {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Failed to watch DNSCheck resources: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(resync):
+		}
+	}
+	return nil
+}
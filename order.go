@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// Orders of answers types.*.order can require
+const (
+	// MX records sorted by preference, lowest first
+	orderPreference = "preference"
+	// Different records first in repeated answers, e.g. round-robin A
+	// records
+	orderRotating = "rotating"
+)
+
+// Queries sent looking for a rotation, including the checked one
+const rotationQueries = 4
+
+func validateOrder(order string, typ string) error {
+	switch order {
+	case "":
+	case orderPreference:
+		if typ != "MX" {
+			return fmt.Errorf("order preference does not apply to %s records", typ)
+		}
+	case orderRotating:
+	default:
+		return fmt.Errorf("unknown order %q of %s records, expected preference or rotating", order, typ)
+	}
+	return nil
+}
+
+// checkOrder checks that the answer, which has the expected records, is in
+// the order required for the type. Record sets of a single record are in
+// any order.
+func (c *checker) checkOrder(ns string, name string, exp expectation, resp *dns.Msg) error {
+	if len(exp.records) < 2 {
+		return nil
+	}
+	switch exp.order {
+	case orderPreference:
+		var prev uint16
+		for _, rr := range resp.Answer {
+			mx, ok := rr.(*dns.MX)
+			if !ok {
+				continue
+			}
+			if mx.Preference < prev {
+				return codedErrorf(codeOrderMismatch, "expected MX records sorted by preference, got %d after %d", mx.Preference, prev)
+			}
+			prev = mx.Preference
+		}
+	case orderRotating:
+		// Sent directly, as the lookups of a run are answered once
+		first := map[string]bool{firstValue(resp, exp.typ): true}
+		for i := 1; i < rotationQueries && len(first) < 2; i++ {
+			again, _, err := query(c.transports, ns, name, exp.typ, exp.qclass())
+			if err != nil {
+				return err
+			}
+			first[firstValue(again, exp.typ)] = true
+		}
+		if len(first) < 2 {
+			return codedErrorf(codeOrderMismatch, "expected the records to rotate, got the same one first in %d answers", rotationQueries)
+		}
+	}
+	return nil
+}
+
+// firstValue returns the value of the first record of the type in the
+// answer, after any CNAMEs.
+func firstValue(resp *dns.Msg, typ string) string {
+	for _, rr := range resp.Answer {
+		if dns.TypeToString[rr.Header().Rrtype] == typ {
+			return rrValue(rr)
+		}
+	}
+	return ""
+}
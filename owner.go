@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DNSControl meta field naming the team responsible for a record, set on
+// the record or, for all records of the domain, on the domain
+const ownerMeta = "owner"
+
+// How reports are grouped
+const (
+	groupByDomain = "domain"
+	groupByOwner  = "owner"
+)
+
+// Heading of the checks of records without an owner
+const noOwner = "(no owner)"
+
+func validateGroupBy(groupBy string) error {
+	switch groupBy {
+	case "", groupByDomain, groupByOwner:
+		return nil
+	}
+	return fmt.Errorf("unknown report grouping %q, expected domain or owner", groupBy)
+}
+
+// assignOwners sets the owner of the results that have none yet: that of the
+// checked record set, or that of the domain for checks of the domain as a
+// whole and of records without one.
+func assignOwners(domains []domain, res *runResult) {
+	domainOwners := map[string]string{}
+	owners := map[resultKey]string{}
+	for _, dom := range domains {
+		domainOwners[dom.Name] = dom.Meta[ownerMeta]
+		for _, rec := range dom.Records {
+			if owner := rec.Meta[ownerMeta]; owner != "" {
+				owners[inputSetKey(dom, rec.Name, rec.Type, rec.Class)] = owner
+			}
+		}
+	}
+
+	for i, r := range res.Results {
+		if r.Owner != "" {
+			continue
+		}
+		owner, ok := owners[setKey(r)]
+		if !ok {
+			owner = domainOwners[r.Domain]
+		}
+		res.Results[i].Owner = owner
+	}
+}
+
+// ownedBy returns the results of the owner, nil if res is.
+func ownedBy(res *runResult, owner string) *runResult {
+	if res == nil {
+		return nil
+	}
+	owned := &runResult{Started: res.Started, Finished: res.Finished}
+	for _, r := range res.Results {
+		if r.Owner == owner {
+			owned.Results = append(owned.Results, r)
+		}
+	}
+	return owned
+}
+
+// reportByOwner splits results by owner, with the ones of records without
+// an owner last, and the results of each owner sorted by domain, name, type
+// and resolver.
+func reportByOwner(res *runResult) []*domainReport {
+	byOwner := map[string]*domainReport{}
+	for _, r := range res.Results {
+		owner := r.Owner
+		if owner == "" {
+			owner = noOwner
+		}
+		dr, ok := byOwner[owner]
+		if !ok {
+			dr = &domainReport{name: owner}
+			byOwner[owner] = dr
+		}
+		dr.add(r)
+	}
+
+	var reports []*domainReport
+	for _, dr := range byOwner {
+		reports = append(reports, dr)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if (reports[i].name == noOwner) != (reports[j].name == noOwner) {
+			return reports[j].name == noOwner
+		}
+		return reports[i].name < reports[j].name
+	})
+	for _, dr := range reports {
+		sort.SliceStable(dr.results, func(i, j int) bool {
+			a, b := dr.results[i], dr.results[j]
+			if a.Domain != b.Domain {
+				return a.Domain < b.Domain
+			}
+			return lessResult(a, b)
+		})
+	}
+	return reports
+}
+
+// printOwnerReport prints a section per owner with its pass/fail counts and
+// the failed checks.
+func printOwnerReport(w io.Writer, res *runResult, dumpResponses bool) {
+	fmt.Fprintln(w)
+	printSections(w, reportByOwner(res), dumpResponses)
+}
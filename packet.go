@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// EDNS buffer size recommended since DNS Flag Day 2020, above which answers
+// over UDP are likely to be fragmented or truncated
+const defaultMaxAnswerSize = 1232
+
+// Share of the maximal size above which answers are reported as close to it
+const answerSizeMargin = 0.9
+
+// packetAnomalies returns what is unusual about the response: a size close
+// to or over maxSize, unless it is 0, and records no answer to the question
+// calls for.
+func packetAnomalies(resp *dns.Msg, maxSize int) []string {
+	if resp == nil {
+		return nil
+	}
+	var anomalies []string
+	if size := resp.Len(); maxSize > 0 {
+		switch {
+		case size > maxSize:
+			anomalies = append(anomalies, fmt.Sprintf("%d bytes, over the limit of %d", size, maxSize))
+		case float64(size) > answerSizeMargin*float64(maxSize):
+			anomalies = append(anomalies, fmt.Sprintf("%d bytes, close to the limit of %d", size, maxSize))
+		}
+	}
+	for _, s := range []struct {
+		name string
+		rrs  []dns.RR
+		ok   func(dns.RR) bool
+	}{
+		{"answer", resp.Answer, answerExpected(resp)},
+		{"authority", resp.Ns, authorityExpected},
+		{"additional", resp.Extra, additionalExpected(resp)},
+	} {
+		var unexpected []string
+		for _, rr := range s.rrs {
+			if !s.ok(rr) {
+				unexpected = append(unexpected, dns.TypeToString[rr.Header().Rrtype]+" "+rr.Header().Name)
+			}
+		}
+		if len(unexpected) > 0 {
+			sort.Strings(unexpected)
+			anomalies = append(anomalies, fmt.Sprintf("unexpected in the %s section: %s", s.name, strings.Join(unexpected, ", ")))
+		}
+	}
+	return anomalies
+}
+
+// answerExpected tells whether a record belongs in the answer section: of
+// the class and type of the question, or a CNAME or DNAME leading to it, or
+// a signature of any of them.
+func answerExpected(resp *dns.Msg) func(dns.RR) bool {
+	if len(resp.Question) == 0 {
+		return func(dns.RR) bool { return true }
+	}
+	q := resp.Question[0]
+	return func(rr dns.RR) bool {
+		h := rr.Header()
+		if h.Class != q.Qclass {
+			return false
+		}
+		switch h.Rrtype {
+		case q.Qtype, dns.TypeCNAME, dns.TypeDNAME, dns.TypeRRSIG:
+			return true
+		}
+		return false
+	}
+}
+
+// authorityExpected tells whether a record belongs in the authority
+// section: the SOA of negative answers, the NS and DS records of referrals
+// and the proofs of nonexistence.
+func authorityExpected(rr dns.RR) bool {
+	switch rr.Header().Rrtype {
+	case dns.TypeSOA, dns.TypeNS, dns.TypeDS, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeRRSIG:
+		return true
+	}
+	return false
+}
+
+// additionalExpected tells whether a record belongs in the additional
+// section: the OPT record, and addresses of the targets of the answer and
+// the nameservers in the authority section.
+func additionalExpected(resp *dns.Msg) func(dns.RR) bool {
+	targets := map[string]bool{}
+	for _, rr := range append(append([]dns.RR{}, resp.Answer...), resp.Ns...) {
+		switch rr := rr.(type) {
+		case *dns.MX:
+			targets[dns.CanonicalName(rr.Mx)] = true
+		case *dns.SRV:
+			targets[dns.CanonicalName(rr.Target)] = true
+		case *dns.NS:
+			targets[dns.CanonicalName(rr.Ns)] = true
+		}
+	}
+	return func(rr dns.RR) bool {
+		switch rr.Header().Rrtype {
+		case dns.TypeOPT:
+			return true
+		case dns.TypeA, dns.TypeAAAA, dns.TypeRRSIG:
+			return targets[dns.CanonicalName(rr.Header().Name)]
+		}
+		return false
+	}
+}
+
+func (r *runResult) anomalous() []checkResult {
+	var anomalous []checkResult
+	for _, res := range r.Results {
+		if len(res.Anomalies) > 0 {
+			anomalous = append(anomalous, res)
+		}
+	}
+	return anomalous
+}
+
+// printPacketAnomalies lists the answers close to the size limit or with
+// unexpected records, which don't fail checks, but are worth trimming before
+// resolvers start truncating them.
+func printPacketAnomalies(w io.Writer, res *runResult) {
+	anomalous := res.anomalous()
+	if len(anomalous) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%d answers are large or have unexpected records:\n", len(anomalous))
+	for _, r := range anomalous {
+		fmt.Fprintf(w, "  %s %s (at %s): %s\n", typeLabel(r), r.Name, viewLabel(r.NS, r.View), strings.Join(r.Anomalies, "; "))
+	}
+}
+
+// responseSize is the size of the response on the wire, 0 if there is none.
+func responseSize(resp *dns.Msg) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.Len()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const defaultPipelineDepth = 16
+
+// Pipelined connections without queries in flight are closed after this
+const pipelineIdle = 10 * time.Second
+
+// pipeline sends queries to a resolver over a single TCP or TLS connection
+// without waiting for the answers to the previous ones, which resolvers may
+// send in any order (RFC 7766, section 6.2.1.1). Answers are matched to
+// queries by ID, so every query in flight on the connection gets one of its
+// own.
+type pipeline struct {
+	client *dns.Client
+	addr   string
+	// Slots for queries in flight
+	slots chan struct{}
+
+	mu sync.Mutex
+	// Open connection, nil until dialed or after it failed
+	conn    *dns.Conn
+	pending map[uint16]chan pipelineAnswer
+}
+
+type pipelineAnswer struct {
+	resp *dns.Msg
+	err  error
+}
+
+func newPipeline(client *dns.Client, addr string, depth int) *pipeline {
+	return &pipeline{
+		client:  client,
+		addr:    addr,
+		slots:   make(chan struct{}, depth),
+		pending: map[uint16]chan pipelineAnswer{},
+	}
+}
+
+// exchange sends the query on the connection, dialing it if needed, and
+// waits for the answer until the timeout.
+func (p *pipeline) exchange(m *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case p.slots <- struct{}{}:
+	case <-deadline.C:
+		return nil, fmt.Errorf("no room in the pipeline to %s: %w", p.addr, os.ErrDeadlineExceeded)
+	}
+	defer func() { <-p.slots }()
+
+	ch := make(chan pipelineAnswer, 1)
+	id, err := p.send(m, ch, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case a := <-ch:
+		if a.err != nil {
+			return nil, a.err
+		}
+		a.resp.Id = m.Id
+		return a.resp, nil
+	case <-deadline.C:
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+		return nil, fmt.Errorf("no answer from %s: %w", p.addr, os.ErrDeadlineExceeded)
+	}
+}
+
+// send writes the query with an ID not in flight, returning it.
+func (p *pipeline) send(m *dns.Msg, ch chan pipelineAnswer, timeout time.Duration) (uint16, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		conn, err := withTimeout(p.client, timeout).Dial(p.addr)
+		if err != nil {
+			return 0, err
+		}
+		p.conn = conn
+		go p.read(conn)
+	}
+
+	q := m.Copy()
+	for {
+		q.Id = dns.Id()
+		if _, ok := p.pending[q.Id]; !ok {
+			break
+		}
+	}
+	_ = p.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err := p.conn.WriteMsg(q); err != nil {
+		p.failLocked(p.conn, err)
+		return 0, err
+	}
+	p.pending[q.Id] = ch
+	return q.Id, nil
+}
+
+// read delivers the answers arriving on the connection until it fails or
+// stays idle.
+func (p *pipeline) read(conn *dns.Conn) {
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(pipelineIdle))
+		resp, err := conn.ReadMsg()
+
+		p.mu.Lock()
+		if err != nil {
+			if isTimeout(err) && len(p.pending) > 0 {
+				// Queries in flight time out on their own
+				p.mu.Unlock()
+				continue
+			}
+			p.failLocked(conn, err)
+			p.mu.Unlock()
+			return
+		}
+		if ch, ok := p.pending[resp.Id]; ok {
+			delete(p.pending, resp.Id)
+			ch <- pipelineAnswer{resp: resp}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// failLocked closes the connection and fails the queries in flight on it.
+func (p *pipeline) failLocked(conn *dns.Conn, err error) {
+	conn.Close()
+	if p.conn != conn {
+		return
+	}
+	p.conn = nil
+	for id, ch := range p.pending {
+		ch <- pipelineAnswer{err: fmt.Errorf("connection to %s failed: %w", p.addr, err)}
+		delete(p.pending, id)
+	}
+}
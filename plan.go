@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// transportOf describes how queries to the resolver are sent.
+func transportOf(ns string, fallback []string) string {
+	scheme, _, _ := resolverAddr(ns)
+	if scheme != "" {
+		return scheme
+	}
+	if len(fallback) == 0 {
+		return "udp"
+	}
+	return "udp, then " + strings.Join(fallback, ", ") + " on timeouts"
+}
+
+// plannedQueries returns the number of queries a check sends at least,
+// without retries, and the number it may send at most when repeating
+// queries for -samples or a rotating order.
+func plannedQueries(exp expectation, opts runOptions) (int, int) {
+	n := 1
+	if opts.samples > 1 && (exp.typ == "A" || exp.typ == "AAAA") && len(exp.records) > 1 && !exp.proxied {
+		n = opts.samples
+	}
+	if exp.order == orderRotating && len(exp.records) > 1 {
+		return n, n + rotationQueries - 1
+	}
+	return n, n
+}
+
+// printPlan prints the record sets the checks would query on which
+// resolvers, and the number of queries and time it would take at the rate
+// limit, without sending any.
+func printPlan(w io.Writer, jobs []checkJob, opts runOptions) {
+	// Including the ones set per domain
+	fmt.Fprintf(w, "Resolvers:\n")
+	listed := map[string]bool{}
+	for _, job := range jobs {
+		if !listed[job.ns] {
+			listed[job.ns] = true
+			var profile string
+			if p, ok := profileFor(job.ns); ok && opts.profiles != (profileUse{}) {
+				profile = ", " + p.name + " profile"
+			}
+			fmt.Fprintf(w, "  %s (%s%s)\n", opts.views.label(job.ns), transportOf(job.ns, opts.profiles.fallbackFor(job.ns, opts.fallback)), profile)
+		}
+	}
+
+	fmt.Fprintf(w, "\nChecks:\n")
+	var minTotal, maxTotal int
+	perResolver := map[string]int{}
+	for i := 0; i < len(jobs); {
+		j := i
+		var resolvers []string
+		for ; j < len(jobs) && jobs[j].domain == jobs[i].domain && jobs[j].exp.name == jobs[i].exp.name && jobs[j].exp.typ == jobs[i].exp.typ; j++ {
+			resolvers = append(resolvers, jobs[j].ns)
+			lo, hi := plannedQueries(jobs[j].exp, opts)
+			minTotal += lo
+			maxTotal += hi
+			perResolver[jobs[j].ns] += hi
+		}
+		var notes []string
+		if isRedirect(jobs[i].exp.typ) {
+			notes = append(notes, "A lookup and HTTP request")
+		}
+		if lo, hi := plannedQueries(jobs[i].exp, opts); hi > 1 {
+			if lo == hi {
+				notes = append(notes, fmt.Sprintf("%d queries each", hi))
+			} else {
+				notes = append(notes, fmt.Sprintf("%d to %d queries each", lo, hi))
+			}
+		}
+		var note string
+		if len(notes) > 0 {
+			note = " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Fprintf(w, "  %s %s on %s%s\n", absolutize(jobs[i].domain, jobs[i].exp.name), jobs[i].exp.typ, strings.Join(resolvers, ", "), note)
+		i = j
+	}
+
+	// Resolvers are queried at the same time, each at most at its rate limit
+	var longest time.Duration
+	var slowest string
+	for ns, n := range perResolver {
+		d := time.Duration(float64(n) / opts.rateFor(ns) * float64(time.Second))
+		if d > longest || (d == longest && ns < slowest) {
+			longest, slowest = d, ns
+		}
+	}
+	queries := fmt.Sprint(minTotal)
+	if maxTotal > minTotal {
+		queries = fmt.Sprintf("%d to %d", minTotal, maxTotal)
+	}
+	fmt.Fprintf(w, "\n%d checks, %s queries without retries\n", len(jobs), queries)
+	if slowest != "" {
+		retries := opts.profiles.retriesFor(slowest, opts.retries)
+		fmt.Fprintf(w, "Estimated duration: %v at %g queries per second to %s, up to %v more per query timing out\n", longest.Round(100*time.Millisecond), opts.rateFor(slowest), opts.views.label(slowest), opts.timeout*time.Duration(retries+1))
+	}
+}
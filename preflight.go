@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// preflight sends a query that any working resolver answers, the root SOA,
+// to every resolver, returning the errors of the ones that failed. Any answer
+// other than SERVFAIL will do, as authoritative servers given as resolvers
+// refuse it.
+func preflight(opts runOptions) map[string]error {
+	c := newChecker(opts)
+
+	failed := map[string]error{}
+	if c.err != nil {
+		for _, ns := range opts.resolvers {
+			failed[ns] = c.err
+		}
+		return failed
+	}
+
+	var jobs []checkJob
+	for _, ns := range opts.resolvers {
+		ns := ns
+		jobs = append(jobs, checkJob{
+			ns:     ns,
+			result: checkResult{Name: ".", Type: "SOA", NS: ns},
+			run: func(c *checker, r *checkResult) {
+				m := &dns.Msg{}
+				m.SetQuestion(".", dns.TypeSOA)
+				resp, _, err := c.transports.exchange(m, ns)
+				if err == nil && resp.Rcode == dns.RcodeServerFailure {
+					err = rcodeError(resp.Rcode)
+				}
+				r.Err = err
+			},
+			quiet: true,
+		})
+	}
+	for _, r := range runPass(c, jobs, opts) {
+		if r.Err != nil {
+			failed[r.NS] = r.Err
+		}
+	}
+	return failed
+}
+
+// excludeUnhealthy removes the resolvers failing the pre-flight check from
+// the options, or fails if none are left.
+func excludeUnhealthy(opts *runOptions, failed map[string]error) error {
+	var healthy []string
+	for _, ns := range opts.resolvers {
+		if _, ok := failed[ns]; !ok {
+			healthy = append(healthy, ns)
+		}
+	}
+	if len(healthy) == 0 {
+		return fmt.Errorf("all resolvers failed the pre-flight check")
+	}
+	opts.resolvers = healthy
+	return opts.validate()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// previewChange is a record set changed by a correction in the output of
+// dnscontrol preview or push.
+type previewChange struct {
+	name    string // relative to the domain, "@" for the apex
+	typ     string
+	deleted bool
+}
+
+// parsePreviewLine returns the change made by a correction line, which
+// looks like one of
+//
+//	#1: + CREATE A www.example.com 192.0.2.1 ttl=300
+//	#2: ± MODIFY TXT example.com: ("v=spf1 -all" ttl=300) -> ("v=spf1 ~all" ttl=300)
+//	#3: DELETE record: old A 300 192.0.2.1
+//
+// or false if it is not a correction of a record.
+func parsePreviewLine(domainName string, line string) (previewChange, bool) {
+	fields := strings.Fields(line)
+	verb := -1
+	for i, f := range fields {
+		if f == "CREATE" || f == "MODIFY" || f == "CHANGE" || f == "DELETE" {
+			verb = i
+			break
+		}
+	}
+	if verb == -1 {
+		return previewChange{}, false
+	}
+
+	var tokens []string
+	for _, f := range fields[verb+1:] {
+		if f == "record:" {
+			continue
+		}
+		tokens = append(tokens, strings.TrimSuffix(f, ":"))
+	}
+	for i, t := range tokens {
+		if _, ok := dns.StringToType[t]; !ok {
+			continue
+		}
+		// Newer versions print the type first, older ones the name
+		var name string
+		if i > 0 {
+			name = tokens[i-1]
+		} else if len(tokens) > 1 {
+			name = tokens[1]
+		} else {
+			return previewChange{}, false
+		}
+		return previewChange{
+			name:    relativeName(domainName, name),
+			typ:     t,
+			deleted: fields[verb] == "DELETE",
+		}, true
+	}
+	return previewChange{}, false
+}
+
+// relativeName returns the name relative to the domain, as in records.
+func relativeName(domainName string, name string) string {
+	name = strings.TrimSuffix(name, ".")
+	switch {
+	case strings.EqualFold(name, domainName), name == "@":
+		return "@"
+	case strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(domainName)):
+		return name[:len(name)-len(domainName)-1]
+	}
+	return name
+}
+
+// parsePreview reads the changes by domain from the output of dnscontrol
+// preview or push.
+func parsePreview(r io.Reader) (map[string][]previewChange, error) {
+	changes := map[string][]previewChange{}
+	var domainName string
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if _, name, ok := strings.Cut(line, "Domain: "); ok {
+			domainName = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+			continue
+		}
+		if domainName == "" {
+			continue
+		}
+		if c, ok := parsePreviewLine(domainName, line); ok {
+			changes[domainName] = append(changes[domainName], c)
+		}
+	}
+	return changes, sc.Err()
+}
+
+func loadPreview(path string) (map[string][]previewChange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parsePreview(f)
+}
+
+// previewed returns the record sets changed in the preview and their number.
+// Deleted record sets are checked to be gone, unless replaced.
+func previewed(domains []domain, changes map[string][]previewChange) ([]domain, int) {
+	var out []domain
+	var n int
+	for _, dom := range domains {
+		domChanges := changes[strings.ToLower(strings.TrimSuffix(dom.Name, "."))]
+		if len(domChanges) == 0 {
+			continue
+		}
+
+		changed := map[string]bool{}
+		var deleted []previewChange
+		for _, c := range domChanges {
+			changed[strings.ToLower(c.name)+" "+c.typ] = true
+			if c.deleted {
+				deleted = append(deleted, c)
+			}
+		}
+
+		changedDom := dom
+		changedDom.Records, changedDom.NoData, changedDom.Deleted = nil, nil, nil
+		for _, records := range groupRecords(dom.Records) {
+			if changed[strings.ToLower(records[0].Name)+" "+records[0].Type] {
+				changedDom.Records = append(changedDom.Records, records...)
+				n++
+			}
+		}
+		for _, c := range deleted {
+			if !replaced(dom, c.name, c.typ) {
+				changedDom.Deleted = append(changedDom.Deleted, noData{Name: c.name, Type: c.typ})
+				n++
+			}
+		}
+		if changedDom.hasChecks() {
+			out = append(out, changedDom)
+		}
+	}
+	return out, n
+}
+
+// replaced returns whether there are still records answering queries for
+// the deleted record set at the name: of the same type, or a CNAME.
+func replaced(dom domain, name string, typ string) bool {
+	for _, r := range dom.Records {
+		if strings.EqualFold(r.Name, name) && (r.Type == typ || r.Type == "CNAME") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DNSControl meta field with the priority class of a record, set on the
+// record or, for all records of the domain, on the domain
+const priorityMeta = "priority"
+
+// Priority classes, checked in this order so that the status of critical
+// records is known early in long runs
+const (
+	priorityCritical = "critical"
+	priorityNormal   = "normal"
+	priorityBulk     = "bulk"
+)
+
+var priorityClasses = []string{priorityCritical, priorityNormal, priorityBulk}
+
+func validatePriorities(domains []domain) error {
+	check := func(where string, meta map[string]string) error {
+		switch p := meta[priorityMeta]; p {
+		case "", priorityCritical, priorityNormal, priorityBulk:
+			return nil
+		default:
+			return fmt.Errorf("unknown priority %q of %s, expected critical, normal or bulk", p, where)
+		}
+	}
+	for _, dom := range domains {
+		if err := check(dom.Name, dom.Meta); err != nil {
+			return err
+		}
+		for _, rec := range dom.Records {
+			if err := check(rec.Type+" "+absolutize(dom.Name, rec.Name), rec.Meta); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// priorityOf returns the priority class of the records, that of the domain
+// if they have none.
+func (d domain) priorityOf(records []record) string {
+	for _, r := range records {
+		if p := r.Meta[priorityMeta]; p != "" {
+			return p
+		}
+	}
+	if p := d.Meta[priorityMeta]; p != "" {
+		return p
+	}
+	return priorityNormal
+}
+
+// jobsByPriority returns the indexes of the jobs of every priority class
+// with any, in the order they are checked.
+func jobsByPriority(jobs []checkJob) [][]int {
+	byClass := map[string][]int{}
+	for i, job := range jobs {
+		byClass[job.exp.priority] = append(byClass[job.exp.priority], i)
+	}
+	var out [][]int
+	for _, class := range priorityClasses {
+		if len(byClass[class]) > 0 {
+			out = append(out, byClass[class])
+		}
+	}
+	return out
+}
+
+// printPriorityDone reports the outcome of a priority class once all of its
+// checks are done, before the rest of the run.
+func printPriorityDone(w io.Writer, res *runResult, indexes []int, class string) {
+	var failed []string
+	for _, i := range indexes {
+		if r := res.Results[i]; r.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s %s on %s", r.Name, r.Type, r.NS))
+		}
+	}
+	fmt.Fprintf(w, "\n%s checks done: %d checks, %d failed\n", strings.ToUpper(class[:1])+class[1:], len(indexes), len(failed))
+	for _, f := range failed {
+		fmt.Fprintf(w, "  %s\n", f)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"strings"
+)
+
+// resolverProfile is how a well-known public resolver is queried by
+// default, so that checks stay within its rate limits without tuning.
+type resolverProfile struct {
+	name string
+	// Queries per second to a single address
+	rate float64
+	// Additional attempts over UDP on timeout, as the resolver drops rather
+	// than refuses queries above its limits
+	retries int
+	// Transports to fall back to after UDP timeouts
+	fallback []string
+}
+
+var (
+	// Google documents a limit of 1500 queries per second per client
+	googleProfile = resolverProfile{name: "google", rate: 1000, retries: 1, fallback: []string{transportTCP, transportTLS, transportHTTPS}}
+	// Cloudflare and Quad9 document no limits, but drop bursts from a
+	// single client
+	cloudflareProfile = resolverProfile{name: "cloudflare", rate: 200, retries: 1, fallback: []string{transportTCP, transportTLS, transportHTTPS}}
+	quad9Profile      = resolverProfile{name: "quad9", rate: 50, retries: 2, fallback: []string{transportTCP, transportTLS, transportHTTPS}}
+)
+
+// Profiles by address or name of the resolvers
+var resolverProfiles = map[string]resolverProfile{
+	"8.8.8.8":              googleProfile,
+	"8.8.4.4":              googleProfile,
+	"2001:4860:4860::8888": googleProfile,
+	"2001:4860:4860::8844": googleProfile,
+	"dns.google":           googleProfile,
+
+	"1.1.1.1":              cloudflareProfile,
+	"1.0.0.1":              cloudflareProfile,
+	"2606:4700:4700::1111": cloudflareProfile,
+	"2606:4700:4700::1001": cloudflareProfile,
+	"cloudflare-dns.com":   cloudflareProfile,
+	"one.one.one.one":      cloudflareProfile,
+
+	"9.9.9.9":         quad9Profile,
+	"149.112.112.112": quad9Profile,
+	"2620:fe::fe":     quad9Profile,
+	"2620:fe::9":      quad9Profile,
+	"dns.quad9.net":   quad9Profile,
+}
+
+// profileUse tells which settings of the profiles apply: the ones not set
+// by flags.
+type profileUse struct {
+	rate     bool
+	retries  bool
+	fallback bool
+}
+
+// profilesUnlessSet returns the settings of the profiles to apply, the ones
+// whose flags are not given on the command line.
+func profilesUnlessSet(fs *flag.FlagSet) profileUse {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return profileUse{rate: !set["rate"], retries: !set["retries"], fallback: !set["fallback"]}
+}
+
+// profileFor returns the profile of the resolver, given in any of the forms
+// of -ns.
+func profileFor(ns string) (resolverProfile, bool) {
+	_, addr, err := resolverAddr(ns)
+	if err != nil {
+		return resolverProfile{}, false
+	}
+	host := addr
+	if _, rest, ok := strings.Cut(addr, "://"); ok {
+		// DNS-over-HTTPS URL
+		host, _, _ = strings.Cut(rest, "/")
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	p, ok := resolverProfiles[strings.ToLower(strings.TrimSuffix(host, "."))]
+	return p, ok
+}
+
+// rateFor returns the maximal number of queries per second to the
+// resolver.
+func (o runOptions) rateFor(ns string) float64 {
+	if p, ok := profileFor(ns); ok && o.profiles.rate {
+		return p.rate
+	}
+	return o.rate
+}
+
+// retriesFor is retries for the resolver.
+func (u profileUse) retriesFor(ns string, retries int) int {
+	if p, ok := profileFor(ns); ok && u.retries {
+		return p.retries
+	}
+	return retries
+}
+
+// fallbackFor is fallback for the resolver.
+func (u profileUse) fallbackFor(ns string, fallback []string) []string {
+	if p, ok := profileFor(ns); ok && u.fallback {
+		return p.fallback
+	}
+	return fallback
+}
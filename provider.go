@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// providerRecordSet is a record set as configured at a DNS provider.
+type providerRecordSet struct {
+	rrs []dns.RR
+	// TTL is chosen by the provider, and not compared
+	autoTTL bool
+	// Served through the proxy of the provider, so resolvers return its
+	// addresses instead of the configured ones
+	proxied bool
+	// Can't be compared with the expected records, e.g. an alias
+	skip bool
+}
+
+// zoneProvider reads the records of zones from the API of a DNS provider, to
+// tell apart changes that were not pushed from ones not propagated yet.
+type zoneProvider interface {
+	// Name shown in the results
+	name() string
+	// records returns the record sets of the zone by providerKey.
+	records(ctx context.Context, zone string) (map[string]*providerRecordSet, error)
+}
+
+// providerCache fetches every zone from the provider once per run.
+type providerCache struct {
+	zoneProvider
+
+	mu    sync.Mutex
+	zones map[string]providerZone
+}
+
+type providerZone struct {
+	sets map[string]*providerRecordSet
+	err  error
+}
+
+func newProviderCache(p zoneProvider) *providerCache {
+	return &providerCache{zoneProvider: p, zones: map[string]providerZone{}}
+}
+
+func (c *providerCache) records(ctx context.Context, zone string) (map[string]*providerRecordSet, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := dns.CanonicalName(zone)
+	z, ok := c.zones[key]
+	if !ok {
+		z.sets, z.err = c.zoneProvider.records(ctx, zone)
+		c.zones[key] = z
+	}
+	return z.sets, z.err
+}
+
+// providerKey identifies a record set by its absolute name and type.
+func providerKey(name string, typ string) string {
+	return dns.CanonicalName(name) + " " + strings.ToUpper(typ)
+}
+
+// providerResultNS returns what provider results are attributed to.
+func providerResultNS(p zoneProvider) string {
+	return p.name() + " API"
+}
+
+// runProviderChecks compares the record sets served by the provider API with
+// the expected ones.
+func runProviderChecks(ctx context.Context, domains []domain, p zoneProvider) []checkResult {
+	var results []checkResult
+	for _, dom := range domains {
+		groups := groupRecords(dom.Records)
+		if len(groups) == 0 {
+			continue
+		}
+
+		sets, err := p.records(ctx, dom.Name)
+		if err != nil {
+			cr := checkResult{Domain: dom.Name, Name: dom.Name, Type: "SOA", NS: providerResultNS(p), Err: withCode(codeExternalServiceFail, err)}
+			printProgress(cr.Err)
+			results = append(results, cr)
+			continue
+		}
+
+		for _, records := range groups {
+			// Served by the redirect service rather than the zone
+			if isRedirect(records[0].Type) {
+				continue
+			}
+			name := absolutize(dom.Name, records[0].Name)
+			set, ok := sets[providerKey(name, records[0].Type)]
+			if !ok {
+				set = &providerRecordSet{}
+			}
+			if set.skip {
+				continue
+			}
+			cr := checkResult{Domain: dom.Name, Name: name, Type: records[0].Type, NS: providerResultNS(p)}
+			cr.Response = withoutUnmanaged(&dns.Msg{Answer: set.rrs}, records[0].Type, dom.unmanagedFor(records[0].Name, records[0].Type), records)
+			if err := verifyResponse(cr.Response, records); err != nil {
+				cr.Err = withCode(codeProviderMismatch, fmt.Errorf("not pushed: %w", err))
+			} else if !set.autoTTL {
+				if err := checkExactTTL(cr.Response, records); err != nil {
+					cr.Err = withCode(codeProviderMismatch, fmt.Errorf("not pushed: %w", err))
+				}
+			}
+			printProgress(cr.Err)
+			results = append(results, cr)
+		}
+	}
+	return results
+}
+
+// proxiedRecordSets returns the record sets the provider serves through its
+// proxy, by providerKey. Zones the provider fails to return are left out,
+// runProviderChecks reports them.
+func proxiedRecordSets(ctx context.Context, domains []domain, p zoneProvider) map[string]bool {
+	proxied := map[string]bool{}
+	for _, dom := range domains {
+		sets, err := p.records(ctx, dom.Name)
+		if err != nil {
+			continue
+		}
+		for key, set := range sets {
+			if set.proxied {
+				proxied[key] = true
+			}
+		}
+	}
+	return proxied
+}
+
+// printAttribution splits failed record sets into ones the provider does not
+// have yet, and ones it has but resolvers don't serve.
+func printAttribution(w io.Writer, res *runResult, p zoneProvider) {
+	providerFailed := map[string]bool{}
+	checked := map[string]bool{}
+	for _, r := range res.Results {
+		if r.NS == providerResultNS(p) {
+			checked[providerKey(r.Name, r.Type)] = true
+			if r.Err != nil {
+				providerFailed[providerKey(r.Name, r.Type)] = true
+			}
+		}
+	}
+
+	var notPushed, notPropagated int
+	seen := map[string]bool{}
+	for _, r := range res.failures() {
+		key := providerKey(r.Name, r.Type)
+		if r.NS == providerResultNS(p) || !checked[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if providerFailed[key] {
+			notPushed++
+		} else {
+			notPropagated++
+		}
+	}
+	if notPushed+notPropagated == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nOf the failed record sets, %d differ in %s (push failure) and %d are up to date there (propagation failure)\n", notPushed, p.name(), notPropagated)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	qlogText = "text"
+	qlogPcap = "pcap"
+)
+
+// queryLog writes every query sent and every response received to a file,
+// either as dig-style text or as pcap.
+//
+// pcap files contain the messages wrapped into made-up IP and UDP headers,
+// from port 53 of the resolver regardless of the transport actually used, so
+// that they can be opened in Wireshark or tcpdump.
+type queryLog struct {
+	format string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openQueryLog(path string, format string) (*queryLog, error) {
+	if format != qlogText && format != qlogPcap {
+		return nil, fmt.Errorf("unknown query log format %q, expected text or pcap", format)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &queryLog{format: format, f: f}
+	if format == qlogPcap {
+		var hdr [24]byte
+		binary.LittleEndian.PutUint32(hdr[0:], 0xa1b23c4d) // Nanosecond timestamps
+		binary.LittleEndian.PutUint16(hdr[4:], 2)
+		binary.LittleEndian.PutUint16(hdr[6:], 4)
+		binary.LittleEndian.PutUint32(hdr[16:], 65535)
+		binary.LittleEndian.PutUint32(hdr[20:], 101) // LINKTYPE_RAW
+		if _, err := f.Write(hdr[:]); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// log records a single exchange. Entries are written in one go, so the file
+// is consistent even if the process exits without closing it.
+func (l *queryLog) log(start time.Time, ns string, transport string, query *dns.Msg, resp *dns.Msg, err error) {
+	rtt := time.Since(start)
+
+	var buf []byte
+	if l.format == qlogText {
+		buf = qlogTextEntry(start, rtt, ns, transport, query, resp, err)
+	} else {
+		buf = qlogPcapEntry(start, rtt, ns, query, resp)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Logging is best-effort and must not fail the checks
+	_, _ = l.f.Write(buf)
+}
+
+func qlogTextEntry(start time.Time, rtt time.Duration, ns string, transport string, query *dns.Msg, resp *dns.Msg, err error) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, ";; %s query to %s over %s\n", start.UTC().Format(time.RFC3339Nano), ns, transport)
+	b.WriteString(query.String())
+	switch {
+	case err != nil:
+		fmt.Fprintf(&b, "\n;; error after %s: %v\n", rtt.Round(time.Microsecond), err)
+	case resp != nil:
+		fmt.Fprintf(&b, "\n;; response after %s\n", rtt.Round(time.Microsecond))
+		b.WriteString(resp.String())
+	}
+	b.WriteString("\n")
+	return []byte(b.String())
+}
+
+func qlogPcapEntry(start time.Time, rtt time.Duration, ns string, query *dns.Msg, resp *dns.Msg) []byte {
+	host, _, _ := net.SplitHostPort(ns)
+	remote := net.ParseIP(host)
+	if remote == nil {
+		remote = net.IPv4zero
+	}
+	local := net.IPv4zero
+	if remote.To4() == nil {
+		local = net.IPv6unspecified
+	}
+	// Derive the local port from the ID to let dissectors pair messages
+	localPort := 1024 + query.Id%64512
+
+	var b bytes.Buffer
+	if wire, err := query.Pack(); err == nil {
+		writePcapPacket(&b, start, udpPacket(local, localPort, remote, 53, wire))
+	}
+	if resp != nil {
+		if wire, err := resp.Pack(); err == nil {
+			writePcapPacket(&b, start.Add(rtt), udpPacket(remote, 53, local, localPort, wire))
+		}
+	}
+	return b.Bytes()
+}
+
+func writePcapPacket(b *bytes.Buffer, ts time.Time, packet []byte) {
+	var hdr [16]byte
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(ts.Nanosecond()))
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(len(packet)))
+	b.Write(hdr[:])
+	b.Write(packet)
+}
+
+func checksum(data []byte, sum uint32) uint16 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// udpPacket wraps the payload into IPv4 or IPv6 and UDP headers.
+func udpPacket(src net.IP, srcPort uint16, dst net.IP, dstPort uint16, payload []byte) []byte {
+	udp := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(udp[0:], srcPort)
+	binary.BigEndian.PutUint16(udp[2:], dstPort)
+	binary.BigEndian.PutUint16(udp[4:], uint16(len(udp)))
+	copy(udp[8:], payload)
+
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		ip := make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(udp)))
+		ip[8] = 64
+		ip[9] = 17
+		copy(ip[12:], src4)
+		copy(ip[16:], dst4)
+		binary.BigEndian.PutUint16(ip[10:], checksum(ip, 0))
+		// UDP checksum is optional over IPv4
+		return append(ip, udp...)
+	}
+
+	ip := make([]byte, 40)
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(udp)))
+	ip[6] = 17
+	ip[7] = 64
+	copy(ip[8:], src.To16())
+	copy(ip[24:], dst.To16())
+
+	// Pseudo-header: addresses, length and next header
+	pseudo := append(append([]byte{}, ip[8:40]...), 0, 0, byte(len(udp)>>8), byte(len(udp)), 0, 0, 0, 17)
+	var sum uint32
+	for i := 0; i < len(pseudo); i += 2 {
+		sum += uint32(pseudo[i])<<8 | uint32(pseudo[i+1])
+	}
+	binary.BigEndian.PutUint16(udp[6:], checksum(udp, sum))
+	return append(ip, udp...)
+}
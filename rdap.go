@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+// IANA registry mapping TLDs to their RDAP servers (RFC 9224)
+const rdapBootstrapURL = "https://data.iana.org/rdap/dns.json"
+
+func rdapGet(ctx context.Context, u string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/rdap+json, application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type rdapBootstrap struct {
+	// Each service is [[tld, ...], [base URL, ...]]
+	Services [][][]string `json:"services"`
+}
+
+// baseURL returns RDAP server URL for the domain, matching the longest
+// registered suffix.
+func (b *rdapBootstrap) baseURL(domain string) (string, error) {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	for i := range labels {
+		suffix := strings.Join(labels[i:], ".")
+		for _, service := range b.Services {
+			if len(service) != 2 || len(service[1]) == 0 {
+				continue
+			}
+			for _, entry := range service[0] {
+				if entry != suffix {
+					continue
+				}
+				// Prefer HTTPS if several URLs are listed
+				for _, u := range service[1] {
+					if strings.HasPrefix(u, "https://") {
+						return u, nil
+					}
+				}
+				return service[1][0], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no RDAP server known for %s", domain)
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// registrarNameservers returns the nameservers of the domain registered at
+// the registry.
+func registrarNameservers(ctx context.Context, bootstrap *rdapBootstrap, domain string) ([]string, error) {
+	base, err := bootstrap.baseURL(domain)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+
+	var resp struct {
+		Nameservers []struct {
+			LDHName string `json:"ldhName"`
+		} `json:"nameservers"`
+	}
+	if err := rdapGet(ctx, base+"domain/"+url.PathEscape(domain), &resp); err != nil {
+		return nil, err
+	}
+
+	var nss []string
+	for _, ns := range resp.Nameservers {
+		nss = append(nss, normalizeHost(ns.LDHName))
+	}
+	sort.Strings(nss)
+	return nss, nil
+}
+
+// expectedNameservers returns the nameservers the domain is expected to be
+// delegated to: the DNSControl nameservers of the domain, or its apex NS
+// records if there are none.
+func expectedNameservers(dom domain) []string {
+	set := map[string]bool{}
+	for _, ns := range dom.Nameservers {
+		set[normalizeHost(ns.Name)] = true
+	}
+	if len(set) == 0 {
+		for _, r := range dom.Records {
+			if r.Type == "NS" && r.Name == "@" {
+				set[normalizeHost(r.Target)] = true
+			}
+		}
+	}
+	nss := maps.Keys(set)
+	sort.Strings(nss)
+	return nss
+}
+
+// runRegistrarChecks compares the nameservers registered for every domain
+// with the expected ones.
+func runRegistrarChecks(domains []domain) []checkResult {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var bootstrap rdapBootstrap
+	bootstrapErr := rdapGet(ctx, rdapBootstrapURL, &bootstrap)
+
+	var results []checkResult
+	for _, dom := range domains {
+		expected := expectedNameservers(dom)
+		if len(expected) == 0 {
+			continue
+		}
+
+		cr := checkResult{Domain: dom.Name, Name: dom.Name, Type: "NS", NS: "registrar (RDAP)"}
+		if bootstrapErr != nil {
+			cr.Err = codedErrorf(codeExternalServiceFail, "failed to fetch RDAP bootstrap registry: %w", bootstrapErr)
+		} else if registered, err := registrarNameservers(ctx, &bootstrap, dom.Name); err != nil {
+			cr.Err = withCode(codeExternalServiceFail, err)
+		} else if strings.Join(registered, " ") != strings.Join(expected, " ") {
+			cr.Err = codedErrorf(codeDelegationMismatch, "registrar delegates to %v, expected %v", registered, expected)
+		}
+
+		printProgress(cr.Err)
+		results = append(results, cr)
+	}
+	return results
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// HTTP status of the answer to the pseudo-records DNSControl has providers
+// serve as HTTP redirects rather than DNS records. FRAME pages embed the
+// target instead of redirecting to it.
+var redirectStatus = map[string]int{
+	"URL":    http.StatusFound,
+	"URL301": http.StatusMovedPermanently,
+	"FRAME":  http.StatusOK,
+}
+
+func isRedirect(typ string) bool {
+	_, ok := redirectStatus[typ]
+	return ok
+}
+
+// Most of a framing page that is read looking for the target
+const maxFramePage = 1 << 20
+
+// checkRedirect requests the name over HTTP, resolving it on the resolver,
+// and checks that it redirects to or frames the target of the record. The
+// returned entry is that of the address query.
+func (c *checker) checkRedirect(ns string, name string, exp expectation) (*queryEntry, error) {
+	host := strings.TrimSuffix(name, ".")
+	e := c.lookup(ns, host, "A")
+	if e.err != nil {
+		return e, e.err
+	}
+	var addrs []string
+	for _, rr := range e.resp.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			addrs = append(addrs, a.A.String())
+		}
+	}
+	if len(addrs) == 0 {
+		return e, codedErrorf(codeCountMismatch, "expected A records of the redirect service, got none")
+	}
+
+	// The request goes to the addresses the resolver has, whatever the
+	// system resolver says
+	var d net.Dialer
+	client := &http.Client{
+		Timeout: c.transports.timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				_, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				return d.DialContext(ctx, network, net.JoinHostPort(addrs[0], port))
+			},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get("http://" + host + "/")
+	if err != nil {
+		return e, codedErrorf(codeHTTPFailed, "%v", err)
+	}
+	defer resp.Body.Close()
+	return e, verifyRedirect(resp, exp)
+}
+
+// verifyRedirect checks the HTTP answer against the target of the record.
+func verifyRedirect(resp *http.Response, exp expectation) error {
+	target := exp.records[0].Target
+	if want := redirectStatus[exp.typ]; resp.StatusCode != want {
+		return codedErrorf(codeRedirectMismatch, "expected HTTP status %d, got %s", want, resp.Status)
+	}
+	if exp.typ == "FRAME" {
+		page, err := io.ReadAll(io.LimitReader(resp.Body, maxFramePage))
+		if err != nil {
+			return codedErrorf(codeHTTPFailed, "%v", err)
+		}
+		if !strings.Contains(string(page), target) {
+			return codedErrorf(codeRedirectMismatch, "expected a page framing %s", target)
+		}
+		return nil
+	}
+	location := resp.Header.Get("Location")
+	if !sameURL(location, target) {
+		return codedErrorf(codeRedirectMismatch, "expected redirect to %s, got %q", target, location)
+	}
+	return nil
+}
+
+// sameURL compares URLs, taking an empty path for /.
+func sameURL(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	for _, u := range []*url.URL{ua, ub} {
+		u.Scheme, u.Host = strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+	return ua.String() == ub.String()
+}
+
+// redirectProblem returns what is wrong with the target of a redirect
+// pseudo-record, or "" if nothing is.
+func redirectProblem(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Sprintf("invalid redirect target %q", target)
+	}
+	return ""
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultRegoQuery = "data.control.violations"
+
+// regoRecord is an expected record as passed to Rego policies, in the same
+// format as in DNSControl output.
+type regoRecord struct {
+	Type         string            `json:"type"`
+	Name         string            `json:"name"`
+	TTL          int               `json:"ttl"`
+	Target       string            `json:"target"`
+	CAATag       string            `json:"caatag,omitempty"`
+	MXPreference int               `json:"mxpreference,omitempty"`
+	SRVPriority  int               `json:"srvpriority,omitempty"`
+	SRVWeight    int               `json:"srvweight,omitempty"`
+	SRVPort      int               `json:"srvport,omitempty"`
+	TXTStrings   []string          `json:"txtstrings,omitempty"`
+	Meta         map[string]string `json:"meta,omitempty"`
+	Source       string            `json:"source,omitempty"`
+}
+
+type regoDomain struct {
+	Name    string       `json:"name"`
+	Records []regoRecord `json:"records"`
+}
+
+// regoInput is the input document of Rego policies.
+type regoInput struct {
+	Domains []regoDomain `json:"domains"`
+	Results []resultJSON `json:"results"`
+}
+
+// regoViolation is an element of the set or array the policy query
+// evaluates to: either a message, or an object attributing it to a record,
+// with the name relative to the domain as in records or absolute.
+type regoViolation struct {
+	Domain  string `json:"domain"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (v *regoViolation) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &v.Message); err == nil {
+		return nil
+	}
+	type plain regoViolation
+	return json.Unmarshal(b, (*plain)(v))
+}
+
+type regoOptions struct {
+	opa    string // path to the opa binary
+	policy string
+	query  string
+}
+
+func newRegoInput(domains []domain, res *runResult) regoInput {
+	in := regoInput{Domains: []regoDomain{}, Results: []resultJSON{}}
+	for _, dom := range domains {
+		rd := regoDomain{Name: dom.Name, Records: []regoRecord{}}
+		for _, r := range dom.Records {
+			rd.Records = append(rd.Records, regoRecord{
+				Type:         r.Type,
+				Name:         r.Name,
+				TTL:          r.TTL,
+				Target:       r.Target,
+				CAATag:       r.CAATag,
+				MXPreference: r.MXPreference,
+				SRVPriority:  r.SRVPriority,
+				SRVWeight:    r.SRVWeight,
+				SRVPort:      r.SRVPort,
+				TXTStrings:   r.TXTStrings,
+				Meta:         r.Meta,
+				Source:       r.source,
+			})
+		}
+		in.Domains = append(in.Domains, rd)
+	}
+	for _, r := range res.Results {
+		in.Results = append(in.Results, newResultJSON(r))
+	}
+	return in
+}
+
+// evalRego evaluates the query of the policy with opa, returning the
+// violations.
+func evalRego(ctx context.Context, opts regoOptions, in regoInput) ([]regoViolation, error) {
+	input, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, opts.opa, "eval", "--format", "json", "--stdin-input", "--data", opts.policy, opts.query)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return nil, fmt.Errorf("opa eval failed: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("opa eval failed: %w", err)
+	}
+
+	var out struct {
+		Result []struct {
+			Expressions []struct {
+				Value []regoViolation `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, fmt.Errorf("failed to parse output of opa eval, %s has to be a set or an array of violations: %w", opts.query, err)
+	}
+
+	var violations []regoViolation
+	for _, r := range out.Result {
+		for _, e := range r.Expressions {
+			violations = append(violations, e.Value...)
+		}
+	}
+	return violations, nil
+}
+
+// Section of the report for violations not attributed to a domain
+const regoDomainless = "policy"
+
+// runRegoChecks evaluates the Rego policy against the expected records and
+// the results, returning a failed result per violation.
+func runRegoChecks(ctx context.Context, domains []domain, res *runResult, opts regoOptions) ([]checkResult, error) {
+	violations, err := evalRego(ctx, opts, newRegoInput(domains, res))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []checkResult
+	for _, v := range violations {
+		cr := checkResult{
+			Domain: v.Domain,
+			Name:   v.Name,
+			Type:   v.Type,
+			NS:     "rego",
+			Err:    withCode(codePolicyViolation, errors.New(v.Message)),
+		}
+		if cr.Domain == "" {
+			cr.Domain = regoDomainless
+		}
+		switch {
+		case cr.Name == "":
+			cr.Name = cr.Domain
+		case strings.HasSuffix(cr.Name, "."):
+			cr.Name = strings.TrimSuffix(cr.Name, ".")
+		case v.Domain != "":
+			// Relative, as in the records
+			cr.Name = absolutize(cr.Domain, cr.Name)
+		}
+		results = append(results, cr)
+	}
+	return results, nil
+}
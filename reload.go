@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// How often files are checked for changes with -watch-config
+const watchInterval = 2 * time.Second
+
+// daemonSource re-reads what the daemons check on reload.
+type daemonSource struct {
+	// DNSControl output, read once from stdin if empty
+	inputPath  string
+	configPath string
+	format     string
+	strict     bool
+	tags       tagFilter
+	// Substitute variables in the input, from the values file if set
+	expandVars bool
+	valuesPath string
+
+	// Domains read from stdin
+	domains []domain
+	// Options from the command line, before applying the config
+	opts     runOptions
+	interval time.Duration
+}
+
+// load reads the input and the config again and sets up the daemons for
+// them.
+func (s *daemonSource) load() ([]*daemon, error) {
+	domains := s.domains
+	if s.inputPath != "" {
+		var err error
+		var vars *inputVars
+		if s.expandVars {
+			if vars, err = loadInputVars(s.valuesPath); err != nil {
+				return nil, err
+			}
+		}
+		if domains, err = loadInput(s.inputPath, s.format, s.strict, vars); err != nil {
+			return nil, err
+		}
+		domains = s.tags.apply(domains)
+		if err := validatePriorities(domains); err != nil {
+			return nil, err
+		}
+		if err := validateVerifyMeta(domains); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := &config{}
+	if s.configPath != "" {
+		var err error
+		if cfg, err = loadConfig(s.configPath); err != nil {
+			return nil, err
+		}
+	}
+	opts := s.opts.withConfig(cfg)
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return newDaemons(domains, opts, s.interval, cfg.Tenants)
+}
+
+// loadInput reads the expected records in the format from the file,
+// substituting the variables unless vars is nil.
+func loadInput(path string, format string, strict bool, vars *inputVars) ([]domain, error) {
+	var domains []domain
+	err := loadInputFunc(path, format, strict, vars, func(d domain) error {
+		domains = append(domains, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// loadInputFunc is loadInput passing every domain to fn as soon as it is
+// read, see decodeInputFunc.
+func loadInputFunc(path string, format string, strict bool, vars *inputVars, fn func(domain) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := decodeInputFunc(bufio.NewReader(f), format, strict, vars, fn); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// reloadDaemons replaces the settings of the running daemons with the ones
+// just loaded, keeping their results and history. Tenants can't be added or
+// removed without a restart, as their endpoints are already being served.
+func reloadDaemons(daemons []*daemon, loaded []*daemon) error {
+	if len(loaded) != len(daemons) {
+		return fmt.Errorf("tenants changed, restart to apply")
+	}
+	for i, d := range daemons {
+		if loaded[i].tenant != d.tenant {
+			return fmt.Errorf("tenants changed, restart to apply")
+		}
+	}
+	for i, d := range daemons {
+		d.update(loaded[i].settings())
+	}
+	return nil
+}
+
+// modTimes returns the modification times of the files, zero for the ones
+// failing to stat.
+func modTimes(paths []string) []time.Time {
+	times := make([]time.Time, len(paths))
+	for i, path := range paths {
+		if fi, err := os.Stat(path); err == nil {
+			times[i] = fi.ModTime()
+		}
+	}
+	return times
+}
+
+// watchReload reloads the daemons on SIGHUP and, if watch is set, on changes
+// of the input or config files. A failed reload keeps the daemons running
+// as they were.
+func watchReload(ctx context.Context, daemons []*daemon, src *daemonSource, watch bool) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var paths []string
+	for _, path := range []string{src.inputPath, src.configPath} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	var tick <-chan time.Time
+	if watch && len(paths) > 0 {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	last := modTimes(paths)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+			times := modTimes(paths)
+			changed := false
+			for i := range times {
+				if !times[i].Equal(last[i]) {
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+		}
+		last = modTimes(paths)
+
+		loaded, err := src.load()
+		if err == nil {
+			err = reloadDaemons(daemons, loaded)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Reload failed, keeping the previous configuration: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Reloaded configuration\n")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// printProgress marks a finished check while the run is in progress.
+func printProgress(err error) {
+	if err != nil {
+		fmt.Print("F")
+	} else {
+		fmt.Print(".")
+	}
+}
+
+// domainReport holds the results of a single domain, or of a single owner.
+type domainReport struct {
+	name     string
+	results  []checkResult
+	passed   int
+	failed   int
+	outvoted int
+}
+
+// reportByDomain splits results by domain, in the order of the input, with
+// the results of each domain sorted by name, type and resolver.
+func reportByDomain(domains []domain, res *runResult) []*domainReport {
+	var reports []*domainReport
+	byName := map[string]*domainReport{}
+	add := func(name string) *domainReport {
+		if dr, ok := byName[name]; ok {
+			return dr
+		}
+		dr := &domainReport{name: name}
+		byName[name] = dr
+		reports = append(reports, dr)
+		return dr
+	}
+	for _, dom := range domains {
+		add(dom.Name)
+	}
+
+	for _, r := range res.Results {
+		add(r.Domain).add(r)
+	}
+
+	for _, dr := range reports {
+		sort.SliceStable(dr.results, func(i, j int) bool {
+			return lessResult(dr.results[i], dr.results[j])
+		})
+	}
+	return reports
+}
+
+func (dr *domainReport) add(r checkResult) {
+	dr.results = append(dr.results, r)
+	switch {
+	case r.Err == nil:
+		dr.passed++
+	case r.Outvoted:
+		dr.outvoted++
+	default:
+		dr.failed++
+	}
+}
+
+// lessResult orders results by name, type and resolver.
+func lessResult(a, b checkResult) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	if a.Type != b.Type {
+		return a.Type < b.Type
+	}
+	return a.NS < b.NS
+}
+
+// printReport prints a section per domain with its pass/fail counts and the
+// failed checks.
+func printReport(w io.Writer, domains []domain, res *runResult, dumpResponses bool) {
+	fmt.Fprintln(w)
+	printSections(w, reportByDomain(domains, res), dumpResponses)
+}
+
+func printSections(w io.Writer, reports []*domainReport, dumpResponses bool) {
+	for _, dr := range reports {
+		if len(dr.results) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s: %d passed, %d failed", dr.name, dr.passed, dr.failed)
+		if dr.outvoted > 0 {
+			fmt.Fprintf(w, ", %d outvoted", dr.outvoted)
+		}
+		fmt.Fprintln(w)
+
+		for i := 0; i < len(dr.results); {
+			group := sameRecordSet(dr.results[i:])
+			i += len(group)
+
+			if identicalFailures(group) {
+				r := group[0]
+				fmt.Fprintf(w, "  %s %s (all %d resolvers): %s: %v", typeLabel(r), r.Name, len(group), errorCode(r.Err), r.Err)
+				if r.Cause != "" {
+					fmt.Fprintf(w, " (%s)", r.Cause)
+				}
+				fmt.Fprintln(w)
+				printSource(w, r)
+				if dumpResponses && r.Response != nil {
+					fmt.Fprint(w, dumpResponse(r.Response, r.Transport))
+				}
+				continue
+			}
+
+			var failed checkResult
+			for _, r := range group {
+				if r.Err == nil {
+					continue
+				}
+				failed = r
+				at := viewLabel(r.NS, r.View)
+				if r.Instance != "" {
+					at += ", instance " + r.Instance
+				}
+				fmt.Fprintf(w, "  %s %s (at %s): %s: %v", typeLabel(r), r.Name, at, errorCode(r.Err), r.Err)
+				if r.Cause != "" {
+					fmt.Fprintf(w, " (%s)", r.Cause)
+				}
+				if r.Outvoted {
+					fmt.Fprint(w, " (outvoted by quorum)")
+				}
+				if r.Untrusted != "" {
+					fmt.Fprint(w, " (untrusted resolver)")
+				}
+				fmt.Fprintln(w)
+				if dumpResponses && r.Response != nil {
+					fmt.Fprint(w, dumpResponse(r.Response, r.Transport))
+				}
+			}
+			printSource(w, failed)
+		}
+	}
+}
+
+// sameRecordSet returns the leading results that are of the same record set
+// as the first one.
+func sameRecordSet(results []checkResult) []checkResult {
+	n := 1
+	for n < len(results) && results[n].Name == results[0].Name && results[n].Type == results[0].Type {
+		n++
+	}
+	return results[:n]
+}
+
+// identicalFailures returns whether the record set failed the same way on
+// every one of several resolvers.
+func identicalFailures(results []checkResult) bool {
+	if len(results) < 2 {
+		return false
+	}
+	for _, r := range results {
+		if r.Err == nil || r.Outvoted {
+			return false
+		}
+		if errorCode(r.Err) != errorCode(results[0].Err) || r.Err.Error() != results[0].Err.Error() {
+			return false
+		}
+	}
+	return true
+}
+
+// printSource prints where the records of a failed check are defined, if
+// known.
+func printSource(w io.Writer, r checkResult) {
+	if r.Source != "" {
+		fmt.Fprintf(w, "    defined at %s\n", r.Source)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// reporter is told about a run as it goes, to present its results in a
+// format of its own. Start is called once before the checks, with the domains
+// to check or nil if they are read as they are checked, Result as every
+// record check finishes, possibly from several goroutines at once, and
+// Summary once with the results of all checks of the run, including the
+// ones not passed to Result, e.g. of rules or the apex.
+type reporter interface {
+	Start(domains []domain)
+	Result(r checkResult)
+	Summary(res *runResult) error
+}
+
+// reporters passes everything on to each of them in turn, stopping at the
+// first failing Summary.
+type reporters []reporter
+
+func (rs reporters) Start(domains []domain) {
+	for _, r := range rs {
+		r.Start(domains)
+	}
+}
+
+func (rs reporters) Result(cr checkResult) {
+	for _, r := range rs {
+		r.Result(cr)
+	}
+}
+
+func (rs reporters) Summary(res *runResult) error {
+	for _, r := range rs {
+		if err := r.Summary(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resultDone reports a finished record check, as a progress mark if the run
+// has no reporter.
+func (o runOptions) resultDone(r checkResult) {
+	if o.reporter == nil {
+		printProgress(r.Err)
+		return
+	}
+	o.reporter.Result(r)
+}
+
+// consoleReporter prints the progress and the report to the terminal, with
+// the template, by owner or by domain.
+type consoleReporter struct {
+	w             io.Writer
+	tmpl          *template.Template
+	groupBy       string
+	dumpResponses bool
+
+	domains []domain
+}
+
+func (c *consoleReporter) Start(domains []domain) { c.domains = domains }
+
+func (c *consoleReporter) Result(r checkResult) { printProgress(r.Err) }
+
+func (c *consoleReporter) Summary(res *runResult) error {
+	switch {
+	case c.tmpl != nil:
+		if err := printTemplateReport(c.w, c.tmpl, res); err != nil {
+			return fmt.Errorf("template: %w", err)
+		}
+	case c.groupBy == groupByOwner:
+		printOwnerReport(c.w, res, c.dumpResponses)
+	default:
+		printReport(c.w, c.domains, res, c.dumpResponses)
+	}
+	return nil
+}
+
+// jsonReporter writes the results to a file as JSON, as -results-json.
+type jsonReporter struct {
+	path string
+}
+
+func (j jsonReporter) Start([]domain)     {}
+func (j jsonReporter) Result(checkResult) {}
+
+func (j jsonReporter) Summary(res *runResult) error {
+	if err := writeResultsJSON(j.path, res); err != nil {
+		return fmt.Errorf("JSON results: %w", err)
+	}
+	return nil
+}
+
+// junitReporter writes the results to a file as JUnit XML, which CI systems
+// show as test reports: a test suite per domain and a test case per check.
+type junitReporter struct {
+	path string
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     float64      `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	// Why a failure does not count, e.g. outvoted by quorum
+	SystemOut string `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (j junitReporter) Start([]domain)     {}
+func (j junitReporter) Result(checkResult) {}
+
+func (j junitReporter) Summary(res *runResult) error {
+	b, err := xml.MarshalIndent(newJUnitSuites(res), "", "  ")
+	if err == nil {
+		err = writeFileAtomic(j.path, append([]byte(xml.Header), append(b, '\n')...))
+	}
+	if err != nil {
+		return fmt.Errorf("JUnit report: %w", err)
+	}
+	return nil
+}
+
+func newJUnitSuites(res *runResult) junitSuites {
+	out := junitSuites{Name: "control", Time: res.Finished.Sub(res.Started).Seconds()}
+	for _, dr := range reportByDomain(nil, res) {
+		suite := junitSuite{Name: dr.name}
+		for _, r := range dr.results {
+			tc := junitCase{ClassName: dr.name, Name: fmt.Sprintf("%s %s on %s", typeLabel(r), r.Name, viewLabel(r.NS, r.View))}
+			if r.Timing != nil {
+				tc.Time = r.Timing.Query.Seconds()
+			}
+			switch {
+			case r.Err == nil:
+			case r.Outvoted:
+				tc.SystemOut = fmt.Sprintf("outvoted by quorum: %s: %v", errorCode(r.Err), r.Err)
+			default:
+				var details []string
+				if r.Cause != "" {
+					details = append(details, r.Cause)
+				}
+				if r.Source != "" {
+					details = append(details, "defined at "+r.Source)
+				}
+				tc.Failure = &junitFailure{Type: errorCode(r.Err), Message: r.Err.Error(), Text: strings.Join(details, "\n")}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Tests = len(suite.Cases)
+		out.Tests += suite.Tests
+		out.Failures += suite.Failures
+		out.Suites = append(out.Suites, suite)
+	}
+	return out
+}
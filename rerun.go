@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+const retryUsage = `Usage: control retry --from <results.json> [flags]
+
+Checks again only the record sets that failed in the results written by
+-results-json of a previous run, on all resolvers, e.g. while waiting for the
+last resolvers to pick up a change:
+
+    control -input records.json -results-json results.json
+    control retry --from results.json -input records.json
+
+Takes the same flags as a check of all records.
+
+Flags:
+`
+
+// runRetry checks the record sets that failed in the results given with
+// --from, as a check of all records with -only-failed does.
+func runRetry(args []string) int {
+	fs := flag.NewFlagSet("retry", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), retryUsage)
+		fs.PrintDefaults()
+	}
+	var from string
+	fs.Func("from", "-results-json output of the run to check the failed record sets of again (required)", func(v string) error {
+		from = v
+		return fs.Set("only-failed", v)
+	})
+	runCheck(fs, args, func() error {
+		if from == "" {
+			return errors.New("--from is required")
+		}
+		return nil
+	})
+	return 0
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const compareUsage = `Usage: control compare [flags] <old.json> <new.json>
+
+Compares the results written by -results-json of two runs, e.g. of the
+last two nightly ones, and reports the checks that newly fail, newly pass
+and still fail. Exits with 1 if any check newly fails.
+
+Flags:
+`
+
+// resultDelta lists the checks whose outcome changed between two runs, or
+// didn't while failing. Checks only in the new run count as passing before.
+type resultDelta struct {
+	NewlyFailing []checkResult
+	NewlyPassing []checkResult
+	StillFailing []checkResult
+}
+
+func (d resultDelta) MarshalJSON() ([]byte, error) {
+	results := func(rs []checkResult) []resultJSON {
+		out := []resultJSON{}
+		for _, r := range rs {
+			out = append(out, newResultJSON(r))
+		}
+		return out
+	}
+	return json.Marshal(struct {
+		NewlyFailing []resultJSON `json:"newly_failing"`
+		NewlyPassing []resultJSON `json:"newly_passing"`
+		StillFailing []resultJSON `json:"still_failing"`
+	}{results(d.NewlyFailing), results(d.NewlyPassing), results(d.StillFailing)})
+}
+
+func failedResult(r checkResult) bool {
+	return r.Err != nil && !r.Outvoted
+}
+
+// diffResults compares the results of every check on the same resolver in
+// two runs. The results of the new run are reported, newly passing ones with
+// the failure of the old run.
+func diffResults(old *runResult, cur *runResult) resultDelta {
+	was := map[resultKey]checkResult{}
+	for _, r := range old.Results {
+		was[checkKey(r)] = r
+	}
+
+	var d resultDelta
+	for _, r := range cur.Results {
+		prev, ok := was[checkKey(r)]
+		switch {
+		case failedResult(r) && ok && failedResult(prev):
+			d.StillFailing = append(d.StillFailing, r)
+		case failedResult(r):
+			d.NewlyFailing = append(d.NewlyFailing, r)
+		case ok && failedResult(prev):
+			r.Err, r.Cause = prev.Err, prev.Cause
+			d.NewlyPassing = append(d.NewlyPassing, r)
+		}
+	}
+	for _, rs := range [][]checkResult{d.NewlyFailing, d.NewlyPassing, d.StillFailing} {
+		sort.SliceStable(rs, func(i, j int) bool {
+			if rs[i].Domain != rs[j].Domain {
+				return rs[i].Domain < rs[j].Domain
+			}
+			return lessResult(rs[i], rs[j])
+		})
+	}
+	return d
+}
+
+func printResultDelta(w io.Writer, d resultDelta) {
+	section := func(title string, rs []checkResult, verb string) {
+		fmt.Fprintf(w, "\n%s: %d\n", title, len(rs))
+		for _, r := range rs {
+			fmt.Fprintf(w, "  %s %s (at %s): %s%s: %v", r.Type, r.Name, viewLabel(r.NS, r.View), verb, errorCode(r.Err), r.Err)
+			if r.Cause != "" {
+				fmt.Fprintf(w, " (%s)", r.Cause)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	section("Newly failing", d.NewlyFailing, "")
+	section("Newly passing", d.NewlyPassing, "was ")
+	section("Still failing", d.StillFailing, "")
+}
+
+// runCompare implements the compare subcommand and returns the exit code.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), compareUsage)
+		fs.PrintDefaults()
+	}
+	deltaJSON := fs.String("json", "", "file to write the newly failing, newly passing and still failing checks to as JSON")
+
+	paths, err := parseFlagsInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(paths) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var runs [2]*runResult
+	for i, path := range paths {
+		if runs[i], err = readResultsJSON(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read results: %v\n", err)
+			return 1
+		}
+	}
+	d := diffResults(runs[0], runs[1])
+	printResultDelta(os.Stdout, d)
+
+	if *deltaJSON != "" {
+		b, err := json.MarshalIndent(d, "", "  ")
+		if err == nil {
+			err = writeFileAtomic(*deltaJSON, b)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write the comparison: %v\n", err)
+			return 1
+		}
+	}
+
+	if len(d.NewlyFailing) > 0 {
+		return 1
+	}
+	return 0
+}
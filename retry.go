@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBudget = 0.1
+	// Retries always allowed, so that small runs can retry at all
+	minRetryBudget = 10
+	// Delay before the first retry, doubled with every further one
+	retryBaseDelay = 50 * time.Millisecond
+)
+
+// retryBudget limits the retries and fallbacks of all queries sent by a
+// checker to a share of the queries, so that when many queries time out the
+// run does not take many times longer and send many times more queries.
+type retryBudget struct {
+	ratio float64
+
+	mu        sync.Mutex
+	queries   int
+	retries   int
+	exhausted bool
+}
+
+func newRetryBudget(ratio float64) *retryBudget {
+	return &retryBudget{ratio: ratio}
+}
+
+func (b *retryBudget) query() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.queries++
+}
+
+// allow returns whether another retry fits into the budget, and accounts for
+// it if so.
+func (b *retryBudget) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if float64(b.retries) >= b.ratio*float64(b.queries)+minRetryBudget {
+		if !b.exhausted {
+			b.exhausted = true
+			fmt.Fprintf(os.Stderr, "Retry budget exhausted after %d retries of %d queries, no longer retrying\n", b.retries, b.queries)
+		}
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// retryDelay returns a random delay before the retry, growing with the
+// number of attempts, so that retries of queries timed out together are
+// spread out.
+func retryDelay(attempt int) time.Duration {
+	return time.Duration(rand.Int63n(int64(retryBaseDelay << (attempt - 1))))
+}
+
+// retry waits before the attempt if it is a retry within the budget, or
+// returns false if there is no budget left.
+func (t *transports) retry(attempt int) bool {
+	if attempt == 0 {
+		t.budget.query()
+		return true
+	}
+	if !t.budget.allow() {
+		return false
+	}
+	time.Sleep(retryDelay(attempt))
+	return true
+}
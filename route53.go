@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Route 53 is a global service, signed for us-east-1
+var route53Endpoint = "https://route53.amazonaws.com"
+
+const route53Region = "us-east-1"
+
+// route53 reads zones via the Route 53 API with the credentials from the
+// standard AWS environment variables.
+type route53 struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+func newRoute53() (*route53, error) {
+	r := &route53{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+	if r.accessKey == "" || r.secretKey == "" {
+		return nil, fmt.Errorf("-route53 requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return r, nil
+}
+
+func (r *route53) name() string {
+	return "Route53"
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sign adds AWS Signature Version 4 headers to the GET request.
+func (r *route53) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if r.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", r.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host, "x-amz-date": amzDate}
+	if r.sessionToken != "" {
+		headers["x-amz-security-token"] = r.sessionToken
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(nil),
+	}, "\n")
+
+	scope := date + "/" + route53Region + "/route53/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+r.secretKey), date)
+	key = hmacSHA256(key, route53Region)
+	key = hmacSHA256(key, "route53")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", r.accessKey, scope, signedHeaders, signature))
+}
+
+func (r *route53) get(ctx context.Context, path string, query url.Values, out any) error {
+	u := route53Endpoint + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	r.sign(req, time.Now())
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr struct {
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("Route53 %s: %s: %s", path, resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("Route53 %s: %s", path, resp.Status)
+	}
+	return xml.NewDecoder(resp.Body).Decode(out)
+}
+
+// zoneID returns the ID of the public hosted zone.
+func (r *route53) zoneID(ctx context.Context, zone string) (string, error) {
+	var resp struct {
+		HostedZones []struct {
+			ID          string `xml:"Id"`
+			Name        string `xml:"Name"`
+			PrivateZone bool   `xml:"Config>PrivateZone"`
+		} `xml:"HostedZones>HostedZone"`
+	}
+	if err := r.get(ctx, "/2013-04-01/hostedzonesbyname", url.Values{"dnsname": {zone}}, &resp); err != nil {
+		return "", err
+	}
+	for _, hz := range resp.HostedZones {
+		if dns.CanonicalName(hz.Name) == dns.CanonicalName(zone) && !hz.PrivateZone {
+			return strings.TrimPrefix(hz.ID, "/hostedzone/"), nil
+		}
+	}
+	return "", fmt.Errorf("no public hosted zone %s in Route53", zone)
+}
+
+type route53RecordSet struct {
+	Name          string    `xml:"Name"`
+	Type          string    `xml:"Type"`
+	TTL           uint32    `xml:"TTL"`
+	SetIdentifier string    `xml:"SetIdentifier"`
+	AliasTarget   *struct{} `xml:"AliasTarget"`
+	Values        []string  `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+func (r *route53) records(ctx context.Context, zone string) (map[string]*providerRecordSet, error) {
+	id, err := r.zoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := map[string]*providerRecordSet{}
+	query := url.Values{}
+	for {
+		var resp struct {
+			RecordSets           []route53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+			IsTruncated          bool               `xml:"IsTruncated"`
+			NextRecordName       string             `xml:"NextRecordName"`
+			NextRecordType       string             `xml:"NextRecordType"`
+			NextRecordIdentifier string             `xml:"NextRecordIdentifier"`
+		}
+		if err := r.get(ctx, "/2013-04-01/hostedzone/"+id+"/rrset", query, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, rs := range resp.RecordSets {
+			// Route 53 escapes the wildcard label
+			name := strings.ReplaceAll(rs.Name, `\052`, "*")
+			key := providerKey(name, rs.Type)
+			set, ok := sets[key]
+			if !ok {
+				set = &providerRecordSet{}
+				sets[key] = set
+			}
+			// Aliases and routing policies have no single answer to compare
+			if rs.AliasTarget != nil || rs.SetIdentifier != "" {
+				set.skip = true
+				continue
+			}
+			for _, value := range rs.Values {
+				rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(name), rs.TTL, rs.Type, value))
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse %s %s record from Route53: %w", name, rs.Type, err)
+				}
+				set.rrs = append(set.rrs, rr)
+			}
+		}
+
+		if !resp.IsTruncated {
+			return sets, nil
+		}
+		query = url.Values{"name": {resp.NextRecordName}, "type": {resp.NextRecordType}}
+		if resp.NextRecordIdentifier != "" {
+			query.Set("identifier", resp.NextRecordIdentifier)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// recordMatcher selects records of a domain by name, type and value.
+type recordMatcher struct {
+	// Relative to the domain, "@" for the apex, any name if empty or "*"
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Regular expression the value has to match, any value if empty. Values
+	// are targets, TXT strings joined together, or "tag value" for CAA.
+	Value string `json:"value"`
+
+	re *regexp.Regexp
+}
+
+func (m *recordMatcher) anyName() bool {
+	return m.Name == "" || m.Name == "*"
+}
+
+func (m *recordMatcher) String() string {
+	name := m.Name
+	if m.anyName() {
+		name = "any name"
+	}
+	s := m.Type + " at " + name
+	if m.Value != "" {
+		s += " matching " + m.Value
+	}
+	return s
+}
+
+func (m *recordMatcher) compile() error {
+	if m.Type == "" {
+		return fmt.Errorf("no type")
+	}
+	m.Type = strings.ToUpper(m.Type)
+	re, err := regexp.Compile(m.Value)
+	if err != nil {
+		return err
+	}
+	m.re = re
+	return nil
+}
+
+func (m *recordMatcher) matches(name string, typ string, value string) bool {
+	return (m.anyName() || strings.EqualFold(m.Name, name)) && m.Type == typ && m.re.MatchString(value)
+}
+
+// matchesExpected returns whether any of the expected records matches.
+func (m *recordMatcher) matchesExpected(records []record) bool {
+	for _, r := range records {
+		if m.matches(r.Name, r.Type, recordValue(r)) {
+			return true
+		}
+	}
+	return false
+}
+
+// rule is a cross-record assertion about every domain: if any of its
+// records matches If (or If is not set), some record has to match Require,
+// or none may match Forbid.
+type rule struct {
+	Name    string         `json:"name"`
+	If      *recordMatcher `json:"if"`
+	Require *recordMatcher `json:"require"`
+	Forbid  *recordMatcher `json:"forbid"`
+}
+
+// assertion returns the matcher of the rule checked against the records and
+// whether records have to match it.
+func (r *rule) assertion() (*recordMatcher, bool) {
+	if r.Require != nil {
+		return r.Require, true
+	}
+	return r.Forbid, false
+}
+
+func loadRules(path string) ([]rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []rule
+	dec := json.NewDecoder(strings.NewReader(string(b)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if (r.Require == nil) == (r.Forbid == nil) {
+			return nil, fmt.Errorf("%s: %s: exactly one of require and forbid must be set", path, r.Name)
+		}
+		for _, m := range []*recordMatcher{r.If, r.Require, r.Forbid} {
+			if m == nil {
+				continue
+			}
+			if err := m.compile(); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, r.Name, err)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// recordValue returns the value of the expected record matched by rules.
+func recordValue(r record) string {
+	switch r.Type {
+	case "TXT":
+		return strings.Join(r.TXTStrings, "")
+	case "CAA":
+		return r.CAATag + " " + r.Target
+	}
+	return r.Target
+}
+
+// rrValue returns the value of the record in an answer matched by rules.
+func rrValue(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	case *dns.CNAME:
+		return rr.Target
+	case *dns.NS:
+		return rr.Ns
+	case *dns.MX:
+		return rr.Mx
+	case *dns.SRV:
+		return rr.Target
+	case *dns.TXT:
+		return strings.Join(rr.Txt, "")
+	case *dns.CAA:
+		return rr.Tag + " " + rr.Value
+	}
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
+
+// matchesLive returns whether any of the records served by the resolver for
+// the name of the matcher matches.
+func (c *checker) matchesLive(ns string, dom domain, m *recordMatcher) (bool, error) {
+	name := absolutize(dom.Name, m.Name)
+	resp, err := c.query(ns, name, m.Type)
+	var ce *codedError
+	if errors.As(err, &ce) && ce.code == codeNXDomain {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, rr := range resp.Answer {
+		if m.matches(m.Name, dns.TypeToString[rr.Header().Rrtype], rrValue(rr)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func violation(r *rule, m *recordMatcher, required bool, where string) error {
+	if required {
+		return codedErrorf(codeRuleViolation, "%s: no %s %s", r.Name, m, where)
+	}
+	return codedErrorf(codeRuleViolation, "%s: %s %s", r.Name, m, where)
+}
+
+// runRuleChecks evaluates the rules for every domain they apply to, against
+// the expected records and the answers of the first resolver. Rules
+// asserting about any name are only evaluated against the expected records.
+func runRuleChecks(domains []domain, rules []rule, opts runOptions) []checkResult {
+	c := newChecker(opts)
+	ns := opts.resolvers[0]
+
+	var results []checkResult
+	for _, dom := range domains {
+		for i := range rules {
+			r := &rules[i]
+			if r.If != nil && !r.If.matchesExpected(dom.Records) {
+				continue
+			}
+			m, required := r.assertion()
+
+			name := dom.Name
+			if !m.anyName() {
+				name = absolutize(dom.Name, m.Name)
+			}
+			cr := checkResult{Domain: dom.Name, Name: name, Type: m.Type, NS: "rules"}
+			if m.matchesExpected(dom.Records) != required {
+				cr.Err = violation(r, m, required, "in the expected records")
+			}
+			printProgress(cr.Err)
+			results = append(results, cr)
+
+			if m.anyName() {
+				continue
+			}
+			cr = checkResult{Domain: dom.Name, Name: name, Type: m.Type, NS: "rules at " + ns}
+			if matched, err := c.matchesLive(ns, dom, m); err != nil {
+				cr.Err = err
+			} else if matched != required {
+				cr.Err = violation(r, m, required, "served")
+			}
+			printProgress(cr.Err)
+			results = append(results, cr)
+		}
+	}
+	return results
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// sampled returns whether the record set is checked by -samples: address
+// sets of several records, which providers may answer with a part of.
+func (c *checker) sampled(exp expectation) bool {
+	return c.samples > 1 && (exp.typ == "A" || exp.typ == "AAAA") && len(exp.records) > 1 && !exp.proxied
+}
+
+// checkSamples queries the record set as many times as -samples, the first
+// answer being resp, and checks that every answer has only expected
+// addresses and that every expected address is in at least one of them.
+func (c *checker) checkSamples(ns string, name string, exp expectation, resp *dns.Msg) error {
+	expected := map[string]bool{}
+	for _, r := range exp.compare.records(exp.records) {
+		expected[r.Target] = true
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < c.samples; i++ {
+		if i > 0 {
+			// Sent directly, as the lookups of a run are answered once
+			var err error
+			if resp, _, err = query(c.transports, ns, name, exp.typ, exp.qclass()); err != nil {
+				return err
+			}
+		}
+		var got int
+		for _, rr := range resp.Answer {
+			if dns.TypeToString[rr.Header().Rrtype] != exp.typ {
+				continue
+			}
+			got++
+			if rr.Header().Ttl > uint32(exp.records[0].TTL) {
+				return codedErrorf(codeTTLExceeded, "expected ttl %d, got %d", exp.records[0].TTL, rr.Header().Ttl)
+			}
+			v := rrValue(rr)
+			if !expected[v] {
+				return codedErrorf(codeValueMismatch, "unexpected address %s in answer %d of %d", v, i+1, c.samples)
+			}
+			seen[v] = true
+		}
+		if got == 0 {
+			return codedErrorf(codeCountMismatch, "no %s records in answer %d of %d", exp.typ, i+1, c.samples)
+		}
+	}
+
+	var missing []string
+	for v := range expected {
+		if !seen[v] {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return codedErrorf(codePoolMemberMissing, "addresses %s not in any of %d answers", strings.Join(missing, ", "), c.samples)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// How long after the cached answer expires a record set is re-checked, for
+// resolvers to have refreshed it
+const ttlGrace = 2 * time.Second
+
+// schedule is when each record set is due for a re-check with -ttl-schedule.
+type schedule map[resultKey]time.Time
+
+// responseTTL returns how long the resolver is going to serve the response
+// from its cache: the lowest TTL of the answer or, for negative answers, of
+// the SOA in the authority section.
+func responseTTL(resp *dns.Msg) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	if len(resp.Answer) > 0 {
+		ttl := resp.Answer[0].Header().Ttl
+		for _, rr := range resp.Answer[1:] {
+			if rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+		return time.Duration(ttl) * time.Second, true
+	}
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl := soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+			return time.Duration(ttl) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// scheduleRecordSets schedules the re-check of every record set of the run,
+// from when its own checks were answered rather than the end of the run. A
+// failed one is re-checked as soon as the answers cached by the failing
+// resolvers expire, and at most interval later. A passing one is re-checked
+// after interval or, if later, once its answers expire, as the resolvers
+// would serve the same ones from their caches until then.
+func scheduleRecordSets(res *runResult, interval time.Duration) schedule {
+	type span struct {
+		failed bool
+		// Last answer to the checks of the record set
+		checked time.Time
+		// When the last cached answer expires, or the first one of a
+		// failing resolver
+		expires time.Time
+		known   bool
+	}
+	spans := map[resultKey]*span{}
+	for _, r := range res.Results {
+		key := setKey(r)
+		sp, ok := spans[key]
+		if !ok {
+			sp = &span{}
+			spans[key] = sp
+		}
+		answered := res.Finished
+		if r.Timing != nil {
+			answered = r.Timing.Started.Add(r.Timing.Query)
+		}
+		if answered.After(sp.checked) {
+			sp.checked = answered
+		}
+		failed := r.Err != nil && !r.Outvoted
+		if failed && !sp.failed {
+			*sp = span{failed: true, checked: sp.checked}
+		}
+		if failed != sp.failed {
+			continue
+		}
+		ttl, ok := responseTTL(r.Response)
+		if !ok {
+			continue
+		}
+		expires := answered.Add(ttl)
+		if !sp.known || (failed && expires.Before(sp.expires)) || (!failed && expires.After(sp.expires)) {
+			sp.expires, sp.known = expires, true
+		}
+	}
+
+	sched := schedule{}
+	for key, sp := range spans {
+		due := sp.checked.Add(interval)
+		refreshed := sp.expires.Add(ttlGrace)
+		switch {
+		case !sp.known:
+		case sp.failed && refreshed.Before(due):
+			due = refreshed
+		case !sp.failed && refreshed.After(due):
+			due = refreshed
+		}
+		sched[key] = due
+	}
+	return sched
+}
+
+// next returns when the first record set is due.
+func (s schedule) next() time.Time {
+	var first time.Time
+	for _, t := range s {
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+	return first
+}
+
+// due returns the record sets due by the time, including the ones due
+// within a second to re-check them together.
+func (s schedule) due(now time.Time) map[resultKey]bool {
+	due := map[resultKey]bool{}
+	for key, t := range s {
+		if !t.After(now.Add(time.Second)) {
+			due[key] = true
+		}
+	}
+	return due
+}
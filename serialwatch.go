@@ -0,0 +1,258 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const serialWatchUsage = `Usage: control serial-watch [flags] <zone>...
+
+Polls the SOA serial of the zones on their authoritative servers and on the
+resolvers until all of them serve the same one, e.g. right after a push and
+before checking every record:
+
+    dnscontrol push && control serial-watch example.com && dnscontrol print-ir | control
+
+Flags:
+`
+
+// serialServer is a server a zone's serial is polled on.
+type serialServer struct {
+	// Authoritative servers are asked without recursion
+	auth  bool
+	addr  string
+	label string
+}
+
+// watchedZone is the state of a zone polled by serial-watch.
+type watchedZone struct {
+	name    string
+	servers []serialServer
+	// Serial last seen per server, or the error getting it
+	serials map[string]uint32
+	errs    map[string]error
+	// Servers serving the target serial, the one the others converge on
+	converged map[string]bool
+	target    uint32
+	// No authoritative server has answered yet without -serial
+	noTarget bool
+	done     bool
+}
+
+// runSerialWatch implements the serial-watch subcommand and returns the exit
+// code: 0 if every zone converged in time.
+func runSerialWatch(args []string) int {
+	fs := flag.NewFlagSet("serial-watch", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), serialWatchUsage)
+		fs.PrintDefaults()
+	}
+	resolvers := fs.String("ns", strings.Join(nss, ","), "comma-separated list of resolvers to poll, the first of which looks up the nameservers of the zones")
+	timeout := fs.Duration("timeout", 2*time.Second, "timeout for a single query")
+	retries := fs.Int("retries", 1, "number of times to retry a query over UDP on timeout")
+	fallback := fs.String("fallback", "tcp", "comma-separated transports to fall back to after UDP timeouts: tcp, tls, https")
+	iface := fs.String("interface", "", "network interface to send queries through")
+	useProfiles := fs.Bool("resolver-profiles", false, "query Google, Cloudflare and Quad9 public resolvers at their rates, retries and fallback transports, unless -retries or -fallback is given")
+	wait := fs.Duration("wait", 10*time.Minute, "time to wait for the serials to converge")
+	interval := fs.Duration("interval", 5*time.Second, "interval between polls")
+	serial := fs.String("serial", "", "serial to wait for (default: the highest one on the authoritative servers)")
+
+	zones, err := parseFlagsInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(zones) == 0 {
+		fs.Usage()
+		return 2
+	}
+	var want uint32
+	if *serial != "" {
+		n, err := strconv.ParseUint(*serial, 10, 32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -serial %q\n", *serial)
+			return 2
+		}
+		want = uint32(n)
+	}
+
+	opts := runOptions{
+		resolvers: strings.Split(*resolvers, ","),
+		strategy:  strategyAll,
+		iface:     *iface,
+		timeout:   *timeout,
+		retries:   *retries,
+		fallback:  splitList(*fallback),
+
+		retryBudget:   defaultRetryBudget,
+		pipelineDepth: defaultPipelineDepth,
+		parallelism:   defaultParallelism,
+		rate:          defaultRate,
+	}
+	if *useProfiles {
+		opts.profiles = profilesUnlessSet(fs)
+	}
+	if err := opts.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	c := newChecker(opts)
+	if c.err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to poll serials: %v\n", c.err)
+		return 1
+	}
+
+	var watched []*watchedZone
+	for _, zone := range zones {
+		zone = dns.Fqdn(zone)
+		auth, err := c.authServers(opts.resolvers[0], zone)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		z := &watchedZone{name: strings.TrimSuffix(zone, "."), converged: map[string]bool{}}
+		for _, s := range auth {
+			z.servers = append(z.servers, serialServer{auth: true, addr: s.Addr, label: s.Host + " (" + s.Addr + ")"})
+		}
+		for _, ns := range opts.resolvers {
+			z.servers = append(z.servers, serialServer{addr: ns, label: ns})
+		}
+		watched = append(watched, z)
+	}
+
+	start := time.Now()
+	deadline := start.Add(*wait)
+	for {
+		// Resolvers are asked afresh by every poll
+		c := newChecker(opts)
+		pending := 0
+		for _, z := range watched {
+			if z.done {
+				continue
+			}
+			c.pollSerials(z, want)
+			for _, s := range z.servers {
+				if z.serves(s.addr) && !z.converged[s.addr] {
+					z.converged[s.addr] = true
+					fmt.Printf("%s: %s serves serial %d after %v\n", z.name, s.label, z.serials[s.addr], time.Since(start).Round(time.Second))
+				}
+			}
+			if len(z.converged) == len(z.servers) {
+				z.done = true
+				fmt.Printf("%s converged on serial %d after %v\n", z.name, z.target, time.Since(start).Round(time.Second))
+				continue
+			}
+			pending++
+		}
+		if pending == 0 {
+			return 0
+		}
+		if time.Now().Add(*interval).After(deadline) {
+			fmt.Printf("\nGave up waiting for %d zones after %v\n", pending, *wait)
+			for _, z := range watched {
+				if !z.done {
+					printLaggards(z)
+				}
+			}
+			return 1
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// pollSerials gets the serial of the zone from all of its servers and
+// updates the target, which with want 0 is the newest serial of the
+// authoritative servers. Servers no longer serving the target are no longer
+// converged, e.g. after another push.
+func (c *checker) pollSerials(z *watchedZone, want uint32) {
+	z.serials, z.errs = map[string]uint32{}, map[string]error{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, s := range z.servers {
+		s := s
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serial, err := c.serialOf(s, z.name)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				z.errs[s.addr] = err
+				return
+			}
+			z.serials[s.addr] = serial
+		}()
+	}
+	wg.Wait()
+
+	z.target, z.noTarget = want, want == 0
+	if want == 0 {
+		for _, s := range z.servers {
+			serial, ok := z.serials[s.addr]
+			if s.auth && ok && (z.noTarget || serialNewer(serial, z.target)) {
+				z.target, z.noTarget = serial, false
+			}
+		}
+	}
+	for addr := range z.converged {
+		if !z.serves(addr) {
+			delete(z.converged, addr)
+		}
+	}
+}
+
+// serves returns whether the server has the target serial or a newer one.
+func (z *watchedZone) serves(addr string) bool {
+	serial, ok := z.serials[addr]
+	return ok && !z.noTarget && !serialNewer(z.target, serial)
+}
+
+func (c *checker) serialOf(s serialServer, zone string) (uint32, error) {
+	var resp *dns.Msg
+	var err error
+	if s.auth {
+		resp, _, err = c.authoritativeQuery(s.addr, zone, "SOA")
+	} else {
+		resp, err = c.query(s.addr, dns.Fqdn(zone), "SOA")
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, codedErrorf(codeCountMismatch, "no SOA record in the answer")
+}
+
+// serialNewer compares serials in serial number arithmetic (RFC 1982), as
+// they wrap around.
+func serialNewer(a uint32, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+func printLaggards(z *watchedZone) {
+	var lines []string
+	for _, s := range z.servers {
+		switch {
+		case z.converged[s.addr]:
+		case z.errs[s.addr] != nil:
+			lines = append(lines, fmt.Sprintf("  %s: %s: %v", s.label, errorCode(z.errs[s.addr]), z.errs[s.addr]))
+		default:
+			lines = append(lines, fmt.Sprintf("  %s: serial %d", s.label, z.serials[s.addr]))
+		}
+	}
+	sort.Strings(lines)
+	fmt.Printf("%s: %d of %d servers serve serial %d\n", z.name, len(z.converged), len(z.servers), z.target)
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// shard selects a deterministic subset of the checks, so that several
+// workers can split a run between themselves.
+type shard struct {
+	// 1-based index of this worker
+	index int
+	count int
+}
+
+var noShard = shard{index: 1, count: 1}
+
+// parseShard parses "i/N".
+func parseShard(s string) (shard, error) {
+	if s == "" {
+		return noShard, nil
+	}
+	i, n, ok := strings.Cut(s, "/")
+	if !ok {
+		return shard{}, fmt.Errorf("shard must be i/N, got %q", s)
+	}
+	index, err1 := strconv.Atoi(i)
+	count, err2 := strconv.Atoi(n)
+	if err1 != nil || err2 != nil || count < 1 || index < 1 || index > count {
+		return shard{}, fmt.Errorf("shard must be i/N with 1 <= i <= N, got %q", s)
+	}
+	return shard{index: index, count: count}, nil
+}
+
+func (s shard) owns(key string) bool {
+	if s.count == 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32()%uint32(s.count)) == s.index-1
+}
+
+// recordSets returns the domains with only the record sets owned by the
+// shard, dropping domains left without any.
+func (s shard) recordSets(domains []domain) []domain {
+	if s.count == 1 {
+		return domains
+	}
+
+	var out []domain
+	for _, dom := range domains {
+		owned := dom
+		owned.Records, owned.NoData, owned.Deleted = nil, nil, nil
+		for _, records := range groupRecords(dom.Records) {
+			if s.owns(verifiedCacheKey(dom.Name, absolutize(dom.Name, records[0].Name), records[0].Type, classLabel(recordClass(records[0].Class)))) {
+				owned.Records = append(owned.Records, records...)
+			}
+		}
+		for _, nd := range dom.NoData {
+			if s.owns(verifiedCacheKey(dom.Name, absolutize(dom.Name, nd.Name), strings.ToUpper(nd.Type), "")) {
+				owned.NoData = append(owned.NoData, nd)
+			}
+		}
+		for _, nd := range dom.Deleted {
+			if s.owns(verifiedCacheKey(dom.Name, absolutize(dom.Name, nd.Name), strings.ToUpper(nd.Type), "")) {
+				owned.Deleted = append(owned.Deleted, nd)
+			}
+		}
+		if owned.hasChecks() {
+			out = append(out, owned)
+		}
+	}
+	return out
+}
+
+// domains returns the domains owned by the shard, for checks done once per
+// domain.
+func (s shard) domains(domains []domain) []domain {
+	if s.count == 1 {
+		return domains
+	}
+
+	var out []domain
+	for _, dom := range domains {
+		if s.owns(dom.Name) {
+			out = append(out, dom)
+		}
+	}
+	return out
+}
+
+// writeResultsJSON writes the results of a run to a file, atomically.
+func writeResultsJSON(path string, res *runResult) error {
+	b, err := json.MarshalIndent(newCheckResponse(res), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+func readResultsJSON(path string) (*runResult, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var resp checkResponse
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	res := &runResult{Started: resp.Started, Finished: resp.Finished}
+	for _, rj := range resp.Results {
+		res.Results = append(res.Results, rj.checkResult())
+	}
+	return res, nil
+}
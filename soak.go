@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// soakEvent is a divergence seen during -soak: a record set failing on a
+// resolver for a while, or its answer changing while it passed.
+type soakEvent struct {
+	key resultKey
+	// When it was first seen, and when the record set passed again, zero
+	// if it still failed at the end
+	from time.Time
+	to   time.Time
+	code string
+	msg  string
+}
+
+// soakLog records the divergences of every record set and resolver between
+// the checks of -soak.
+type soakLog struct {
+	events []*soakEvent
+	// Divergence in progress
+	failing map[resultKey]*soakEvent
+	// Answer of the last passing check
+	answers map[resultKey]string
+	views   resolverViews
+}
+
+func newSoakLog() *soakLog {
+	return &soakLog{failing: map[resultKey]*soakEvent{}, answers: map[resultKey]string{}, views: resolverViews{}}
+}
+
+// observe notes what diverged in the run.
+func (l *soakLog) observe(res *runResult) {
+	for _, r := range res.Results {
+		key := setKey(r)
+		key.NS = r.NS
+		if r.View != "" {
+			l.views[r.NS] = r.View
+		}
+		at := res.Started
+		if r.Timing != nil {
+			at = r.Timing.Started
+		}
+		if r.Err != nil && !r.Outvoted {
+			if _, ok := l.failing[key]; !ok {
+				e := &soakEvent{key: key, from: at, code: errorCode(r.Err), msg: r.Err.Error()}
+				l.failing[key] = e
+				l.events = append(l.events, e)
+			}
+			continue
+		}
+		if e, ok := l.failing[key]; ok {
+			e.to = at
+			delete(l.failing, key)
+		}
+		answer := answerValues(r.Response)
+		if prev, ok := l.answers[key]; ok && prev != answer {
+			l.events = append(l.events, &soakEvent{key: key, from: at, to: at, msg: fmt.Sprintf("answer changed from %s to %s", prev, answer)})
+		}
+		l.answers[key] = answer
+	}
+}
+
+// runSoak checks the domains every interval for the duration, noting the
+// divergences in log, and returns the results of the last check.
+func runSoak(ctx context.Context, domains []domain, opts runOptions, res *runResult, duration time.Duration, interval time.Duration, log *soakLog) (*runResult, error) {
+	deadline := res.Started.Add(duration)
+	log.observe(res)
+	for time.Now().Add(interval).Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		next, err := runChecks(ctx, domains, opts)
+		if err != nil {
+			return nil, err
+		}
+		log.observe(next)
+		next.Started = res.Started
+		res = next
+	}
+	return res, nil
+}
+
+// printSoakReport lists the divergences seen during -soak in the order they
+// started.
+func printSoakReport(w io.Writer, log *soakLog, duration time.Duration) {
+	if len(log.events) == 0 {
+		fmt.Fprintf(w, "\nNo divergence during the %v soak\n", duration)
+		return
+	}
+	events := append([]*soakEvent{}, log.events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].from.Before(events[j].from) })
+
+	fmt.Fprintf(w, "\n%d divergences during the %v soak:\n", len(events), duration)
+	for _, e := range events {
+		var when string
+		switch {
+		case e.to.IsZero():
+			when = fmt.Sprintf("from %s until the end", e.from.Format(time.RFC3339))
+		case e.to.Equal(e.from):
+			when = e.from.Format(time.RFC3339)
+		default:
+			when = fmt.Sprintf("%s to %s (%v)", e.from.Format(time.RFC3339), e.to.Format(time.RFC3339), e.to.Sub(e.from).Round(time.Second))
+		}
+		if e.code != "" {
+			fmt.Fprintf(w, "  %s %s (at %s) %s: %s: %s\n", e.key.Type, e.key.Name, log.views.label(e.key.NS), when, e.code, e.msg)
+		} else {
+			fmt.Fprintf(w, "  %s %s (at %s) %s: %s\n", e.key.Type, e.key.Name, log.views.label(e.key.NS), when, e.msg)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+)
+
+// assignSources sets the source of the results of record checks: those of
+// all records of the set, in the order of the input, once if several are at
+// the same place.
+func assignSources(domains []domain, res *runResult) {
+	sources := map[resultKey][]string{}
+	for _, dom := range domains {
+		for _, rec := range dom.Records {
+			if rec.source == "" {
+				continue
+			}
+			key := inputSetKey(dom, rec.Name, rec.Type, rec.Class)
+			if n := len(sources[key]); n == 0 || sources[key][n-1] != rec.source {
+				sources[key] = append(sources[key], rec.source)
+			}
+		}
+	}
+
+	for i, r := range res.Results {
+		if r.Source != "" {
+			continue
+		}
+		res.Results[i].Source = strings.Join(sources[setKey(r)], ", ")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version of the schema of -sqlite databases, kept in PRAGMA user_version.
+// Bump it with a migration in sqliteMigrations when changing the schema.
+const sqliteSchemaVersion = 1
+
+// sqliteMigrations[i] takes a database from schema version i to i+1.
+var sqliteMigrations = []string{
+	`CREATE TABLE runs (
+	id INTEGER PRIMARY KEY,
+	label TEXT NOT NULL,
+	version TEXT NOT NULL,
+	started TEXT NOT NULL,
+	finished TEXT NOT NULL,
+	passed INTEGER NOT NULL,
+	checks INTEGER NOT NULL,
+	failed INTEGER NOT NULL
+);
+CREATE TABLE results (
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	domain TEXT NOT NULL,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	ns TEXT NOT NULL,
+	transport TEXT,
+	passed INTEGER NOT NULL,
+	outvoted INTEGER NOT NULL,
+	code TEXT,
+	error TEXT,
+	cause TEXT,
+	owner TEXT,
+	source TEXT
+);
+CREATE INDEX results_run ON results(run_id);
+CREATE INDEX results_record ON results(domain, name, type);
+`,
+}
+
+type sqliteOptions struct {
+	// sqlite3 binary
+	sqlite3 string
+	path    string
+	// Tells the runs of different repositories or pipelines apart
+	label string
+}
+
+// writeSQLite appends the run and its results to the database with the
+// sqlite3 shell, creating or migrating the schema first.
+func writeSQLite(ctx context.Context, opts sqliteOptions, res *runResult) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	out, err := runSQLite(ctx, opts, "PRAGMA user_version;")
+	if err != nil {
+		return err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return fmt.Errorf("unexpected schema version %q of %s", strings.TrimSpace(out), opts.path)
+	}
+	if version > sqliteSchemaVersion {
+		return fmt.Errorf("%s has schema version %d, newer than the supported %d", opts.path, version, sqliteSchemaVersion)
+	}
+
+	var script strings.Builder
+	// Immediate, so that concurrent writers don't interleave runs
+	script.WriteString("BEGIN IMMEDIATE;\n")
+	for _, m := range sqliteMigrations[version:] {
+		script.WriteString(m)
+	}
+	fmt.Fprintf(&script, "PRAGMA user_version = %d;\n", sqliteSchemaVersion)
+
+	fmt.Fprintf(&script, "INSERT INTO runs (label, version, started, finished, passed, checks, failed) VALUES (%s, %s, %s, %s, %d, %d, %d);\n",
+		sqlString(opts.label), sqlString(toolVersion()),
+		sqlString(res.Started.UTC().Format(time.RFC3339Nano)), sqlString(res.Finished.UTC().Format(time.RFC3339Nano)),
+		sqlBool(len(res.failures()) == 0), len(res.Results), len(res.failures()))
+	for _, r := range res.Results {
+		var code, msg string
+		if r.Err != nil {
+			code, msg = errorCode(r.Err), r.Err.Error()
+		}
+		// Within the transaction, the run just inserted is the last one
+		fmt.Fprintf(&script, "INSERT INTO results VALUES ((SELECT max(id) FROM runs), %s, %s, %s, %s, %s, %d, %d, %s, %s, %s, %s, %s);\n",
+			sqlString(r.Domain), sqlString(r.Name), sqlString(r.Type), sqlString(r.NS), sqlNullable(r.Transport),
+			sqlBool(r.Err == nil), sqlBool(r.Outvoted), sqlNullable(code), sqlNullable(msg),
+			sqlNullable(r.Cause), sqlNullable(r.Owner), sqlNullable(r.Source))
+	}
+	script.WriteString("COMMIT;\n")
+
+	_, err = runSQLite(ctx, opts, script.String())
+	return err
+}
+
+// runSQLite runs the SQL on the database, returning the output.
+func runSQLite(ctx context.Context, opts sqliteOptions, sql string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, opts.sqlite3, "-bail", opts.path)
+	cmd.Stdin = strings.NewReader(sql)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return "", fmt.Errorf("sqlite3 failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("sqlite3 failed: %w", err)
+	}
+	return stdout.String(), nil
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlNullable returns NULL for empty strings.
+func sqlNullable(s string) string {
+	if s == "" {
+		return "NULL"
+	}
+	return sqlString(s)
+}
+
+func sqlBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultParallelism = 32
+	defaultRate        = 20
+)
+
+const (
+	// Check every record set on every resolver
+	strategyAll = "all"
+	// Check each record set on a single resolver, rotating between them
+	strategyRoundRobin = "round-robin"
+	// Check every record set on every resolver, pass if enough resolvers agree
+	strategyQuorum = "quorum"
+)
+
+type runOptions struct {
+	resolvers []string
+	strategy  string
+	// Number of resolvers that have to pass for strategyQuorum, majority if 0
+	quorum int
+	// Network interface to send queries through, default route if empty
+	iface string
+
+	timeout time.Duration
+	// Additional attempts over UDP on timeout
+	retries int
+	// Share of queries that may be retried or fall back, beyond a few
+	retryBudget float64
+	// Transports to try after UDP attempts time out
+	fallback []string
+	// Per record type replacements for timeout and retries
+	typeOverrides map[string]queryOverride
+	// Queries in flight on a single TCP or TLS connection, a connection per
+	// query if not above 1
+	pipelineDepth int
+
+	// Maximal number of checks in flight
+	parallelism int
+	// Time the checks of a single domain may take, unlimited if 0
+	domainTimeout time.Duration
+	// Maximal queries per second to a single resolver
+	rate float64
+	// Resolvers a record set has to pass on to count as propagated with
+	// -wait, all if 0
+	waitQuorum int
+	// Settings taken from the profiles of well-known resolvers instead
+	profiles profileUse
+	// How answer TTLs are compared with the expected ones
+	ttlMode string
+
+	// Print full responses of failed checks
+	dumpResponses bool
+	// Section the printed reports by groupByDomain or groupByOwner
+	groupBy string
+	// Identify resolver instances via NSID or CHAOS queries
+	nsid bool
+	// Header flags answers of record checks must have, in upper case
+	requireFlags []string
+	// Answers sampled for address sets of several records, no sampling if
+	// not above 1
+	samples int
+	// Answers of record checks over or close to this size are reported, not
+	// checked if 0
+	maxAnswerSize int
+	// Record sets served through the proxy of the DNS provider, by
+	// providerKey
+	proxied map[string]bool
+	// Every exchange is logged here if set
+	qlog *queryLog
+	// Names of the views of resolvers in the config
+	views resolverViews
+	// Told about every record check as it finishes, progress marks are
+	// printed if nil
+	reporter reporter
+}
+
+func (o runOptions) validate() error {
+	if len(o.resolvers) == 0 {
+		return fmt.Errorf("no resolvers specified")
+	}
+	for _, r := range o.resolvers {
+		if _, _, err := resolverAddr(r); err != nil {
+			return err
+		}
+	}
+	switch o.strategy {
+	case strategyAll, strategyRoundRobin:
+	case strategyQuorum:
+		if o.quorum < 0 || o.quorum > len(o.resolvers) {
+			return fmt.Errorf("quorum must be between 1 and the number of resolvers (%d), or 0 for a majority", len(o.resolvers))
+		}
+	default:
+		return fmt.Errorf("unknown resolver strategy %q", o.strategy)
+	}
+	if o.waitQuorum < 0 {
+		return fmt.Errorf("wait quorum must not be negative")
+	}
+	if o.retries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if o.retryBudget < 0 {
+		return fmt.Errorf("retry budget must not be negative")
+	}
+	if o.pipelineDepth < 0 {
+		return fmt.Errorf("pipeline depth must not be negative")
+	}
+	if err := validateTTLMode(o.ttlMode); err != nil {
+		return err
+	}
+	if err := validateGroupBy(o.groupBy); err != nil {
+		return err
+	}
+	if o.domainTimeout < 0 {
+		return fmt.Errorf("domain timeout must not be negative")
+	}
+	if o.parallelism < 1 {
+		return fmt.Errorf("parallelism must be positive")
+	}
+	if o.rate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if o.samples < 0 {
+		return fmt.Errorf("samples must not be negative")
+	}
+	if o.maxAnswerSize < 0 {
+		return fmt.Errorf("max answer size must not be negative")
+	}
+	if err := validateRequiredFlags(o.requireFlags); err != nil {
+		return err
+	}
+	if err := validateFallback(o.fallback); err != nil {
+		return err
+	}
+	if o.iface != "" {
+		if _, err := interfaceDialer(o.iface, "udp"); err != nil {
+			return fmt.Errorf("interface %s: %w", o.iface, err)
+		}
+	}
+	return nil
+}
+
+// withResolvers returns a copy of options using the given resolvers instead,
+// unless the list is empty.
+func (o runOptions) withResolvers(resolvers []string) runOptions {
+	if len(resolvers) != 0 {
+		o.resolvers = resolvers
+	}
+	return o
+}
+
+// withConfig returns a copy of options with the settings from the config
+// file applied.
+func (o runOptions) withConfig(cfg *config) runOptions {
+	o.typeOverrides = cfg.Types
+	o = o.withResolvers(cfg.Resolvers)
+	o.resolvers = expandViews(o.resolvers, cfg.Views)
+	o.views = newResolverViews(cfg.Views)
+	return o
+}
+
+// newLimiter returns a rate limiter for queries to the resolver. Bursts are
+// allowed up to a second worth of queries.
+func (o runOptions) newLimiter(ns string) *rate.Limiter {
+	r := o.rateFor(ns)
+	burst := int(r)
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(r), burst)
+}
+
+// resolverLimiters are the rate limiters of the resolvers, created as they
+// are first queried.
+type resolverLimiters struct {
+	opts runOptions
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newResolverLimiters(opts runOptions) *resolverLimiters {
+	return &resolverLimiters{opts: opts, limiters: map[string]*rate.Limiter{}}
+}
+
+func (l *resolverLimiters) get(ns string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limiters[ns] == nil {
+		l.limiters[ns] = l.opts.newLimiter(ns)
+	}
+	return l.limiters[ns]
+}
+
+func (o runOptions) quorumSize() int {
+	if o.quorum == 0 {
+		return len(o.resolvers)/2 + 1
+	}
+	// Resolvers might have been overridden by a request with a shorter list
+	if o.quorum > len(o.resolvers) {
+		return len(o.resolvers)
+	}
+	return o.quorum
+}
+
+// waitQuorumSize is quorumSize for -wait.
+func (o runOptions) waitQuorumSize() int {
+	if o.waitQuorum == 0 || o.waitQuorum > len(o.resolvers) {
+		return len(o.resolvers)
+	}
+	return o.waitQuorum
+}
+
+// resolversFor returns the resolvers to check the i-th record set of the run on.
+func (o runOptions) resolversFor(i int) []string {
+	if o.strategy == strategyRoundRobin {
+		return []string{o.resolvers[i%len(o.resolvers)]}
+	}
+	return o.resolvers
+}
+
+// applyQuorum marks failures of record sets that passed on enough
+// resolvers, the quorum of their domain, as outvoted.
+func applyQuorum(res *runResult, quorums map[string]int) {
+	passed := map[resultKey]int{}
+	for _, r := range res.Results {
+		if r.Err == nil {
+			passed[setKey(r)]++
+		}
+	}
+	for i := range res.Results {
+		r := &res.Results[i]
+		if r.Err != nil && passed[setKey(*r)] >= quorums[r.Domain] {
+			r.Outvoted = true
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	verdictPass    = "pass"
+	verdictFail    = "fail"
+	verdictPartial = "partial"
+)
+
+// domainStatus is the outcome of the checks of a single domain.
+type domainStatus struct {
+	Domain string `json:"domain"`
+	// pass if no checks failed, fail if all did, partial otherwise
+	Verdict  string `json:"verdict"`
+	Checks   int    `json:"checks"`
+	Passed   int    `json:"passed"`
+	Failed   int    `json:"failed"`
+	Outvoted int    `json:"outvoted,omitempty"`
+}
+
+// domainStatuses returns the outcome of every domain with results, in the
+// order of the results.
+func domainStatuses(res *runResult) []domainStatus {
+	statuses := []domainStatus{}
+	for _, dr := range reportByDomain(nil, res) {
+		ds := domainStatus{
+			Domain:   dr.name,
+			Verdict:  verdictPartial,
+			Checks:   len(dr.results),
+			Passed:   dr.passed,
+			Failed:   dr.failed,
+			Outvoted: dr.outvoted,
+		}
+		switch {
+		case dr.failed == 0:
+			ds.Verdict = verdictPass
+		case dr.passed+dr.outvoted == 0:
+			ds.Verdict = verdictFail
+		}
+		statuses = append(statuses, ds)
+	}
+	return statuses
+}
+
+// exitSummary is written by -summary-json for pipelines handing the outcome
+// of every domain to its owners, and for archiving.
+type exitSummary struct {
+	Passed   bool      `json:"passed"`
+	Version  string    `json:"version"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Duration string    `json:"duration"`
+	// Resolvers checked on
+	Resolvers []string `json:"resolvers"`
+	// Names of the views of the resolvers in one
+	Views    map[string]string `json:"views,omitempty"`
+	Checks   int               `json:"checks"`
+	Failed   int               `json:"failed"`
+	Outvoted int               `json:"outvoted,omitempty"`
+	Domains  []domainStatus    `json:"domains"`
+	// Resolvers that refused or dropped queries in bursts
+	Throttled []throttleEvent `json:"throttled,omitempty"`
+}
+
+// resolversOf returns the resolvers of the results, in the order they first
+// appear, for results without the list of resolvers they were run on.
+func resolversOf(res *runResult) []string {
+	var resolvers []string
+	seen := map[string]bool{}
+	for _, r := range res.Results {
+		if !seen[r.NS] {
+			seen[r.NS] = true
+			resolvers = append(resolvers, r.NS)
+		}
+	}
+	return resolvers
+}
+
+func writeSummaryJSON(path string, res *runResult, resolvers []string) error {
+	if resolvers == nil {
+		resolvers = []string{}
+	}
+	b, err := json.MarshalIndent(exitSummary{
+		Passed:    len(res.failures()) == 0,
+		Version:   toolVersion(),
+		Started:   res.Started,
+		Finished:  res.Finished,
+		Duration:  res.Finished.Sub(res.Started).String(),
+		Resolvers: resolvers,
+		Views:     viewsOf(res),
+		Checks:    len(res.Results),
+		Failed:    len(res.failures()),
+		Outvoted:  len(res.outvoted()),
+		Domains:   domainStatuses(res),
+		Throttled: throttleEvents(res),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
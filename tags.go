@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+)
+
+// DNSControl meta field with comma-separated tags of a record, set on the
+// record or, for all records of the domain, on the domain
+const tagsMeta = "tags"
+
+// tagFilter selects records by their tags: those with any of the included
+// tags, or any record if none are, unless they have one of the excluded ones.
+type tagFilter struct {
+	include []string
+	exclude []string
+}
+
+// parseTagFilter reads tags given as a list, excluded ones prefixed with !.
+func parseTagFilter(tags []string) tagFilter {
+	var f tagFilter
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if excluded, ok := strings.CutPrefix(t, "!"); ok {
+			f.exclude = append(f.exclude, excluded)
+		} else if t != "" {
+			f.include = append(f.include, t)
+		}
+	}
+	return f
+}
+
+func (f tagFilter) empty() bool {
+	return len(f.include) == 0 && len(f.exclude) == 0
+}
+
+func (f tagFilter) matches(tags map[string]bool) bool {
+	for _, t := range f.exclude {
+		if tags[t] {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, t := range f.include {
+		if tags[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTags adds the tags of a meta field to the set.
+func splitTags(tags map[string]bool, meta map[string]string) {
+	for _, t := range strings.Split(meta[tagsMeta], ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags[t] = true
+		}
+	}
+}
+
+// apply returns the domains with only the records selected by the filter,
+// leaving out the domains without any. Empty and deleted record sets have no
+// tags other than those of their domain.
+func (f tagFilter) apply(domains []domain) []domain {
+	if f.empty() {
+		return domains
+	}
+	var out []domain
+	for _, dom := range domains {
+		domainTags := map[string]bool{}
+		splitTags(domainTags, dom.Meta)
+
+		var records []record
+		for _, rec := range dom.Records {
+			tags := map[string]bool{}
+			for t := range domainTags {
+				tags[t] = true
+			}
+			splitTags(tags, rec.Meta)
+			if f.matches(tags) {
+				records = append(records, rec)
+			}
+		}
+		if !f.matches(domainTags) {
+			dom.NoData, dom.Deleted = nil, nil
+		}
+		if len(records) == 0 && len(dom.NoData) == 0 && len(dom.Deleted) == 0 {
+			continue
+		}
+		dom.Records = records
+		out = append(out, dom)
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/miekg/dns"
+)
+
+// Record types pointing at other names that have to resolve. Targets of
+// CNAMEs only have to exist, the others have to have addresses (RFC 2181,
+// section 10.3 and RFC 2782).
+var targetTypes = map[string]bool{
+	"CNAME": true,
+	"MX":    true,
+	"SRV":   true,
+	"NS":    true,
+}
+
+// targetProblem returns why the target is of no use for a record of the
+// type, or nil if it resolves.
+func (c *checker) targetProblem(ns string, target string, typ string) (*dns.Msg, string, error) {
+	var addrs int
+	var last *queryEntry
+	for _, qtype := range []string{"A", "AAAA"} {
+		e := c.lookup(ns, target, qtype)
+		last = e
+		switch {
+		case errorCode(e.err) == codeNXDomain:
+			return e.resp, e.transport, codedErrorf(codeDanglingTarget, "target %s does not exist", target)
+		case e.err != nil:
+			return e.resp, e.transport, e.err
+		}
+		for _, rr := range e.resp.Answer {
+			if t := rr.Header().Rrtype; t == dns.TypeA || t == dns.TypeAAAA {
+				addrs++
+			}
+		}
+	}
+	if addrs == 0 && typ != "CNAME" {
+		return last.resp, last.transport, codedErrorf(codeDanglingTarget, "target %s has no addresses", target)
+	}
+	return last.resp, last.transport, nil
+}
+
+// runTargetChecks resolves the targets of the expected CNAME, MX, SRV and NS
+// records, catching records that match but point clients at names that
+// don't exist. Null MX and SRV records, with "." as the target, are skipped.
+func runTargetChecks(domains []domain, opts runOptions) []checkResult {
+	ns := opts.resolvers[0]
+
+	var jobs []checkJob
+	for _, dom := range domains {
+		for _, records := range groupRecords(dom.Records) {
+			if !targetTypes[records[0].Type] {
+				continue
+			}
+			name := absolutize(dom.Name, records[0].Name)
+			for _, rec := range records {
+				if rec.Target == "" || rec.Target == "." {
+					continue
+				}
+				target, typ := dns.Fqdn(rec.Target), rec.Type
+				jobs = append(jobs, checkJob{
+					ns:     ns,
+					domain: dom.Name,
+					result: checkResult{Domain: dom.Name, Name: name, Type: typ, NS: "target " + target + " at " + ns},
+					run: func(c *checker, r *checkResult) {
+						r.Response, r.Transport, r.Err = c.targetProblem(ns, target, typ)
+					},
+				})
+			}
+		}
+	}
+	return runPass(newChecker(opts), jobs, opts)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Functions available in report and notification templates
+var templateFuncs = template.FuncMap{
+	// json encodes a value, e.g. to embed text in a Slack payload
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// loadTemplate parses a text/template file.
+func loadTemplate(path string) (*template.Template, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New(path).Funcs(templateFuncs).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return t, nil
+}
+
+// printTemplateReport executes the template over the results, in the same
+// shape as the response to POST /check, in place of the default report.
+func printTemplateReport(w io.Writer, t *template.Template, res *runResult) error {
+	// After the progress line
+	fmt.Fprintln(w)
+	return t.Execute(w, newCheckResponse(res))
+}
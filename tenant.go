@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"time"
+)
+
+// defaultTenant monitors the domains not assigned to any tenant.
+const defaultTenant = "default"
+
+// newDaemons splits the domains between the tenants, with the domains not
+// listed in any of them monitored with the command line settings. Without
+// tenants a single daemon monitors all domains.
+func newDaemons(domains []domain, opts runOptions, interval time.Duration, tenants []tenantConfig) ([]*daemon, error) {
+	if len(tenants) == 0 {
+		return []*daemon{newDaemon("", daemonSettings{domains: domains, opts: opts, interval: interval})}, nil
+	}
+
+	byName := map[string]domain{}
+	for _, dom := range domains {
+		byName[dom.Name] = dom
+	}
+	owner := map[string]string{}
+	tagged := map[string]tagFilter{}
+	var daemons []*daemon
+	for _, t := range tenants {
+		d := newDaemon(t.Name, daemonSettings{
+			severity: t.Severity,
+			notify:   t.Notify,
+			opts:     opts.withResolvers(t.Resolvers),
+			interval: time.Duration(t.Interval),
+		})
+		if d.interval == 0 {
+			d.interval = interval
+		}
+		tags := parseTagFilter(t.Tags)
+		for _, name := range t.Domains {
+			dom, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("tenant %s: no domain %s in the input", t.Name, name)
+			}
+			// Tenants selecting by tags check different records of the
+			// same domain, e.g. critical ones more often
+			if other, ok := owner[name]; ok && (tags.empty() || tagged[other].empty()) {
+				return nil, fmt.Errorf("domain %s is in both tenants %s and %s", name, other, t.Name)
+			}
+			owner[name] = t.Name
+			d.domains = append(d.domains, tags.apply([]domain{dom})...)
+		}
+		tagged[t.Name] = tags
+		daemons = append(daemons, d)
+	}
+
+	var rest []domain
+	for _, dom := range domains {
+		if _, ok := owner[dom.Name]; !ok {
+			rest = append(rest, dom)
+		}
+	}
+	if len(rest) > 0 {
+		for _, t := range tenants {
+			if t.Name == defaultTenant {
+				return nil, fmt.Errorf("tenant %s is reserved for domains not in any tenant", defaultTenant)
+			}
+		}
+		daemons = append(daemons, newDaemon(defaultTenant, daemonSettings{severity: severityCritical, domains: rest, opts: opts, interval: interval}))
+	}
+	return daemons, nil
+}
+
+// daemonFor returns the daemon monitoring the zone, or the first one if no
+// daemon does, e.g. for checks of domains given in the request.
+func daemonFor(daemons []*daemon, zone string) *daemon {
+	for _, d := range daemons {
+		for _, dom := range d.settings().domains {
+			if dom.Name == zone {
+				return d
+			}
+		}
+	}
+	return daemons[0]
+}
+
+var tenantsTemplate = template.Must(template.New("tenants").Parse(`<!DOCTYPE html>
+<title>DNS checks</title>
+<ul>
+{{range .}}<li><a href="tenants/{{.Name}}/">{{.Name}}</a> ({{.Severity}}){{with .Status}}: {{.Passed}} passed, {{.Failed}} failed{{end}}</li>
+{{end}}</ul>
+`))
+
+type tenantStatus struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	// Nil until the first run of the tenant has finished
+	Status *status `json:"status"`
+}
+
+// tenantsHandler serves the endpoints of every tenant under
+// /tenants/<name>/, with health, readiness and a status of all tenants at
+// the root. POST /check is only served with checkAPI.
+func tenantsHandler(daemons []*daemon, checkAPI bool) http.Handler {
+	mux := http.NewServeMux()
+	for _, d := range daemons {
+		prefix := "/tenants/" + d.tenant
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, d.handler(checkAPI)))
+	}
+
+	statuses := func() []tenantStatus {
+		var tenants []tenantStatus
+		for _, d := range daemons {
+			ts := tenantStatus{Name: d.tenant, Severity: d.settings().severity}
+			if res := d.lastRun(); res != nil {
+				st := newStatus(res)
+				ts.Status = &st
+			}
+			tenants = append(tenants, ts)
+		}
+		return tenants
+	}
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		for _, d := range daemons {
+			if d.lastRun() == nil {
+				http.Error(w, fmt.Sprintf("first run of %s has not finished yet", d.tenant), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Tenants []tenantStatus `json:"tenants"`
+		}{statuses()})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = tenantsTemplate.Execute(w, statuses())
+	})
+	return mux
+}
+
+// notification is the body POSTed to webhooks when a tenant, or the records
+// of an owner in it, start or stop failing.
+type notification struct {
+	Tenant   string `json:"tenant"`
+	Owner    string `json:"owner,omitempty"`
+	Severity string `json:"severity"`
+	Failing  bool   `json:"failing"`
+	Status   status `json:"status"`
+}
+
+// failing returns whether any check of the run failed, false before the
+// first run.
+func failing(res *runResult) bool {
+	return res != nil && len(res.failures()) > 0
+}
+
+// sendNotifications notifies the targets of the tenant whose records started
+// or stopped failing with the run: all of them, or those of the owner of the
+// target. Failed deliveries are only logged.
+func (d *daemon) sendNotifications(ctx context.Context, s daemonSettings, prev *runResult, res *runResult) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, n := range s.notify {
+		scoped, scopedPrev := res, prev
+		if n.Owner != "" {
+			scoped, scopedPrev = ownedBy(res, n.Owner), ownedBy(prev, n.Owner)
+		}
+		if failing(scoped) == failing(scopedPrev) {
+			continue
+		}
+
+		msg := notification{Tenant: d.tenant, Owner: n.Owner, Severity: s.severity, Failing: failing(scoped), Status: newStatus(scoped)}
+		body, err := json.Marshal(msg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode notification: %v\n", err)
+			continue
+		}
+		if n.tmpl != nil {
+			var b bytes.Buffer
+			if err := n.tmpl.Execute(&b, msg); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to render notification for %s: %v\n", n.Webhook, err)
+				continue
+			}
+			body = b.Bytes()
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Webhook, bytes.NewReader(body))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to notify %s: %v\n", n.Webhook, err)
+			continue
+		}
+		req.Header.Set("Content-Type", n.ContentType)
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to notify %s: %v\n", n.Webhook, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			fmt.Fprintf(os.Stderr, "Failed to notify %s: %s\n", n.Webhook, resp.Status)
+		}
+	}
+}
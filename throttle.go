@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Failures of a resolver that otherwise answers, attributed to rate limits
+const causeThrottled = "resolver throttled"
+
+// Consecutive refused or dropped queries to a resolver that make a burst
+const throttleBurst = 3
+
+// throttleEvent is a resolver refusing or dropping queries in bursts.
+type throttleEvent struct {
+	Resolver string `json:"resolver"`
+	View     string `json:"view,omitempty"`
+	// Checks failed because of it
+	Failures int `json:"failures"`
+}
+
+func refusedOrDropped(err error) bool {
+	switch errorCode(err) {
+	case codeRefused, codeTimeout:
+		return true
+	}
+	return false
+}
+
+// detectThrottling marks bursts of refused or dropped queries on resolvers
+// that answered other queries of the run as throttled. A resolver refusing
+// or dropping everything is down or misconfigured rather than throttled.
+// Results are in the order the checks were started, which is close enough
+// to the order the queries were sent in.
+func detectThrottling(res *runResult) {
+	byNS := map[string][]int{}
+	answered := map[string]bool{}
+	for i, r := range res.Results {
+		byNS[r.NS] = append(byNS[r.NS], i)
+		if r.Err == nil || !refusedOrDropped(r.Err) {
+			answered[r.NS] = true
+		}
+	}
+
+	for ns, indexes := range byNS {
+		if !answered[ns] {
+			continue
+		}
+		for start := 0; start < len(indexes); {
+			end := start
+			for end < len(indexes) && res.Results[indexes[end]].Err != nil && refusedOrDropped(res.Results[indexes[end]].Err) {
+				end++
+			}
+			if end-start >= throttleBurst {
+				for _, i := range indexes[start:end] {
+					res.Results[i].Cause = causeThrottled
+				}
+			}
+			if end == start {
+				end++
+			}
+			start = end
+		}
+	}
+}
+
+// throttleEvents summarizes the throttled results per resolver, in the
+// order of the results.
+func throttleEvents(res *runResult) []throttleEvent {
+	var events []throttleEvent
+	byNS := map[string]int{}
+	for _, r := range res.Results {
+		if r.Cause != causeThrottled {
+			continue
+		}
+		i, ok := byNS[r.NS]
+		if !ok {
+			i = len(events)
+			byNS[r.NS] = i
+			events = append(events, throttleEvent{Resolver: r.NS, View: r.View})
+		}
+		events[i].Failures++
+	}
+	return events
+}
+
+func printThrottling(w io.Writer, res *runResult) {
+	for _, e := range throttleEvents(res) {
+		fmt.Fprintf(w, "\nResolver %s throttled: %d checks failed on refused or dropped queries, consider a lower -rate\n", viewLabel(e.Resolver, e.View), e.Failures)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	transportUDP   = "udp"
+	transportTCP   = "tcp"
+	transportTLS   = "tls"
+	transportHTTPS = "https"
+)
+
+// Names to verify DNS-over-TLS certificates of well-known resolvers against.
+// Other resolvers are expected to have their IP address in the certificate.
+var tlsServerNames = map[string]string{
+	"8.8.8.8":         "dns.google",
+	"8.8.4.4":         "dns.google",
+	"1.1.1.1":         "cloudflare-dns.com",
+	"1.0.0.1":         "cloudflare-dns.com",
+	"9.9.9.9":         "dns.quad9.net",
+	"149.112.112.112": "dns.quad9.net",
+	"94.140.14.14":    "dns.adguard-dns.com",
+}
+
+// DNS-over-HTTPS endpoints of well-known resolvers
+var dohURLs = map[string]string{
+	"8.8.8.8":         "https://dns.google/dns-query",
+	"8.8.4.4":         "https://dns.google/dns-query",
+	"1.1.1.1":         "https://cloudflare-dns.com/dns-query",
+	"1.0.0.1":         "https://cloudflare-dns.com/dns-query",
+	"9.9.9.9":         "https://dns.quad9.net/dns-query",
+	"149.112.112.112": "https://dns.quad9.net/dns-query",
+	"94.140.14.14":    "https://dns.adguard-dns.com/dns-query",
+}
+
+// resolverAddr splits a resolver given as udp://, tcp://, tls:// or https://
+// URL into the transport and the address to use with it. For https the
+// address is the whole URL. Resolvers given as plain host:port have no
+// transport and are queried over UDP with fallback.
+func resolverAddr(resolver string) (string, string, error) {
+	scheme, rest, ok := strings.Cut(resolver, "://")
+	if !ok {
+		return "", resolver, nil
+	}
+
+	switch scheme {
+	case transportUDP, transportTCP, transportTLS:
+		addr := rest
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			port := "53"
+			if scheme == transportTLS {
+				port = "853"
+			}
+			addr = net.JoinHostPort(strings.Trim(rest, "[]"), port)
+		}
+		return scheme, addr, nil
+	case transportHTTPS:
+		if rest == "" {
+			return "", "", fmt.Errorf("no URL in resolver %s", resolver)
+		}
+		return scheme, resolver, nil
+	}
+	return "", "", fmt.Errorf("unknown transport %q in resolver %s, expected udp, tcp, tls or https", scheme, resolver)
+}
+
+func validateFallback(fallback []string) error {
+	for _, t := range fallback {
+		switch t {
+		case transportTCP, transportTLS, transportHTTPS:
+		default:
+			return fmt.Errorf("unknown fallback transport %q, expected tcp, tls or https", t)
+		}
+	}
+	return nil
+}
+
+// transports sends queries over UDP, falling back to other transports if
+// UDP keeps timing out.
+type transports struct {
+	udp   *dns.Client
+	tcp   *dns.Client
+	tls   *dns.Client
+	https *http.Client
+
+	timeout time.Duration
+	// Additional attempts over UDP before falling back
+	retries  int
+	fallback []string
+	// Settings of resolver profiles replacing retries and fallback
+	profiles profileUse
+	// Per record type replacements for timeout and retries
+	overrides map[string]queryOverride
+	// Every exchange is logged here if set
+	qlog *queryLog
+	// Request NSID in record queries
+	nsid bool
+	// Set AD in record queries, asking for it in answers (RFC 6840)
+	authenticatedData bool
+	// Shared by retries of all queries
+	budget *retryBudget
+
+	// Queries in flight on a TCP or TLS connection, one per query if not
+	// above 1
+	pipelineDepth int
+	mu            sync.Mutex
+	// Pipelined connections by transport and address
+	pipelines map[string]*pipeline
+	// Addresses of resolvers given by name
+	hosts *resolverHosts
+}
+
+func newTransports(opts runOptions) (*transports, error) {
+	t := &transports{
+		udp:       &dns.Client{},
+		tcp:       &dns.Client{Net: "tcp"},
+		tls:       &dns.Client{Net: "tcp-tls"},
+		timeout:   opts.timeout,
+		retries:   opts.retries,
+		fallback:  opts.fallback,
+		profiles:  opts.profiles,
+		overrides: opts.typeOverrides,
+		qlog:      opts.qlog,
+		nsid:      opts.nsid,
+
+		authenticatedData: requiresFlag(opts.requireFlags, "AD"),
+		budget:            newRetryBudget(opts.retryBudget),
+
+		pipelineDepth: opts.pipelineDepth,
+		pipelines:     map[string]*pipeline{},
+		hosts:         newResolverHosts(),
+	}
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	t.https = &http.Client{Transport: httpTransport}
+
+	if opts.iface != "" {
+		udpDialer, err := interfaceDialer(opts.iface, "udp")
+		if err != nil {
+			return nil, err
+		}
+		tcpDialer, err := interfaceDialer(opts.iface, "tcp")
+		if err != nil {
+			return nil, err
+		}
+		t.udp.Dialer = udpDialer
+		t.tcp.Dialer = tcpDialer
+		t.tls.Dialer = tcpDialer
+		httpTransport.DialContext = tcpDialer.DialContext
+	}
+	return t, nil
+}
+
+// settingsFor returns the timeout and the number of retries for queries of
+// the type to the resolver.
+func (t *transports) settingsFor(ns string, queryType uint16) (time.Duration, int) {
+	timeout, retries := t.timeout, t.profiles.retriesFor(ns, t.retries)
+	if o, ok := t.overrides[dns.TypeToString[queryType]]; ok {
+		if o.Timeout != nil {
+			timeout = time.Duration(*o.Timeout)
+		}
+		if o.Retries != nil {
+			retries = *o.Retries
+		}
+	}
+	if timeout == 0 {
+		// Same as the default timeouts of dns.Client
+		timeout = 2 * time.Second
+	}
+	return timeout, retries
+}
+
+func withTimeout(client *dns.Client, timeout time.Duration) *dns.Client {
+	c := *client
+	c.Timeout = timeout
+	return &c
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// tlsClient returns the client verifying the certificate of the resolver,
+// given as host:port.
+func (t *transports) tlsClient(server string) (*dns.Client, error) {
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+	serverName, ok := tlsServerNames[host]
+	if !ok {
+		serverName = host
+	}
+
+	client := *t.tls
+	client.TLSConfig = &tls.Config{ServerName: serverName}
+	return &client, nil
+}
+
+func (t *transports) exchangeTLS(m *dns.Msg, server string, addr string, timeout time.Duration) (*dns.Msg, error) {
+	client, err := t.tlsClient(server)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := withTimeout(client, timeout).Exchange(m, addr)
+	return resp, err
+}
+
+// pipelineTo returns the pipelined connection to the address of the resolver
+// over TCP or TLS, creating it on first use.
+func (t *transports) pipelineTo(transport string, server string, addr string) (*pipeline, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := transport + " " + addr
+	if p, ok := t.pipelines[key]; ok {
+		return p, nil
+	}
+	client := t.tcp
+	if transport == transportTLS {
+		var err error
+		if client, err = t.tlsClient(server); err != nil {
+			return nil, err
+		}
+	}
+	p := newPipeline(client, addr, t.pipelineDepth)
+	t.pipelines[key] = p
+	return p, nil
+}
+
+// exchangePipelined sends the query over the pipelined connection to the
+// address of the resolver.
+func (t *transports) exchangePipelined(transport string, m *dns.Msg, server string, addr string, timeout time.Duration) (*dns.Msg, error) {
+	p, err := t.pipelineTo(transport, server, addr)
+	if err != nil {
+		return nil, err
+	}
+	return p.exchange(m, timeout)
+}
+
+func (t *transports) exchangeHTTPS(m *dns.Msg, url string, timeout time.Duration) (*dns.Msg, error) {
+	// RFC 8484 recommends ID 0 for cache friendliness
+	q := m.Copy()
+	q.Id = 0
+	wire, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(wire))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := t.https.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	r := &dns.Msg{}
+	if err := r.Unpack(body); err != nil {
+		return nil, fmt.Errorf("failed to parse response from %s: %w", url, err)
+	}
+	r.Id = m.Id
+	return r, nil
+}
+
+// fallbackAddr returns the address of the resolver given as host:port to use
+// with a fallback transport, or false if it does not support it.
+func fallbackAddr(transport string, ns string) (string, bool) {
+	host, _, err := net.SplitHostPort(ns)
+	if err != nil {
+		return "", false
+	}
+	switch transport {
+	case transportTLS:
+		return net.JoinHostPort(host, "853"), true
+	case transportHTTPS:
+		url, ok := dohURLs[host]
+		return url, ok
+	}
+	return ns, true
+}
+
+// exchangeOver sends the query over the given transport to the address, which
+// is host:port, or the URL for https. Hosts given by name are resolved and
+// queried at all their addresses in turn.
+func (t *transports) exchangeOver(transport string, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, error) {
+	if transport == transportHTTPS {
+		return t.exchangeAddr(transport, m, addr, addr, timeout)
+	}
+	return t.exchangeRacing(transport, m, addr, timeout)
+}
+
+// exchangeAddr sends the query to a single address of the resolver, given as
+// host:port to verify its certificate over TLS.
+func (t *transports) exchangeAddr(transport string, m *dns.Msg, server string, addr string, timeout time.Duration) (*dns.Msg, error) {
+	start := time.Now()
+
+	var resp *dns.Msg
+	var err error
+	switch {
+	case (transport == transportTCP || transport == transportTLS) && t.pipelineDepth > 1:
+		resp, err = t.exchangePipelined(transport, m, server, addr, timeout)
+	case transport == transportUDP:
+		resp, _, err = withTimeout(t.udp, timeout).Exchange(m, addr)
+	case transport == transportTCP:
+		resp, _, err = withTimeout(t.tcp, timeout).Exchange(m, addr)
+	case transport == transportTLS:
+		resp, err = t.exchangeTLS(m, server, addr, timeout)
+	case transport == transportHTTPS:
+		resp, err = t.exchangeHTTPS(m, addr, timeout)
+	default:
+		return nil, fmt.Errorf("unknown transport %q", transport)
+	}
+
+	if t.qlog != nil {
+		t.qlog.log(start, addr, transport, m, resp, err)
+	}
+	return resp, err
+}
+
+// exchange sends the query to the resolver, returning the response and the
+// transport it was received over.
+func (t *transports) exchange(m *dns.Msg, ns string) (*dns.Msg, string, error) {
+	resp, info, err := t.exchangeReport(m, ns)
+	return resp, info.transport, err
+}
+
+// exchangeInfo describes how a query was answered.
+type exchangeInfo struct {
+	// Transport the response was received over, or the last one tried
+	transport string
+	// The answer over UDP was truncated and retried over TCP
+	truncated bool
+	// Queries sent, more than one if retried or fallen back
+	attempts int
+}
+
+// exchangeReport is exchange that also reports whether the answer over UDP
+// was truncated and had to be retried over TCP, and how many queries it
+// took.
+func (t *transports) exchangeReport(m *dns.Msg, ns string) (*dns.Msg, exchangeInfo, error) {
+	timeout, retries := t.settingsFor(ns, m.Question[0].Qtype)
+
+	var info exchangeInfo
+	transport, addr, err := resolverAddr(ns)
+	if err != nil {
+		return nil, info, err
+	}
+	if transport != "" {
+		// Transport given explicitly, no fallback
+		if transport != transportUDP {
+			retries = 0
+		}
+		info.transport = transport
+		var resp *dns.Msg
+		for attempt := 0; attempt <= retries && t.retry(attempt); attempt++ {
+			info.attempts++
+			resp, err = t.exchangeOver(transport, m, addr, timeout)
+			if !isTimeout(err) {
+				break
+			}
+		}
+		if err == nil && resp.Truncated && transport == transportUDP {
+			info.transport, info.truncated = transportTCP, true
+			info.attempts++
+			resp, err = t.retryTruncated(m, addr, timeout)
+		}
+		return resp, info, err
+	}
+
+	var resp *dns.Msg
+	info.transport = transportUDP
+	for attempt := 0; attempt <= retries && t.retry(attempt); attempt++ {
+		info.attempts++
+		resp, err = t.exchangeOver(transportUDP, m, ns, timeout)
+		if err == nil && resp.Truncated {
+			info.transport, info.truncated = transportTCP, true
+			info.attempts++
+			resp, err = t.retryTruncated(m, ns, timeout)
+			return resp, info, err
+		}
+		if !isTimeout(err) {
+			return resp, info, err
+		}
+	}
+
+	tried := []string{transportUDP}
+	for _, transport := range t.profiles.fallbackFor(ns, t.fallback) {
+		addr, ok := fallbackAddr(transport, ns)
+		if !ok {
+			// No known DNS-over-HTTPS endpoint for this resolver
+			continue
+		}
+		if !t.budget.allow() {
+			break
+		}
+		info.attempts++
+		resp, err = t.exchangeOver(transport, m, addr, timeout)
+		tried = append(tried, transport)
+		if err == nil {
+			info.transport = transport
+			return resp, info, nil
+		}
+	}
+	info.transport = tried[len(tried)-1]
+	return nil, info, fmt.Errorf("%w (tried %s)", err, strings.Join(tried, ", "))
+}
+
+// retryTruncated repeats the query over TCP after a truncated UDP answer,
+// regardless of the fallback transports.
+func (t *transports) retryTruncated(m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, error) {
+	resp, err := t.exchangeOver(transportTCP, m, addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("answer over UDP was truncated, retry over TCP failed: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// Any TTL up to the expected one, as cached answers count down
+	ttlModeMax = "max"
+	// Exactly the expected TTL, for checking authoritative servers directly
+	ttlModeExact = "exact"
+	// Up to the expected TTL, and exactly it on the authoritative servers
+	ttlModeAuthoritative = "authoritative"
+)
+
+func validateTTLMode(mode string) error {
+	switch mode {
+	case "", ttlModeMax, ttlModeExact, ttlModeAuthoritative:
+		return nil
+	}
+	return fmt.Errorf("unknown TTL mode %q, expected max, exact or authoritative", mode)
+}
+
+// checkExactTTL checks that all answers have exactly the expected TTL.
+func checkExactTTL(resp *dns.Msg, records []record) error {
+	for _, answer := range resp.Answer {
+		if answer.Header().Ttl != uint32(records[0].TTL) {
+			return codedErrorf(codeTTLMismatch, "expected ttl exactly %d, got %d", records[0].TTL, answer.Header().Ttl)
+		}
+	}
+	return nil
+}
+
+// authoritativeQuery sends a non-recursive query to an authoritative server.
+func (c *checker) authoritativeQuery(addr string, name string, queryType string) (*dns.Msg, string, error) {
+	if c.err != nil {
+		return nil, "", c.err
+	}
+
+	m := &dns.Msg{}
+	m.SetQuestion(dns.Fqdn(name), dns.StringToType[queryType])
+	m.RecursionDesired = false
+
+	resp, transport, err := c.transports.exchange(m, addr)
+	if err != nil {
+		return nil, transport, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return resp, transport, rcodeError(resp.Rcode)
+	}
+	if !resp.Authoritative {
+		return resp, transport, codedErrorf(codeNotAuthoritative, "server is not authoritative for %s", name)
+	}
+	if len(resp.Answer) == 0 {
+		return resp, transport, codedErrorf(codeCountMismatch, "no answer from authoritative server")
+	}
+	return resp, transport, nil
+}
+
+// runAuthoritativeTTLChecks queries every record set on the authoritative
+// servers of its domain and checks that they serve the expected TTL, which
+// resolvers only show counted down.
+func runAuthoritativeTTLChecks(domains []domain, opts runOptions) []checkResult {
+	c := newChecker(opts)
+
+	var zones []string
+	for _, dom := range domains {
+		if len(dom.Records) > 0 && dom.hasINET() {
+			zones = append(zones, dom.Name)
+		}
+	}
+	servers, results := zoneAuthServers(c, opts.resolvers[0], zones, opts)
+
+	var jobs []checkJob
+	for _, dom := range domains {
+		for _, records := range groupRecords(dom.Records) {
+			if isRedirect(records[0].Type) || recordClass(records[0].Class) != dns.ClassINET {
+				continue
+			}
+			records := records
+			name, typ := absolutize(dom.Name, records[0].Name), records[0].Type
+			for _, server := range servers[dom.Name] {
+				server := server
+				jobs = append(jobs, checkJob{
+					ns:     server.Addr,
+					domain: dom.Name,
+					result: checkResult{
+						Domain: dom.Name,
+						Name:   name,
+						Type:   typ,
+						NS:     fmt.Sprintf("authoritative %s (%s)", server.Host, server.Addr),
+					},
+					run: func(c *checker, r *checkResult) {
+						r.Response, r.Transport, r.Err = c.authoritativeQuery(server.Addr, name, typ)
+						if r.Err == nil {
+							if err := checkExactTTL(r.Response, records); err != nil {
+								r.Err = withCode(codeAuthTTLMismatch, err)
+							}
+						}
+					},
+				})
+			}
+		}
+	}
+	return append(results, runPass(c, jobs, opts)...)
+}
+
+// checkTTLPolicy checks the expected TTL of the record set against the
+// bounds for its type.
+func checkTTLPolicy(records []record, b ttlBounds) error {
+	ttl := time.Duration(records[0].TTL) * time.Second
+	if b.Min != 0 && ttl < time.Duration(b.Min) {
+		return codedErrorf(codeTTLPolicy, "TTL %v is below the minimum of %v for %s", ttl, time.Duration(b.Min), records[0].Type)
+	}
+	if b.Max != 0 && ttl > time.Duration(b.Max) {
+		return codedErrorf(codeTTLPolicy, "TTL %v is above the maximum of %v for %s", ttl, time.Duration(b.Max), records[0].Type)
+	}
+	return nil
+}
+
+// runTTLPolicyChecks checks the expected TTLs of record sets against
+// policy.ttl, without querying anything.
+func runTTLPolicyChecks(domains []domain, bounds map[string]ttlBounds) []checkResult {
+	var results []checkResult
+	for _, dom := range domains {
+		for _, records := range groupRecords(dom.Records) {
+			b, ok := bounds[records[0].Type]
+			if !ok {
+				continue
+			}
+			cr := checkResult{
+				Domain: dom.Name,
+				Name:   absolutize(dom.Name, records[0].Name),
+				Type:   records[0].Type,
+				NS:     "policy",
+				Err:    checkTTLPolicy(records, b),
+			}
+			printProgress(cr.Err)
+			results = append(results, cr)
+		}
+	}
+	return results
+}
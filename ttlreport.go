@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/miekg/dns"
+)
+
+// ttlStats summarizes the TTLs of the answers of one type from one resolver.
+type ttlStats struct {
+	Type string
+	NS   string
+	View string
+	TTLs []uint32
+}
+
+func (s ttlStats) min() uint32    { return s.TTLs[0] }
+func (s ttlStats) max() uint32    { return s.TTLs[len(s.TTLs)-1] }
+func (s ttlStats) median() uint32 { return s.TTLs[len(s.TTLs)/2] }
+
+// ttlDistribution collects the TTLs observed in the answers of the
+// resolvers, per record type and resolver, sorted by both.
+func ttlDistribution(res *runResult, resolvers []string) []ttlStats {
+	isResolver := map[string]bool{}
+	for _, ns := range resolvers {
+		isResolver[ns] = true
+	}
+
+	byKey := map[[2]string]*ttlStats{}
+	for _, r := range res.Results {
+		// Supplementary checks answer from elsewhere, e.g. a provider API
+		if r.Response == nil || !isResolver[r.NS] {
+			continue
+		}
+		for _, rr := range r.Response.Answer {
+			typ := dns.TypeToString[rr.Header().Rrtype]
+			key := [2]string{typ, r.NS}
+			s := byKey[key]
+			if s == nil {
+				s = &ttlStats{Type: typ, NS: r.NS, View: r.View}
+				byKey[key] = s
+			}
+			s.TTLs = append(s.TTLs, rr.Header().Ttl)
+		}
+	}
+
+	var stats []ttlStats
+	for _, s := range byKey {
+		sort.Slice(s.TTLs, func(i, j int) bool { return s.TTLs[i] < s.TTLs[j] })
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Type != stats[j].Type {
+			return stats[i].Type < stats[j].Type
+		}
+		return stats[i].NS < stats[j].NS
+	})
+	return stats
+}
+
+// printTTLDistribution prints the minimal, median and maximal TTL per record
+// type and resolver. A resolver whose maximum is well below the others' is
+// likely clamping TTLs.
+func printTTLDistribution(w io.Writer, res *runResult, resolvers []string) {
+	stats := ttlDistribution(res, resolvers)
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nTTLs observed (min/median/max):\n")
+	for _, s := range stats {
+		fmt.Fprintf(w, "  %-6s %-24s %d/%d/%d (%d records)\n", s.Type, viewLabel(s.NS, s.View), s.min(), s.median(), s.max(), len(s.TTLs))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// unmanagedPattern is a DNSControl IGNORE(): records matching it are
+// managed elsewhere, e.g. by hand or by another tool, so answers may have
+// them besides the expected records.
+type unmanagedPattern struct {
+	// Globs, * within a label and ** across labels, any if empty
+	Label  string `json:"label_pattern"`
+	Target string `json:"target_pattern"`
+	// Comma-separated types, * for any
+	Types string `json:"rType_pattern"`
+
+	// Label and Target compiled by compile, nil if empty
+	label  *regexp.Regexp
+	target *regexp.Regexp
+}
+
+// Every record is in a domain with NO_PURGE
+var keepUnknownPattern = unmanagedPattern{Label: "**"}.compile()
+
+// compile returns the pattern with its globs compiled, once as the domain is
+// read rather than for every record matched.
+func (p unmanagedPattern) compile() unmanagedPattern {
+	if p.Label != "" {
+		p.label = globRegexp(p.Label, true)
+	}
+	if p.Target != "" {
+		p.target = globRegexp(p.Target, false)
+	}
+	return p
+}
+
+func (p unmanagedPattern) matchesSet(name string, typ string) bool {
+	if p.label != nil && !p.label.MatchString(name) {
+		return false
+	}
+	if p.Types == "" || p.Types == "*" {
+		return true
+	}
+	for _, t := range strings.Split(p.Types, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp compiles a DNSControl glob. In labels * doesn't match dots and
+// ** does.
+func globRegexp(pattern string, labels bool) *regexp.Regexp {
+	var re strings.Builder
+	re.WriteString("^(?i)")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			if labels {
+				re.WriteString("[^.]*")
+			} else {
+				re.WriteString(".*")
+			}
+		case pattern[i] == '?':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+// compileUnmanaged compiles the unmanaged patterns of the domain, see
+// unmanagedPattern.compile.
+func (d *domain) compileUnmanaged() {
+	if len(d.Unmanaged) == 0 {
+		return
+	}
+	patterns := make([]unmanagedPattern, len(d.Unmanaged))
+	for i, p := range d.Unmanaged {
+		patterns[i] = p.compile()
+	}
+	d.Unmanaged = patterns
+}
+
+// unmanagedFor returns the patterns of the domain matching the record set
+// with the relative name.
+func (d domain) unmanagedFor(name string, typ string) []unmanagedPattern {
+	var out []unmanagedPattern
+	if d.KeepUnknown {
+		out = append(out, keepUnknownPattern)
+	}
+	for _, p := range d.Unmanaged {
+		if p.matchesSet(name, typ) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// withoutUnmanaged returns the answer without the records of the type that
+// aren't expected and that the patterns leave to be managed elsewhere.
+func withoutUnmanaged(resp *dns.Msg, typ string, patterns []unmanagedPattern, records []record) *dns.Msg {
+	if len(patterns) == 0 {
+		return resp
+	}
+	expected := map[string]bool{}
+	for _, r := range records {
+		expected[strings.ToLower(recordValue(r))] = true
+	}
+
+	out := resp.Copy()
+	out.Answer = nil
+	for _, rr := range resp.Answer {
+		v := rrValue(rr)
+		if dns.TypeToString[rr.Header().Rrtype] == typ && !expected[strings.ToLower(v)] && unmanagedValue(patterns, v) {
+			continue
+		}
+		out.Answer = append(out.Answer, rr)
+	}
+	return out
+}
+
+func unmanagedValue(patterns []unmanagedPattern, value string) bool {
+	for _, p := range patterns {
+		if p.target == nil || p.target.MatchString(value) || p.target.MatchString(strings.TrimSuffix(value, ".")) {
+			return true
+		}
+	}
+	return false
+}
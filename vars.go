@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ${NAME} in the input, or $${NAME} for a literal ${NAME}
+var inputVarPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// inputVars are substituted for ${NAME} in the input, so that the same
+// expected records can be checked in several environments.
+type inputVars struct {
+	// From the values file, the environment is used for the rest
+	values map[string]string
+}
+
+// loadInputVars reads the values file, a YAML or JSON mapping of names to
+// values, if the path is not empty.
+func loadInputVars(path string) (*inputVars, error) {
+	v := &inputVars{values: map[string]string{}}
+	if path == "" {
+		return v, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, &v.values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return v, nil
+}
+
+func (v *inputVars) lookup(name string) (string, bool) {
+	if value, ok := v.values[name]; ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+// expandingReader substitutes the variables in what is read through it a
+// line at a time, noting the undefined ones with their lines.
+type expandingReader struct {
+	r    *bufio.Reader
+	vars *inputVars
+	// Values are escaped as JSON strings in DNSControl output
+	json bool
+
+	line      int
+	buf       []byte
+	err       error
+	undefined inputErrors
+}
+
+func (v *inputVars) reader(r io.Reader, format string) *expandingReader {
+	return &expandingReader{r: bufio.NewReader(r), vars: v, json: format == inputDNSControl}
+}
+
+func (e *expandingReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		var s string
+		s, e.err = e.r.ReadString('\n')
+		if s != "" {
+			e.line++
+			e.buf = []byte(inputVarPattern.ReplaceAllStringFunc(s, e.expand))
+		}
+	}
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+	return n, nil
+}
+
+func (e *expandingReader) expand(match string) string {
+	if match[1] == '$' {
+		return match[1:]
+	}
+	name := match[2 : len(match)-1]
+	value, ok := e.vars.lookup(name)
+	if !ok {
+		e.undefined = append(e.undefined, inputError{line: e.line, msg: fmt.Sprintf("undefined variable ${%s}", name)})
+		return match
+	}
+	if e.json {
+		b, _ := json.Marshal(value)
+		return string(b[1 : len(b)-1])
+	}
+	return value
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Meta fields of DNSControl domains overriding how they are verified, so
+// that the policy lives next to the zone:
+//
+//	D("example.com", REG, DnsProvider(DNS), {verify_resolvers: "10.0.0.53:53", verify_severity: "warning"}, ...)
+const (
+	// Comma-separated resolvers to check the domain on instead of -ns
+	verifyResolversMeta = "verify_resolvers"
+	// -ttl-mode of the domain
+	verifyTTLModeMeta = "verify_ttl_mode"
+	// critical, the default, or warning for domains whose failures are
+	// reported without failing the run
+	verifySeverityMeta = "verify_severity"
+	// -wait-quorum of the domain
+	verifyWaitQuorumMeta = "verify_wait_quorum"
+)
+
+func validateVerifyMeta(domains []domain) error {
+	for _, dom := range domains {
+		for _, r := range splitList(dom.Meta[verifyResolversMeta]) {
+			if _, _, err := resolverAddr(r); err != nil {
+				return fmt.Errorf("%s of %s: %w", verifyResolversMeta, dom.Name, err)
+			}
+		}
+		if err := validateTTLMode(dom.Meta[verifyTTLModeMeta]); err != nil {
+			return fmt.Errorf("%s of %s: %w", verifyTTLModeMeta, dom.Name, err)
+		}
+		if q, ok := dom.Meta[verifyWaitQuorumMeta]; ok {
+			if n, err := strconv.Atoi(q); err != nil || n < 0 {
+				return fmt.Errorf("%s of %s: %q is not a number of resolvers", verifyWaitQuorumMeta, dom.Name, q)
+			}
+		}
+		switch s := dom.Meta[verifySeverityMeta]; s {
+		case "", severityCritical, severityWarning:
+		default:
+			return fmt.Errorf("%s of %s: unknown severity %q, expected critical or warning", verifySeverityMeta, dom.Name, s)
+		}
+	}
+	return nil
+}
+
+// forDomain returns a copy of options with the settings from the meta
+// fields of the domain applied.
+func (o runOptions) forDomain(dom domain) runOptions {
+	o = o.withResolvers(splitList(dom.Meta[verifyResolversMeta]))
+	if mode := dom.Meta[verifyTTLModeMeta]; mode != "" {
+		o.ttlMode = mode
+	}
+	if q, err := strconv.Atoi(dom.Meta[verifyWaitQuorumMeta]); err == nil {
+		o.waitQuorum = q
+	}
+	return o
+}
+
+// warningDomains returns the domains whose failures don't fail the run.
+func warningDomains(domains []domain) map[string]bool {
+	warning := map[string]bool{}
+	for _, dom := range domains {
+		if dom.Meta[verifySeverityMeta] == severityWarning {
+			warning[dom.Name] = true
+		}
+	}
+	return warning
+}
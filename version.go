@@ -0,0 +1,18 @@
+package main
+
+import "runtime/debug"
+
+// Set with -ldflags "-X main.version=..." in release builds
+var version string
+
+// toolVersion returns the version of the binary: the one set at link time,
+// or the module version if installed with go install.
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
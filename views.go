@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// resolverViews names the resolvers of the groups in the views of the
+// config, e.g. "internal" or "office-vpn", given by the resolvers.
+type resolverViews map[string]string
+
+// validateViews checks that the views of the config have resolvers, each in
+// a single view.
+func validateViews(views map[string][]string) error {
+	seen := map[string]string{}
+	names := make([]string, 0, len(views))
+	for name := range views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(views[name]) == 0 {
+			return fmt.Errorf("view %s has no resolvers", name)
+		}
+		for _, r := range views[name] {
+			if _, _, err := resolverAddr(r); err != nil {
+				return fmt.Errorf("view %s: %w", name, err)
+			}
+			if other, ok := seen[r]; ok {
+				return fmt.Errorf("resolver %s is in both views %s and %s", r, other, name)
+			}
+			seen[r] = name
+		}
+	}
+	return nil
+}
+
+func newResolverViews(views map[string][]string) resolverViews {
+	v := resolverViews{}
+	for name, resolvers := range views {
+		for _, r := range resolvers {
+			v[r] = name
+		}
+	}
+	return v
+}
+
+// expandViews replaces the names of views among the resolvers with the
+// resolvers of the views.
+func expandViews(resolvers []string, views map[string][]string) []string {
+	var out []string
+	for _, r := range resolvers {
+		if members, ok := views[r]; ok {
+			out = append(out, members...)
+		} else {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// label returns the resolver as shown in reports, with the name of its view
+// if it has one.
+func (v resolverViews) label(ns string) string {
+	return viewLabel(ns, v[ns])
+}
+
+func viewLabel(ns string, view string) string {
+	if view == "" {
+		return ns
+	}
+	return view + " (" + ns + ")"
+}
+
+// assignViews sets the view of the results checked on resolvers in one.
+func assignViews(res *runResult, views resolverViews) {
+	for i := range res.Results {
+		if name, ok := views[res.Results[i].NS]; ok {
+			res.Results[i].View = name
+		}
+	}
+}
+
+// viewsOf returns the views of the resolvers of the results in one.
+func viewsOf(res *runResult) resolverViews {
+	views := resolverViews{}
+	for _, r := range res.Results {
+		if r.View != "" {
+			views[r.NS] = r.View
+		}
+	}
+	return views
+}
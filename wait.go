@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// failedRecordSets returns the record sets of the domains that failed on at
+// least one resolver, and their number.
+func failedRecordSets(domains []domain, res *runResult) ([]domain, int) {
+	failed := map[resultKey]bool{}
+	for _, r := range res.failures() {
+		failed[setKey(r)] = true
+	}
+	return recordSetsOf(domains, failed)
+}
+
+// recordSetsOf returns the given record sets of the domains, keyed by
+// setKey, and their number.
+func recordSetsOf(domains []domain, keys map[resultKey]bool) ([]domain, int) {
+	selected := func(dom domain, name string, typ string, class string) bool {
+		return keys[inputSetKey(dom, name, typ, class)]
+	}
+
+	var out []domain
+	var n int
+	for _, dom := range domains {
+		d := dom
+		d.Records, d.NoData, d.Deleted = nil, nil, nil
+		for _, records := range groupRecords(dom.Records) {
+			if selected(dom, records[0].Name, records[0].Type, records[0].Class) {
+				d.Records = append(d.Records, records...)
+				n++
+			}
+		}
+		for _, nd := range dom.NoData {
+			if selected(dom, nd.Name, nd.Type, "") {
+				d.NoData = append(d.NoData, nd)
+				n++
+			}
+		}
+		for _, nd := range dom.Deleted {
+			if selected(dom, nd.Name, nd.Type, "") {
+				d.Deleted = append(d.Deleted, nd)
+				n++
+			}
+		}
+		if d.hasChecks() {
+			out = append(out, d)
+		}
+	}
+	return out, n
+}
+
+// waitForPropagation re-checks the failed record sets every interval until
+// they pass or the timeout expires, and returns the results with the ones of
+// the record sets re-checked replaced by the last ones. Every re-check is
+// observed by conv.
+func waitForPropagation(ctx context.Context, domains []domain, opts runOptions, res *runResult, timeout time.Duration, interval time.Duration, conv *convergence) (*runResult, error) {
+	// Failures of record sets passing on the quorum of their domain are
+	// outvoted, so they are no longer waited for
+	quorums := map[string]int{}
+	for _, dom := range domains {
+		quorums[dom.Name] = opts.forDomain(dom).waitQuorumSize()
+	}
+	applyQuorum(res, quorums)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		pending, n := failedRecordSets(domains, res)
+		if n == 0 {
+			return res, nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			fmt.Printf("\nGave up waiting for %d record sets after %v\n", n, timeout)
+			return res, nil
+		}
+		fmt.Printf("\nWaiting for %d record sets to propagate, re-checking in %v\n", n, interval)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		rechecked, err := runChecks(ctx, pending, opts)
+		if err != nil {
+			return nil, err
+		}
+		conv.observe(rechecked)
+		res = replaceResults(res, rechecked)
+		applyQuorum(res, quorums)
+	}
+}
+
+// printStragglers lists the resolvers that did not serve record sets which
+// propagated to enough other ones, as warnings.
+func printStragglers(w io.Writer, res *runResult) {
+	stragglers := res.outvoted()
+	if len(stragglers) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%d stragglers still fail on record sets that passed on the wait quorum:\n", len(stragglers))
+	for _, r := range stragglers {
+		fmt.Fprintf(w, "  %s %s (at %s): %s: %v\n", typeLabel(r), r.Name, viewLabel(r.NS, r.View), errorCode(r.Err), r.Err)
+	}
+}
+
+// replaceResults returns the results with the ones of the record sets
+// re-checked replaced.
+func replaceResults(res *runResult, rechecked *runResult) *runResult {
+	replaced := map[resultKey]bool{}
+	for _, r := range rechecked.Results {
+		replaced[setKey(r)] = true
+	}
+
+	out := &runResult{Started: res.Started, Finished: rechecked.Finished}
+	for _, r := range res.Results {
+		if !replaced[setKey(r)] {
+			out.Results = append(out.Results, r)
+		}
+	}
+	out.Results = append(out.Results, rechecked.Results...)
+	return out
+}
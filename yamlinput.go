@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the expected records
+const (
+	inputDNSControl = "dnscontrol"
+	inputYAML       = "yaml"
+)
+
+func validateInputFormat(format string) error {
+	switch format {
+	case inputDNSControl, inputYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown input format %q, expected dnscontrol or yaml", format)
+}
+
+// decodeInput reads the expected records in the format, substituting the
+// variables in it unless vars is nil.
+func decodeInput(r io.Reader, format string, strict bool, vars *inputVars) ([]domain, error) {
+	var domains []domain
+	err := decodeInputFunc(r, format, strict, vars, func(d domain) error {
+		domains = append(domains, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// decodeInputFunc is decodeInput passing every domain to fn as soon as it is
+// read, see decodeDNSControlFunc. YAML is read as a whole first.
+func decodeInputFunc(r io.Reader, format string, strict bool, vars *inputVars, fn func(domain) error) error {
+	if vars != nil {
+		er := vars.reader(r, format)
+		err := decodeInputFunc(er, format, strict, nil, fn)
+		if len(er.undefined) > 0 {
+			return er.undefined
+		}
+		return err
+	}
+	if format != inputYAML {
+		return decodeDNSControlFunc(r, strict, fn)
+	}
+	domains, err := decodeYAML(r)
+	if err != nil {
+		return err
+	}
+	for _, d := range domains {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeYAML reads hand-written expected records, mapping domains to names
+// to types to values:
+//
+//	example.com:
+//	  "@":
+//	    A: [192.0.2.1, 192.0.2.2]
+//	    MX: 10 mail.example.com.
+//	  www:
+//	    CNAME: example.com.
+//	    TXT: {ttl: 300, tags: [mail], values: ["v=spf1 -all"]}
+//
+// Values are given like with check-one. Record sets without a ttl get the
+// default TTL of DNSControl, see applyDefaultTTL.
+func decodeYAML(r io.Reader) ([]domain, error) {
+	var root yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&root); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+
+	var domains []domain
+	var errs inputErrors
+	add := func(n *yaml.Node, format string, args ...any) {
+		errs = append(errs, inputError{line: n.Line, msg: fmt.Sprintf(format, args...)})
+	}
+	domainNodes := root.Content[0]
+	if domainNodes.Kind != yaml.MappingNode {
+		return nil, inputErrors{{line: domainNodes.Line, msg: "expected a mapping of domains to names"}}
+	}
+	for i := 0; i < len(domainNodes.Content); i += 2 {
+		key, names := domainNodes.Content[i], domainNodes.Content[i+1]
+		dom := domain{Name: strings.TrimSuffix(key.Value, ".")}
+		if _, ok := dns.IsDomainName(dom.Name); !ok || dom.Name == "" {
+			add(key, "invalid domain name %q", key.Value)
+			continue
+		}
+		if names.Kind != yaml.MappingNode {
+			add(names, "domain %s: expected a mapping of names to types", dom.Name)
+			continue
+		}
+		for j := 0; j < len(names.Content); j += 2 {
+			nameKey, types := names.Content[j], names.Content[j+1]
+			name := relativeName(dom.Name, nameKey.Value)
+			if types.Kind != yaml.MappingNode {
+				add(types, "domain %s, %s: expected a mapping of types to values", dom.Name, name)
+				continue
+			}
+			for k := 0; k < len(types.Content); k += 2 {
+				typeKey, values := types.Content[k], types.Content[k+1]
+				typ := strings.ToUpper(typeKey.Value)
+				label := typ + " " + name
+				set, err := yamlValues(values)
+				if err != nil {
+					add(values, "domain %s, %s: %v", dom.Name, label, err)
+					continue
+				}
+				var meta map[string]string
+				if len(set.tags) > 0 {
+					meta = map[string]string{tagsMeta: strings.Join(set.tags, ",")}
+				}
+				for _, v := range set.values {
+					rec := record{Type: typ, Name: name, TTL: set.ttl, Class: set.class, Meta: meta, source: fmt.Sprintf("input line %d", v.Line)}
+					if err := parseRecordValue(&rec, v.Value); err != nil {
+						add(v, "domain %s, %s: %v", dom.Name, label, err)
+						continue
+					}
+					if problem := recordProblem(rec); problem != "" {
+						add(v, "domain %s, %s: %s", dom.Name, label, problem)
+						continue
+					}
+					dom.Records = append(dom.Records, rec)
+				}
+			}
+		}
+		dom.applyDefaultTTL()
+		domains = append(domains, dom)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return domains, nil
+}
+
+// yamlRecordSet is a record set of the YAML input.
+type yamlRecordSet struct {
+	// Maximal TTL, 0 if not given
+	ttl  int
+	tags []string
+	// DNS class, IN if empty
+	class  string
+	values []*yaml.Node
+}
+
+// yamlValues reads a record set given as a single value, a list of them, or
+// a mapping with values, ttl and tags.
+func yamlValues(n *yaml.Node) (yamlRecordSet, error) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return yamlRecordSet{values: []*yaml.Node{n}}, nil
+	case yaml.SequenceNode:
+		for _, v := range n.Content {
+			if v.Kind != yaml.ScalarNode {
+				return yamlRecordSet{}, fmt.Errorf("expected a list of values")
+			}
+		}
+		return yamlRecordSet{values: n.Content}, nil
+	case yaml.MappingNode:
+		var raw struct {
+			TTL    int         `yaml:"ttl"`
+			Tags   []string    `yaml:"tags"`
+			Class  string      `yaml:"class"`
+			Values []yaml.Node `yaml:"values"`
+		}
+		if err := n.Decode(&raw); err != nil {
+			return yamlRecordSet{}, err
+		}
+		if raw.TTL < 0 {
+			return yamlRecordSet{}, fmt.Errorf("negative TTL %d", raw.TTL)
+		}
+		set := yamlRecordSet{ttl: raw.TTL, tags: raw.Tags, class: raw.Class}
+		for i := range raw.Values {
+			if raw.Values[i].Kind != yaml.ScalarNode {
+				return yamlRecordSet{}, fmt.Errorf("expected a list of values")
+			}
+			set.values = append(set.values, &raw.Values[i])
+		}
+		return set, nil
+	}
+	return yamlRecordSet{}, fmt.Errorf("expected a value, a list of values, or values, ttl and tags")
+}